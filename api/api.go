@@ -20,6 +20,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/jtacoma/uritemplates"
@@ -104,6 +105,11 @@ func (c *APIClient) GetBody(path string) ([]byte, error) {
 // Get will do a GET http request, it adds the wercker endpoint and will add
 // some default headers.
 func (c *APIClient) Get(path string) (*http.Response, error) {
+	return c.get(path, nil)
+}
+
+// get does the GET request of Get with the extra headers in header.
+func (c *APIClient) get(path string, header http.Header) (*http.Response, error) {
 	url := c.URL(path)
 	c.logger.Debugln("API Get:", url)
 
@@ -113,6 +119,9 @@ func (c *APIClient) Get(path string) (*http.Response, error) {
 		return nil, err
 	}
 
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	AddRequestHeaders(req)
 	c.addAuthToken(req)
 
@@ -189,12 +198,47 @@ type DockerRepository struct {
 	// Sha256 checksum of the compressed tarball.
 	Sha256 string
 
-	// Size of the compressed tarball.
+	// Size of the compressed tarball, -1 when the server didn't send it.
+	Size int64
+
+	// Offset in the compressed tarball at which Content starts.
+	Offset int64
+}
+
+// RangeNotSatisfiableError is returned when a download is resumed at an
+// offset at or past the end of the docker repository. Size is the size of the
+// repository when the server sent it, 0 otherwise.
+type RangeNotSatisfiableError struct {
 	Size int64
 }
 
+func (e *RangeNotSatisfiableError) Error() string {
+	return "Requested range not satisfiable"
+}
+
+// contentRangeSize returns the size in a Content-Range header, either
+// "bytes <first>-<last>/<size>" or "bytes */<size>".
+func contentRangeSize(contentRange string) (int64, bool) {
+	i := strings.LastIndex(contentRange, "/")
+	if i == -1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
 // GetDockerRepository will retrieve a snappy-stream compressed tarball.
 func (c *APIClient) GetDockerRepository(buildID string) (*DockerRepository, error) {
+	return c.GetDockerRepositoryFrom(buildID, 0)
+}
+
+// GetDockerRepositoryFrom will retrieve a snappy-stream compressed tarball,
+// starting at offset. Servers that don't support ranges send the whole
+// tarball, check Offset to see where Content starts.
+func (c *APIClient) GetDockerRepositoryFrom(buildID string, offset int64) (*DockerRepository, error) {
 	model := make(map[string]interface{})
 	model["buildId"] = buildID
 
@@ -204,20 +248,41 @@ func (c *APIClient) GetDockerRepository(buildID string) (*DockerRepository, erro
 		return nil, err
 	}
 
-	res, err := c.Get(url)
-	if err != nil {
-		return nil, err
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
-	if res.StatusCode != 200 {
-		return nil, c.parseError(res)
+	res, err := c.get(url, header)
+	if err != nil {
+		return nil, err
 	}
 
-	return &DockerRepository{
+	repository := &DockerRepository{
 		Content: res.Body,
 		Sha256:  res.Header.Get("x-amz-meta-Sha256"),
 		Size:    res.ContentLength,
-	}, nil
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusPartialContent:
+		repository.Offset = offset
+		if res.ContentLength >= 0 {
+			repository.Size = offset + res.ContentLength
+		}
+		if size, ok := contentRangeSize(res.Header.Get("Content-Range")); ok {
+			repository.Size = size
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		size, _ := contentRangeSize(res.Header.Get("Content-Range"))
+		return nil, &RangeNotSatisfiableError{Size: size}
+	default:
+		return nil, c.parseError(res)
+	}
+
+	return repository, nil
 }
 
 // APIStepVersion is the data structure for the JSON returned by the wercker
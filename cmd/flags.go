@@ -41,6 +41,11 @@ var (
 		cli.StringSliceFlag{Name: "docker-dns", Value: &cli.StringSlice{0: "8.8.8.8", 1: "8.8.4.4"}, Usage: "Docker DNS server.", EnvVar: "DOCKER_DNS", Hidden: true},
 		cli.BoolFlag{Name: "docker-local", Usage: "Don't interact with remote repositories"},
 		cli.StringFlag{Name: "checkpoint", Value: "", Usage: "Skip to the next step after a recent build checkpoint."},
+		cli.StringFlag{Name: "runtime", Value: "docker", Usage: "Where to run the pipeline: docker, or local to use a shell on the host."},
+		cli.StringFlag{Name: "docker-memory-limit", Value: "", Usage: "Most memory a box or service may use, like 4g.", EnvVar: "WERCKER_DOCKER_MEMORY_LIMIT"},
+		cli.IntFlag{Name: "docker-cpu-quota-limit", Value: 0, Usage: "Highest cpu-quota a box or service may use.", EnvVar: "WERCKER_DOCKER_CPU_QUOTA_LIMIT"},
+		cli.StringFlag{Name: "docker-shm-size-limit", Value: "", Usage: "Largest shm-size a box or service may use, like 1g.", EnvVar: "WERCKER_DOCKER_SHM_SIZE_LIMIT"},
+		cli.BoolFlag{Name: "docker-allow-privileged", Usage: "Allow boxes and services to use privileged and cap-add.", EnvVar: "WERCKER_DOCKER_ALLOW_PRIVILEGED"},
 	}
 
 	// These flags control where we store local files
@@ -81,6 +86,7 @@ var (
 		cli.StringFlag{Name: "git-repository", Value: "", Usage: "Git repository.", EnvVar: "WERCKER_GIT_REPOSITORY", Hidden: true},
 		cli.StringFlag{Name: "git-branch", Value: "", Usage: "Git branch.", EnvVar: "WERCKER_GIT_BRANCH", Hidden: true},
 		cli.StringFlag{Name: "git-commit", Value: "", Usage: "Git commit.", EnvVar: "WERCKER_GIT_COMMIT", Hidden: true},
+		cli.StringFlag{Name: "git-tag", Value: "", Usage: "Git tag.", EnvVar: "WERCKER_GIT_TAG", Hidden: true},
 	}
 
 	// These flags affect our registry interactions
@@ -100,11 +106,20 @@ var (
 			(~/.aws/config, AWS_SECRET_ACCESS_KEY, etc), or from the --aws-secret-key and
 			--aws-access-key flags. It will upload to a bucket defined by --s3-bucket in
 			the region named by --aws-region`},
+		cli.StringFlag{Name: "artifact-store", Value: "", Usage: "Store artifacts in s3://bucket/prefix or a directory like file:///srv/artifacts, instead of --store-s3.", EnvVar: "WERCKER_ARTIFACT_STORE"},
+	}
+
+	// These flags affect where caches are kept between builds
+	CacheFlags = []cli.Flag{
+		cli.StringFlag{Name: "cache-store", Value: "", Usage: "Push and pull caches to a store: s3://bucket/prefix or file:///shared/dir.", EnvVar: "WERCKER_CACHE_STORE"},
+		cli.StringFlag{Name: "cache-max-size", Value: "1g", Usage: "Skip caches larger than this when pushing to or pulling from the cache store."},
 	}
 
 	// These flags affect our local execution environment
 	DevFlags = []cli.Flag{
 		cli.StringFlag{Name: "environment", Value: "ENVIRONMENT", Usage: "Specify additional environment variables in a file.", EnvVar: "WERCKER_ENVIRONMENT_FILE"},
+		cli.StringFlag{Name: "secrets-file", Value: "SECRETS", Usage: "Specify additional hidden environment variables in an encrypted file.", EnvVar: "WERCKER_SECRETS_FILE"},
+		cli.StringFlag{Name: "secrets-key-file", Value: "~/.wercker/secrets.key", Usage: "Key to decrypt the secrets file with, unless WERCKER_SECRETS_KEY is set.", EnvVar: "WERCKER_SECRETS_KEY_FILE"},
 		cli.BoolFlag{Name: "verbose", Usage: "Print more information."},
 		cli.BoolFlag{Name: "no-colors", Usage: "Wercker output will not use colors (does not apply to step output)."},
 		cli.BoolFlag{Name: "debug", Usage: "Print additional debug information."},
@@ -160,6 +175,12 @@ var (
 		cli.StringFlag{Name: "aws-access-key", Value: "", Usage: "Access key id. Used for artifact storage."},
 		cli.StringFlag{Name: "s3-bucket", Value: "wercker-development", Usage: "Bucket for artifact storage."},
 		cli.StringFlag{Name: "aws-region", Value: "us-east-1", Usage: "AWS region to use for artifact storage."},
+		cli.StringFlag{Name: "aws-profile", Value: "", Usage: "Profile in ~/.aws/credentials to use when no keys are given.", EnvVar: "AWS_PROFILE"},
+		cli.StringFlag{Name: "s3-endpoint", Value: "", Usage: "Url of an S3-compatible service, like MinIO or Ceph, to use instead of AWS."},
+		cli.BoolFlag{Name: "s3-path-style", Usage: "Address buckets as endpoint/bucket instead of bucket.endpoint."},
+		cli.BoolFlag{Name: "s3-insecure-skip-verify", Usage: "Don't verify the TLS certificate of the S3 endpoint."},
+		cli.StringFlag{Name: "s3-acl", Value: "private", Usage: "Canned ACL for uploaded files, empty for none."},
+		cli.StringFlag{Name: "s3-sse", Value: "AES256", Usage: "Server-side encryption for uploaded files: AES256, aws:kms or none."},
 	}
 
 	// keen.io bits
@@ -174,6 +195,7 @@ var (
 		cli.BoolFlag{Name: "report", Usage: "Report logs back to wercker (requires build-id, wercker-host, wercker-token).", Hidden: true},
 		cli.StringFlag{Name: "wercker-host", Usage: "Wercker host to use for wercker reporter.", Hidden: true},
 		cli.StringFlag{Name: "wercker-token", Usage: "Wercker token to use for wercker reporter.", Hidden: true},
+		cli.StringFlag{Name: "events-out", Usage: "Write all events as JSON lines to this file, file descriptor number or - for stdout."},
 	}
 
 	// These options might be overwritten by the wercker.yml
@@ -181,6 +203,7 @@ var (
 		cli.StringFlag{Name: "source-dir", Value: "", Usage: "Source path relative to checkout root."},
 		cli.Float64Flag{Name: "no-response-timeout", Value: 5, Usage: "Timeout if no script output is received in this many minutes."},
 		cli.Float64Flag{Name: "command-timeout", Value: 25, Usage: "Timeout if command does not complete in this many minutes."},
+		cli.StringFlag{Name: "command-protocol", Value: "sentinel", Usage: "How to tell when commands finish: sentinel, or framed for boxes with a POSIX shell."},
 		cli.StringFlag{Name: "wercker-yml", Value: "", Usage: "Specify a specific yaml file.", EnvVar: "WERCKER_YML_FILE"},
 	}
 
@@ -188,12 +211,29 @@ var (
 		[]cli.Flag{
 			cli.StringFlag{Name: "branch", Value: "", Usage: "Filter on this branch."},
 			cli.StringFlag{Name: "result", Value: "", Usage: "Filter on this result (passed or failed)."},
-			cli.StringFlag{Name: "output", Value: "./repository.tar", Usage: "Path to repository."},
+			cli.StringFlag{Name: "output", Value: "./repository.tar", Usage: "Path to repository, - streams it to stdout or, with --load, straight into docker."},
 			cli.BoolFlag{Name: "load", Usage: "Load the container into docker after downloading."},
 			cli.BoolFlag{Name: "f, force", Usage: "Override output if it already exists."},
 		},
 	}
 
+	ArtifactsFlagSet = [][]cli.Flag{
+		[]cli.Flag{
+			cli.StringFlag{Name: "artifact-store", Value: "", Usage: "Get artifacts from s3://bucket/prefix or file:///path, where the builds stored them.", EnvVar: "WERCKER_ARTIFACT_STORE"},
+			cli.StringFlag{Name: "branch", Value: "", Usage: "Use the latest build of the application on this branch."},
+			cli.StringFlag{Name: "result", Value: "", Usage: "Use the latest build of the application with this result (passed or failed)."},
+			cli.StringFlag{Name: "step", Value: "", Usage: "Only the artifacts of this step, pipeline for the output of the pipeline."},
+			cli.StringFlag{Name: "o, output", Value: ".", Usage: "Directory to download the artifacts to."},
+		},
+		AWSFlags,
+	}
+
+	ArtifactsVerifyFlagSet = [][]cli.Flag{
+		[]cli.Flag{
+			cli.StringFlag{Name: "manifest", Value: "", Usage: "Path to the manifest, defaults to the manifest.json next to the tarball."},
+		},
+	}
+
 	GlobalFlagSet = [][]cli.Flag{
 		DevFlags,
 		EndpointFlags,
@@ -212,6 +252,7 @@ var (
 		GitFlags,
 		RegistryFlags,
 		ArtifactFlags,
+		CacheFlags,
 		AWSFlags,
 		ConfigFlags,
 	}
@@ -224,6 +265,7 @@ var (
 		GitFlags,
 		RegistryFlags,
 		ArtifactFlags,
+		CacheFlags,
 		AWSFlags,
 		ConfigFlags,
 	}
@@ -236,6 +278,7 @@ var (
 		GitFlags,
 		RegistryFlags,
 		ArtifactFlags,
+		CacheFlags,
 		AWSFlags,
 		ConfigFlags,
 	}
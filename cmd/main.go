@@ -24,6 +24,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"reflect"
 	"sort"
@@ -54,6 +56,10 @@ var (
 			_ = godotenv.Load(envfile)
 
 			env := util.NewEnvironment(os.Environ()...)
+			if err := loadSecrets(c, env); err != nil {
+				cliLogger.Errorln("Unable to load secrets\n", err)
+				os.Exit(1)
+			}
 
 			settings := util.NewCLISettings(c)
 			opts, err := core.NewBuildOptions(settings, env)
@@ -83,6 +89,10 @@ var (
 
 			settings := util.NewCLISettings(c)
 			env := util.NewEnvironment(os.Environ()...)
+			if err := loadSecrets(c, env); err != nil {
+				cliLogger.Errorln("Unable to load secrets\n", err)
+				os.Exit(1)
+			}
 			opts, err := core.NewDevOptions(settings, env)
 			if err != nil {
 				cliLogger.Errorln("Invalid options\n", err)
@@ -139,6 +149,10 @@ var (
 
 			settings := util.NewCLISettings(c)
 			env := util.NewEnvironment(os.Environ()...)
+			if err := loadSecrets(c, env); err != nil {
+				cliLogger.Errorln("Unable to load secrets\n", err)
+				os.Exit(1)
+			}
 			opts, err := core.NewDeployOptions(settings, env)
 			if err != nil {
 				cliLogger.Errorln("Invalid options\n", err)
@@ -276,6 +290,116 @@ var (
 		},
 	}
 
+	artifactsCommand = cli.Command{
+		Name:  "artifacts",
+		Usage: "work with build artifacts",
+		Subcommands: []cli.Command{
+			{
+				Name:        "list",
+				Usage:       "list <application id or build id>",
+				Description: "list the artifacts of an application or a build in the artifact store",
+				Flags:       FlagsFor(ArtifactsFlagSet),
+				Action: func(c *cli.Context) {
+					if len(c.Args()) != 1 {
+						cliLogger.Errorln("List requires the application ID or the build ID as the only argument")
+						os.Exit(1)
+					}
+
+					settings := util.NewCLISettings(c)
+					env := util.NewEnvironment(os.Environ()...)
+					opts, err := core.NewArtifactsOptions(settings, env)
+					if err != nil {
+						cliLogger.Errorln("Invalid options\n", err)
+						os.Exit(1)
+					}
+					err = cmdArtifactsList(opts)
+					if err != nil {
+						cliLogger.Fatal(err)
+					}
+				},
+			},
+			{
+				Name:        "get",
+				Usage:       "get <build id>",
+				Description: "download and verify the artifacts of a build from the artifact store",
+				Flags:       FlagsFor(ArtifactsFlagSet),
+				Action: func(c *cli.Context) {
+					if len(c.Args()) != 1 {
+						cliLogger.Errorln("Get requires the build ID as the only argument")
+						os.Exit(1)
+					}
+
+					settings := util.NewCLISettings(c)
+					env := util.NewEnvironment(os.Environ()...)
+					opts, err := core.NewArtifactsOptions(settings, env)
+					if err != nil {
+						cliLogger.Errorln("Invalid options\n", err)
+						os.Exit(1)
+					}
+					err = cmdArtifactsGet(opts)
+					if err != nil {
+						cliLogger.Fatal(err)
+					}
+				},
+			},
+			{
+				Name:        "verify",
+				Usage:       "verify <tarball>",
+				Description: "check an artifact tarball against its manifest.json",
+				Flags:       FlagsFor(ArtifactsVerifyFlagSet),
+				Action: func(c *cli.Context) {
+					if len(c.Args()) != 1 {
+						cliLogger.Errorln("Verify requires the artifact tarball as the only argument")
+						os.Exit(1)
+					}
+
+					settings := util.NewCLISettings(c)
+					env := util.NewEnvironment(os.Environ()...)
+					opts, err := core.NewArtifactsVerifyOptions(settings, env)
+					if err != nil {
+						cliLogger.Errorln("Invalid options\n", err)
+						os.Exit(1)
+					}
+					err = cmdArtifactsVerify(opts)
+					if err != nil {
+						cliLogger.Fatal(err)
+					}
+				},
+			},
+		},
+	}
+
+	secretsCommand = cli.Command{
+		Name:  "secrets",
+		Usage: "manage the encrypted secrets file",
+		Subcommands: []cli.Command{
+			{
+				Name:        "ls",
+				Usage:       "ls",
+				Description: "list the names of the secrets",
+				Action:      secretsAction(cmdSecretsList),
+			},
+			{
+				Name:        "set",
+				Usage:       "set <name> [value]",
+				Description: "set a secret, the value is read from stdin when it is not given",
+				Action:      secretsAction(cmdSecretsSet),
+			},
+			{
+				Name:        "rm",
+				Usage:       "rm <name>...",
+				Description: "remove secrets",
+				Action:      secretsAction(cmdSecretsRemove),
+			},
+			{
+				Name:        "edit",
+				Usage:       "edit",
+				Description: "edit the secrets in $EDITOR",
+				Action:      secretsAction(cmdSecretsEdit),
+			},
+		},
+	}
+
 	versionCommand = cli.Command{
 		Name:      "version",
 		ShortName: "v",
@@ -352,6 +476,8 @@ func GetApp() *cli.App {
 		loginCommand,
 		logoutCommand,
 		pullCommand,
+		artifactsCommand,
+		secretsCommand,
 		versionCommand,
 		documentCommand(app),
 	}
@@ -573,123 +699,705 @@ func cmdPull(c *cli.Context, options *core.PullOptions, dockerOptions *dockerloc
 		AuthToken: options.GlobalOptions.AuthToken,
 	})
 
-	var buildID string
+	buildID, err := resolveBuildID(client, options.Repository, options.Branch, options.Result)
+	if err != nil {
+		return soft.Exit(err)
+	}
 
-	if core.IsBuildID(options.Repository) {
-		buildID = options.Repository
-	} else {
-		username, applicationName, err := core.ParseApplicationID(options.Repository)
+	logger.Println("Downloading Docker repository for build", buildID)
+
+	if options.Output == "-" {
+		err = streamRepository(client, buildID, options.Load, dockerOptions)
 		if err != nil {
 			return soft.Exit(err)
 		}
+		return nil
+	}
 
-		logger.Println("Fetching build information for application", options.Repository)
+	if !options.Force {
+		outputExists, err := util.Exists(options.Output)
+		if err != nil {
+			logger.WithField("Error", err).Error("Unable to create output file")
+			return soft.Exit(err)
+		}
 
-		opts := &api.GetBuildsOptions{
-			Limit:  1,
-			Branch: options.Branch,
-			Result: options.Result,
-			Status: "finished",
-			Stack:  5,
+		if outputExists {
+			return soft.Exit(errors.New("The file repository.tar already exists. Delete it, or run again with -f"))
 		}
+	}
+
+	// The compressed tarball is downloaded to a .part file next to the
+	// output, an interrupted pull resumes from there.
+	part := options.Output + ".part"
+	err = downloadRepository(client, buildID, part)
+	if err != nil {
+		logger.WithField("Error", err).Error("Unable to download Docker repository")
+		return soft.Exit(err)
+	}
+
+	logger.Println("Download complete")
+
+	err = decompressRepository(part, options.Output)
+	if err != nil {
+		logger.WithField("Error", err).Error("Unable to decompress Docker repository")
+		return soft.Exit(err)
+	}
+	os.Remove(part)
 
-		builds, err := client.GetBuilds(username, applicationName, opts)
+	if options.Load {
+		file, err := os.Open(options.Output)
 		if err != nil {
 			return soft.Exit(err)
 		}
+		defer file.Close()
 
-		if len(builds) != 1 {
-			return soft.Exit(errors.New("No finished builds found for this application"))
+		err = loadRepository(file, dockerOptions)
+		if err != nil {
+			return soft.Exit(err)
 		}
+	}
+
+	return nil
+}
+
+// pullMaxTries is how often a pull connects before giving up
+const pullMaxTries = 5
+
+// pullRetryDelay is the unit of the backoff between reconnects, which doubles
+// on every try
+var pullRetryDelay = time.Second
+
+// repositoryReader reads the compressed docker repository of a build and
+// resumes at the current offset, with a backoff, when the connection drops.
+type repositoryReader struct {
+	client  *api.APIClient
+	buildID string
+	content io.ReadCloser
+	offset  int64
+	size    int64
+	sha256  string
+	tries   int
+}
 
-		buildID = builds[0].ID
+// openRepository opens the docker repository of a build at offset, or at
+// the start when it can't be resumed there.
+func openRepository(client *api.APIClient, buildID string, offset int64) (*repositoryReader, error) {
+	r := &repositoryReader{client: client, buildID: buildID, offset: offset, tries: 1}
+	err := r.connect()
+	if rangeErr, ok := err.(*api.RangeNotSatisfiableError); ok && offset > 0 && rangeErr.Size == offset {
+		err = r.complete(offset)
 	}
+	if err != nil && offset > 0 {
+		util.RootLogger().WithField("Logger", "Main").Warnln("Unable to resume download, starting over:", err)
+		r.offset = 0
+		err = r.connect()
+	}
+	if err != nil {
+		err = r.reconnect(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-	if buildID == "" {
-		return soft.Exit(errors.New("Unable to parse argument as application or build-id"))
+// connect requests the repository from the current offset
+func (r *repositoryReader) connect() error {
+	repository, err := r.client.GetDockerRepositoryFrom(r.buildID, r.offset)
+	if err != nil {
+		return err
 	}
+	if repository.Offset != r.offset {
+		repository.Content.Close()
+		return fmt.Errorf("Server does not support resuming at %d bytes", r.offset)
+	}
+	if r.sha256 != "" && repository.Sha256 != r.sha256 {
+		repository.Content.Close()
+		return errors.New("Docker repository changed during the download")
+	}
+	r.content = repository.Content
+	r.size = repository.Size
+	r.sha256 = repository.Sha256
+	return nil
+}
 
-	logger.Println("Downloading Docker repository for build", buildID)
+// complete marks the repository as read up to size. The last byte is
+// requested once more, only to learn the checksum of the repository.
+func (r *repositoryReader) complete(size int64) error {
+	r.offset = size - 1
+	if err := r.connect(); err != nil {
+		return err
+	}
+	r.content.Close()
+	if r.size != size {
+		return fmt.Errorf("Docker repository is %d bytes, expected %d", r.size, size)
+	}
+	r.content = ioutil.NopCloser(strings.NewReader(""))
+	r.offset = size
+	return nil
+}
 
-	if !options.Force {
-		outputExists, err := util.Exists(options.Output)
-		if err != nil {
-			logger.WithField("Error", err).Error("Unable to create output file")
-			return soft.Exit(err)
+// reconnect tries to connect again, with a backoff, for as long as there are
+// tries left
+func (r *repositoryReader) reconnect(cause error) error {
+	logger := util.RootLogger().WithField("Logger", "Main")
+	for r.tries < pullMaxTries {
+		delay := time.Duration(1<<uint(r.tries)) * pullRetryDelay
+		r.tries++
+		logger.Warnf("Download failed (%s), resuming at %d bytes in %s", cause, r.offset, delay)
+		time.Sleep(delay)
+
+		cause = r.connect()
+		if cause == nil {
+			return nil
 		}
+	}
+	return cause
+}
 
-		if outputExists {
-			return soft.Exit(errors.New("The file repository.tar already exists. Delete it, or run again with -f"))
+// Read reads from the current connection and reconnects when it fails or
+// ends before the whole repository is read.
+func (r *repositoryReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.content.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF && r.size > 0 && r.offset < r.size {
+			err = io.ErrUnexpectedEOF
 		}
+		if err == nil || err == io.EOF || n > 0 {
+			// An error that comes with data is returned again by the next Read
+			if err != io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+
+		r.content.Close()
+		if err := r.reconnect(err); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close closes the current connection
+func (r *repositoryReader) Close() error {
+	return r.content.Close()
+}
+
+// downloadRepository downloads the compressed docker repository of a build
+// to part, resuming the download when part already exists. A part that
+// doesn't match the checksum is removed.
+func downloadRepository(client *api.APIClient, buildID, part string) error {
+	file, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	file, err := os.Create(options.Output)
+	offset, err := file.Seek(0, os.SEEK_END)
 	if err != nil {
-		logger.WithField("Error", err).Error("Unable to create output file")
-		return soft.Exit(err)
+		return err
 	}
 
-	repository, err := client.GetDockerRepository(buildID)
+	repository, err := openRepository(client, buildID, offset)
 	if err != nil {
-		os.Remove(file.Name())
-		return soft.Exit(err)
+		return err
+	}
+	defer repository.Close()
+
+	if repository.offset != offset {
+		if err := file.Truncate(repository.offset); err != nil {
+			return err
+		}
+		if _, err := file.Seek(repository.offset, os.SEEK_SET); err != nil {
+			return err
+		}
+	}
+
+	// A part that is already complete only needs to be hashed
+	if repository.size <= 0 || repository.offset < repository.size {
+		counter := util.NewCounterReader(repository)
+		// The progress is a percentage, it needs the size
+		var stopEmit chan<- bool
+		if repository.size > 0 {
+			stopEmit = emitProgress(counter, repository.offset, repository.size, util.NewRawLogger())
+		}
+		_, err = io.Copy(file, counter)
+		if stopEmit != nil {
+			stopEmit <- true
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The part may have been started by an earlier pull, hash all of it
+	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	calculatedHash := hex.EncodeToString(hash.Sum(nil))
+	if calculatedHash != repository.sha256 {
+		file.Close()
+		os.Remove(part)
+		return fmt.Errorf("Calculated hash did not match provided hash (calculated: %s ; expected: %s)", calculatedHash, repository.sha256)
+	}
+	return nil
+}
+
+// decompressRepository decompresses the snappy stream in part to output,
+// output is only replaced once all of it is written.
+func decompressRepository(part, output string) error {
+	compressed, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	defer compressed.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(output), ".wercker-pull-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, snappystream.NewReader(compressed, true))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), output)
+}
+
+// streamRepository streams the docker repository of a build into docker,
+// or to stdout, without writing it to disk. The checksum can only be checked
+// once everything has been read.
+func streamRepository(client *api.APIClient, buildID string, load bool, dockerOptions *dockerlocal.DockerOptions) error {
+	repository, err := openRepository(client, buildID, 0)
+	if err != nil {
+		return err
 	}
-	defer repository.Content.Close()
+	defer repository.Close()
 
 	// Diagram of the various readers/writers
-	//   repository <-- tee <-- s <-- [io.Copy] --> file
+	//   repository <-- tee <-- s <-- [io.Copy] --> stdout or docker
 	//               |
 	//               +--> hash       *Legend: --> == write, <-- == read
 
-	counter := util.NewCounterReader(repository.Content)
-
-	stopEmit := emitProgress(counter, repository.Size, util.NewRawLogger())
-
 	hash := sha256.New()
-	tee := io.TeeReader(counter, hash)
+	tee := io.TeeReader(repository, hash)
 	s := snappystream.NewReader(tee, true)
 
-	_, err = io.Copy(file, s)
+	if load {
+		err = loadRepository(s, dockerOptions)
+	} else {
+		_, err = io.Copy(os.Stdout, s)
+	}
 	if err != nil {
-		logger.WithField("Error", err).Error("Unable to copy data from URL to file")
-		os.Remove(file.Name())
-		return soft.Exit(err)
+		return err
 	}
 
-	stopEmit <- true
-
-	logger.Println("Download complete")
+	// Docker may stop reading before the end of the stream
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return err
+	}
 
 	calculatedHash := hex.EncodeToString(hash.Sum(nil))
-	if calculatedHash != repository.Sha256 {
-		return soft.Exit(fmt.Errorf("Calculated hash did not match provided hash (calculated: %s ; expected: %s)", calculatedHash, repository.Sha256))
+	if calculatedHash != repository.sha256 {
+		return fmt.Errorf("Calculated hash did not match provided hash (calculated: %s ; expected: %s)", calculatedHash, repository.sha256)
 	}
+	return nil
+}
 
-	if options.Load {
-		_, err = file.Seek(0, 0)
+// loadRepository loads a docker repository tarball into docker
+func loadRepository(r io.Reader, dockerOptions *dockerlocal.DockerOptions) error {
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	dockerClient, err := dockerlocal.NewDockerClient(dockerOptions)
+	if err != nil {
+		logger.WithField("Error", err).Error("Unable to create Docker client")
+		return err
+	}
+
+	logger.Println("Importing into Docker")
+
+	importImageOptions := docker.LoadImageOptions{InputStream: r}
+	err = dockerClient.LoadImage(importImageOptions)
+	if err != nil {
+		logger.WithField("Error", err).Error("Unable to load image")
+		return err
+	}
+
+	logger.Println("Finished importing into Docker")
+	return nil
+}
+
+// resolveBuildID returns the build ID for a build ID or, for an
+// application ID, the latest finished build matching branch and result
+func resolveBuildID(client *api.APIClient, target, branch, result string) (string, error) {
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	if core.IsBuildID(target) {
+		return target, nil
+	}
+
+	username, applicationName, err := core.ParseApplicationID(target)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Println("Fetching build information for application", target)
+
+	opts := &api.GetBuildsOptions{
+		Limit:  1,
+		Branch: branch,
+		Result: result,
+		Status: "finished",
+		Stack:  5,
+	}
+
+	builds, err := client.GetBuilds(username, applicationName, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if len(builds) != 1 {
+		return "", errors.New("No finished builds found for this application")
+	}
+
+	if builds[0].ID == "" {
+		return "", errors.New("Unable to parse argument as application or build-id")
+	}
+	return builds[0].ID, nil
+}
+
+// findStoredArtifacts returns the artifacts in the store of an application,
+// build or deploy, optionally only those of a step
+func findStoredArtifacts(store core.Store, target, step string) ([]*core.StoredArtifact, error) {
+	all, err := core.ListStoredArtifacts(store)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := []*core.StoredArtifact{}
+	for _, artifact := range all {
+		if target != artifact.ApplicationID && target != artifact.PipelineID() {
+			continue
+		}
+		if step != "" && step != artifact.StepName() {
+			continue
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+func cmdArtifactsList(options *core.ArtifactsOptions) error {
+	soft := NewSoftExit(options.GlobalOptions)
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	store, err := core.NewStoreFromURL(options.ArtifactStore, options.AWSOptions)
+	if err != nil {
+		return soft.Exit(err)
+	}
+
+	// The store doesn't know about branches or results, the API picks the
+	// build for those
+	target := options.Target
+	if options.Branch != "" || options.Result != "" {
+		target, err = resolveBuildID(newArtifactsAPIClient(options), target, options.Branch, options.Result)
 		if err != nil {
-			logger.WithField("Error", err).Error("Unable to reset seeker")
 			return soft.Exit(err)
 		}
+	}
+
+	artifacts, err := findStoredArtifacts(store, target, options.Step)
+	if err != nil {
+		return soft.Exit(err)
+	}
+	if len(artifacts) == 0 {
+		return soft.Exit(fmt.Errorf("No artifacts found for %s", target))
+	}
+	for _, artifact := range artifacts {
+		size, unit := util.ConvertUnit(artifact.Size)
+		logger.Printf("%s  %-24s  %4d %-2s  %s", artifact.PipelineID(), artifact.StepName(), size, unit, artifact.LastModified.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func cmdArtifactsGet(options *core.ArtifactsOptions) error {
+	soft := NewSoftExit(options.GlobalOptions)
+
+	store, err := core.NewStoreFromURL(options.ArtifactStore, options.AWSOptions)
+	if err != nil {
+		return soft.Exit(err)
+	}
+
+	buildID, err := resolveBuildID(newArtifactsAPIClient(options), options.Target, options.Branch, options.Result)
+	if err != nil {
+		return soft.Exit(err)
+	}
 
-		dockerClient, err := dockerlocal.NewDockerClient(dockerOptions)
+	found, err := findStoredArtifacts(store, buildID, options.Step)
+	if err != nil {
+		return soft.Exit(err)
+	}
+	artifacts := []*core.StoredArtifact{}
+	for _, artifact := range found {
+		if artifact.PipelineID() == buildID {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	if len(artifacts) == 0 {
+		return soft.Exit(fmt.Errorf("No artifacts found for build %s", buildID))
+	}
+
+	// A step can run more than once, those get their full id
+	names := map[string]int{}
+	for _, artifact := range artifacts {
+		names[artifact.StepName()]++
+	}
+	for _, artifact := range artifacts {
+		dir := artifact.StepName()
+		if names[dir] > 1 {
+			dir = artifact.BuildStepID
+		}
+		err := getStoredArtifact(store, artifact, filepath.Join(options.Output, dir))
 		if err != nil {
-			logger.WithField("Error", err).Error("Unable to create Docker client")
 			return soft.Exit(err)
 		}
+	}
+	return nil
+}
+
+// newArtifactsAPIClient is only used to resolve builds, the artifacts
+// themselves come from the store
+func newArtifactsAPIClient(options *core.ArtifactsOptions) *api.APIClient {
+	return api.NewAPIClient(&api.APIOptions{
+		BaseURL:   options.GlobalOptions.BaseURL,
+		AuthToken: options.GlobalOptions.AuthToken,
+	})
+}
+
+// getStoredArtifact downloads the tarball and manifest of an artifact to
+// dir and checks the tarball against the manifest
+func getStoredArtifact(store core.Store, artifact *core.StoredArtifact, dir string) error {
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, path.Base(artifact.Key))
+	logger.Println("Downloading", artifact.StepName(), "to", dst)
+	err := store.DownloadToFile(&core.DownloadToFileArgs{
+		Key:      artifact.Key,
+		Path:     dst,
+		MaxTries: 3,
+	})
+	if err != nil {
+		return err
+	}
+
+	if artifact.ManifestKey == "" {
+		logger.Warnln("No manifest for", artifact.Key, "unable to verify it")
+		return nil
+	}
+	manifestPath := filepath.Join(dir, "manifest.json")
+	err = store.DownloadToFile(&core.DownloadToFileArgs{
+		Key:      artifact.ManifestKey,
+		Path:     manifestPath,
+		MaxTries: 3,
+	})
+	if err != nil {
+		return err
+	}
+	manifest, err := core.ReadArtifactManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	tarball, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+	return manifest.Verify(tarball)
+}
 
-		logger.Println("Importing into Docker")
+// loadSecrets decrypts the secrets file, when there is one, into the hidden
+// env
+func loadSecrets(c *cli.Context, env *util.Environment) error {
+	opts, err := core.NewSecretsOptions(util.NewCLISettings(c), env)
+	if err != nil {
+		return err
+	}
+	return core.LoadSecrets(opts, env)
+}
 
-		importImageOptions := docker.LoadImageOptions{InputStream: file}
-		err = dockerClient.LoadImage(importImageOptions)
+// secretsAction sets up the options for the secrets subcommands
+func secretsAction(cmd func(*core.SecretsOptions, []string) error) func(*cli.Context) {
+	return func(c *cli.Context) {
+		settings := util.NewCLISettings(c)
+		env := util.NewEnvironment(os.Environ()...)
+		opts, err := core.NewSecretsOptions(settings, env)
 		if err != nil {
-			logger.WithField("Error", err).Error("Unable to load image")
-			return soft.Exit(err)
+			cliLogger.Errorln("Invalid options\n", err)
+			os.Exit(1)
+		}
+		err = cmd(opts, c.Args())
+		if err != nil {
+			cliLogger.Fatal(err)
 		}
+	}
+}
 
-		logger.Println("Finished importing into Docker")
+// openSecrets decrypts the secrets file, a missing file has no secrets. With
+// create a key is generated when there is none yet.
+func openSecrets(options *core.SecretsOptions, create bool) ([]byte, map[string]string, error) {
+	env := util.NewEnvironment(os.Environ()...)
+	key, err := core.ReadSecretsKey(options.SecretsKeyFile, env)
+	if err == core.ErrSecretsKeyNotFound && create {
+		key, err = core.GenerateSecretsKey(options.SecretsKeyFile)
+		if err == nil {
+			cliLogger.Println("Generated a new secrets key in", options.SecretsKeyFile)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets, err := core.ReadSecrets(options.SecretsFile, key)
+	if os.IsNotExist(err) {
+		return key, map[string]string{}, nil
+	}
+	return key, secrets, err
+}
+
+func cmdSecretsList(options *core.SecretsOptions, args []string) error {
+	_, secrets, err := openSecrets(options, false)
+	if err != nil {
+		return err
+	}
+	for _, name := range core.SecretNames(secrets) {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func cmdSecretsSet(options *core.SecretsOptions, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Set requires the name and, unless it is read from stdin, the value")
+	}
+	name := args[0]
+	if err := core.ValidateSecretName(name); err != nil {
+		return err
+	}
+
+	var value string
+	if len(args) == 2 {
+		value = args[1]
+	} else {
+		// Values on stdin stay out of the shell history
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	key, secrets, err := openSecrets(options, true)
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return core.WriteSecrets(options.SecretsFile, key, secrets)
+}
+
+func cmdSecretsRemove(options *core.SecretsOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Rm requires the names of the secrets to remove")
+	}
+	key, secrets, err := openSecrets(options, false)
+	if err != nil {
+		return err
+	}
+	for _, name := range args {
+		if _, ok := secrets[name]; !ok {
+			return fmt.Errorf("No secret named %s", name)
+		}
+		delete(secrets, name)
+	}
+	return core.WriteSecrets(options.SecretsFile, key, secrets)
+}
+
+func cmdSecretsEdit(options *core.SecretsOptions, args []string) error {
+	key, secrets, err := openSecrets(options, true)
+	if err != nil {
+		return err
+	}
+
+	// TempFile is only readable by the user
+	file, err := ioutil.TempFile("", "wercker-secrets-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(core.FormatSecrets(secrets))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Editor failed, the secrets were not changed: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return err
+	}
+	secrets, err = core.ParseSecrets(data)
+	if err != nil {
+		return fmt.Errorf("The secrets were not changed: %s", err)
+	}
+	return core.WriteSecrets(options.SecretsFile, key, secrets)
+}
+
+func cmdArtifactsVerify(options *core.ArtifactsVerifyOptions) error {
+	soft := NewSoftExit(options.GlobalOptions)
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	manifest, err := core.ReadArtifactManifest(options.Manifest)
+	if err != nil {
+		return soft.Exit(err)
+	}
+
+	tarball, err := os.Open(options.Tarball)
+	if err != nil {
+		return soft.Exit(err)
+	}
+	defer tarball.Close()
+
+	err = manifest.Verify(tarball)
+	if err != nil {
+		return soft.Exit(err)
 	}
 
+	logger.Printf("Verified %d files in %s", len(manifest.Files), options.Tarball)
 	return nil
 }
 
@@ -713,12 +1421,12 @@ func askForConfirmation() bool {
 
 // emitProgress will keep emitting progress until a value is send into the
 // returned channel.
-func emitProgress(counter *util.CounterReader, total int64, logger *util.Logger) chan<- bool {
+func emitProgress(counter *util.CounterReader, start, total int64, logger *util.Logger) chan<- bool {
 	stop := make(chan bool)
 	go func(stop chan bool, counter *util.CounterReader, total int64) {
 		prev := int64(-1)
 		for {
-			current := counter.Count()
+			current := start + counter.Count()
 			percentage := (100 * current) / total
 
 			select {
@@ -877,6 +1585,7 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 	if err != nil {
 		return nil, err
 	}
+	defer r.Close()
 
 	// Main timer
 	mainTimer := util.NewTimer()
@@ -897,9 +1606,11 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 	DumpOptions(options)
 
 	// Do some sanity checks before starting
-	err = dockerlocal.RequireDockerEndpoint(dockerOptions)
-	if err != nil {
-		return nil, soft.Exit(err)
+	if options.Runtime != "local" {
+		err = dockerlocal.RequireDockerEndpoint(dockerOptions)
+		if err != nil {
+			return nil, soft.Exit(err)
+		}
 	}
 
 	// Start copying code
@@ -997,18 +1708,26 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 					logger.Printf(f.Info("Found checkpoint", options.Checkpoint))
 					checkpoint = true
 				}
-				stepCounter.Increment()
+				for range core.FlattenSteps(step) {
+					stepCounter.Increment()
+				}
 				continue
 			}
 		}
 		logger.Printf(f.Info("Running step", step.DisplayName()))
 		timer.Reset()
-		sr, err := r.RunStep(shared, step, stepCounter.Increment())
+		var sr *StepResult
+		if group, ok := step.(*core.ParallelStep); ok {
+			sr, err = r.RunParallelStep(shared, group, stepCounter)
+		} else {
+			sr, err = r.RunStep(shared, step, stepCounter.Increment())
+		}
 		if err != nil {
 			pr.Success = false
 			pr.FailedStepName = step.DisplayName()
 			pr.FailedStepMessage = sr.Message
 			logger.Printf(f.Fail("Step failed", step.DisplayName(), timer.String()))
+			r.DumpServiceLogs(shared)
 			break
 		}
 
@@ -1017,7 +1736,9 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 			box.Commit(box.Repository(), fmt.Sprintf("w-%s", step.Checkpoint()), "checkpoint", false)
 		}
 
-		if options.Verbose {
+		if sr.Skipped {
+			logger.Printf(f.Info("Skipped step", step.DisplayName()))
+		} else if options.Verbose {
 			logger.Printf(f.Success("Step passed", step.DisplayName(), timer.String()))
 		}
 	}
@@ -1032,7 +1753,19 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 	// We need to wind the counter to where it should be if we failed a step
 	// so that is the number of steps + get code + setup environment + store
 	// TODO(termie): remove all the this "order" stuff completely
-	stepCounter.Current = len(pipeline.Steps()) + 3
+	stepCounter.Current = len(core.FlattenSteps(pipeline.Steps()...)) + 3
+
+	// Only store the keyed caches of builds that passed
+	if pr.Success && len(shared.caches) > 0 {
+		timer.Reset()
+		err = r.SaveCaches(shared)
+		if err != nil {
+			logger.WithField("Error", err).Error("Unable to store keyed caches")
+		}
+		if options.Verbose {
+			logger.Printf(f.Success("Exported keyed caches", timer.String()))
+		}
+	}
 
 	if pr.Success && options.ShouldArtifacts {
 		// At this point the build has effectively passed but we can still mess it
@@ -1122,7 +1855,7 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 					})
 				}
 
-				if options.ShouldStoreS3 {
+				if options.ShouldUploadArtifacts() {
 					artificer := dockerlocal.NewArtificer(options, dockerOptions)
 					err = artificer.Upload(artifact)
 					if err != nil {
@@ -1172,13 +1905,19 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		// into the CacheDir
 		if !options.DirectMount {
 			timer.Reset()
-			err = pipeline.CollectCache(shared.containerID)
+			err = r.CollectCache(shared)
 			if err != nil {
 				logger.WithField("Error", err).Error("Unable to store cache")
 			}
 			if options.Verbose {
 				logger.Printf(f.Success("Exported Cache", timer.String()))
 			}
+			if err == nil {
+				err = r.PushCache()
+				if err != nil {
+					logger.WithField("Error", err).Error("Unable to push cache to the cache store")
+				}
+			}
 		}
 
 		if pr.Success {
@@ -1214,6 +1953,7 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		sessionCtx:  newSessCtx,
 		containerID: shared.containerID,
 		config:      shared.config,
+		result:      pr,
 	}
 
 	// Set up the base environment
@@ -1231,11 +1971,20 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 	for _, step := range pipeline.AfterSteps() {
 		logger.Println(f.Info("Running after-step", step.DisplayName()))
 		timer.Reset()
-		_, err := r.RunStep(newShared, step, stepCounter.Increment())
+		var sr *StepResult
+		if group, ok := step.(*core.ParallelStep); ok {
+			sr, err = r.RunParallelStep(newShared, group, stepCounter)
+		} else {
+			sr, err = r.RunStep(newShared, step, stepCounter.Increment())
+		}
 		if err != nil {
 			logger.Println(f.Fail("After-step failed", step.DisplayName(), timer.String()))
 			break
 		}
+		if sr.Skipped {
+			logger.Println(f.Info("Skipped after-step", step.DisplayName()))
+			continue
+		}
 		logger.Println(f.Success("After-step passed", step.DisplayName(), timer.String()))
 	}
 
@@ -1243,13 +1992,19 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 	// into the CacheDir
 	if !options.DirectMount {
 		timer.Reset()
-		err = pipeline.CollectCache(newShared.containerID)
+		err = r.CollectCache(newShared)
 		if err != nil {
 			logger.WithField("Error", err).Error("Unable to store cache")
 		}
 		if options.Verbose {
 			logger.Printf(f.Success("Exported Cache", timer.String()))
 		}
+		if err == nil {
+			err = r.PushCache()
+			if err != nil {
+				logger.WithField("Error", err).Error("Unable to push cache to the cache store")
+			}
+		}
 	}
 
 	if pr.Success {
@@ -0,0 +1,262 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/api"
+	"github.com/wercker/wercker/util"
+)
+
+type PullSuite struct {
+	*util.TestSuite
+	retryDelay time.Duration
+}
+
+func TestPullSuite(t *testing.T) {
+	suiteTester := &PullSuite{TestSuite: &util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *PullSuite) SetupTest() {
+	s.TestSuite.SetupTest()
+	s.retryDelay = pullRetryDelay
+	pullRetryDelay = time.Millisecond
+}
+
+func (s *PullSuite) TearDownTest() {
+	pullRetryDelay = s.retryDelay
+	s.TestSuite.TearDownTest()
+}
+
+// repositoryServer serves a docker repository like the wercker API, drops
+// holds how many bytes are sent before the connection drops, one for each
+// request that should fail
+type repositoryServer struct {
+	content         []byte
+	noRanges        bool
+	noContentLength bool
+
+	mutex    sync.Mutex
+	drops    []int
+	requests []string
+}
+
+func (r *repositoryServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	r.requests = append(r.requests, req.Header.Get("Range"))
+	drop := -1
+	if len(r.drops) > 0 {
+		drop, r.drops = r.drops[0], r.drops[1:]
+	}
+	r.mutex.Unlock()
+
+	hash := sha256.Sum256(r.content)
+	w.Header().Set("x-amz-meta-Sha256", hex.EncodeToString(hash[:]))
+
+	size := len(r.content)
+	offset := 0
+	if rng := req.Header.Get("Range"); rng != "" && !r.noRanges {
+		offset, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+	}
+	if offset >= size {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	body := r.content[offset:]
+	if !r.noContentLength {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	if offset > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if r.noContentLength {
+		// Without a Content-Length the body is sent chunked
+		w.(http.Flusher).Flush()
+	}
+
+	// Sending less than Content-Length makes the server close the connection
+	if drop >= 0 && drop < len(body) {
+		body = body[:drop]
+	}
+	w.Write(body)
+}
+
+func (s *PullSuite) serve(repository *repositoryServer) (*api.APIClient, func()) {
+	server := httptest.NewServer(repository)
+	client := api.NewAPIClient(&api.APIOptions{BaseURL: server.URL})
+	return client, server.Close
+}
+
+func (s *PullSuite) content() []byte {
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func (s *PullSuite) TestDownloadRepository() {
+	repository := &repositoryServer{content: s.content()}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := downloadRepository(client, "build", part)
+	s.Require().Nil(err)
+
+	downloaded, err := ioutil.ReadFile(part)
+	s.Require().Nil(err)
+	s.Equal(repository.content, downloaded)
+	s.Equal([]string{""}, repository.requests)
+}
+
+func (s *PullSuite) TestDownloadRepositoryWithoutContentLength() {
+	repository := &repositoryServer{content: s.content(), noContentLength: true}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := downloadRepository(client, "build", part)
+	s.Require().Nil(err)
+
+	downloaded, err := ioutil.ReadFile(part)
+	s.Require().Nil(err)
+	s.Equal(repository.content, downloaded)
+}
+
+func (s *PullSuite) TestDownloadRepositoryResumesDroppedConnection() {
+	repository := &repositoryServer{content: s.content(), drops: []int{1000, 2000}}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := downloadRepository(client, "build", part)
+	s.Require().Nil(err)
+
+	downloaded, err := ioutil.ReadFile(part)
+	s.Require().Nil(err)
+	s.Equal(repository.content, downloaded)
+	s.Equal([]string{"", "bytes=1000-", "bytes=3000-"}, repository.requests)
+}
+
+func (s *PullSuite) TestDownloadRepositoryResumesPart() {
+	repository := &repositoryServer{content: s.content()}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := ioutil.WriteFile(part, repository.content[:5000], 0644)
+	s.Require().Nil(err)
+
+	err = downloadRepository(client, "build", part)
+	s.Require().Nil(err)
+
+	downloaded, err := ioutil.ReadFile(part)
+	s.Require().Nil(err)
+	s.Equal(repository.content, downloaded)
+	s.Equal([]string{"bytes=5000-"}, repository.requests)
+}
+
+func (s *PullSuite) TestDownloadRepositoryCompletePart() {
+	repository := &repositoryServer{content: s.content()}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := ioutil.WriteFile(part, repository.content, 0644)
+	s.Require().Nil(err)
+
+	err = downloadRepository(client, "build", part)
+	s.Require().Nil(err)
+
+	downloaded, err := ioutil.ReadFile(part)
+	s.Require().Nil(err)
+	s.Equal(repository.content, downloaded)
+	size := len(repository.content)
+	s.Equal([]string{fmt.Sprintf("bytes=%d-", size), fmt.Sprintf("bytes=%d-", size-1)}, repository.requests)
+}
+
+func (s *PullSuite) TestDownloadRepositoryStartsOverWithoutRanges() {
+	repository := &repositoryServer{content: s.content(), noRanges: true}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := ioutil.WriteFile(part, []byte("stale"), 0644)
+	s.Require().Nil(err)
+
+	err = downloadRepository(client, "build", part)
+	s.Require().Nil(err)
+
+	downloaded, err := ioutil.ReadFile(part)
+	s.Require().Nil(err)
+	s.Equal(repository.content, downloaded)
+	s.Equal([]string{"bytes=5-", ""}, repository.requests)
+}
+
+func (s *PullSuite) TestDownloadRepositoryRemovesCorruptPart() {
+	repository := &repositoryServer{content: s.content()}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	part := filepath.Join(s.WorkingDir(), "repository.tar.part")
+	err := ioutil.WriteFile(part, []byte("corrupt"), 0644)
+	s.Require().Nil(err)
+
+	err = downloadRepository(client, "build", part)
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "Calculated hash did not match")
+
+	_, err = os.Stat(part)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *PullSuite) TestRepositoryReaderGivesUp() {
+	repository := &repositoryServer{content: s.content()}
+	for i := 0; i < pullMaxTries; i++ {
+		repository.drops = append(repository.drops, 0)
+	}
+	client, stop := s.serve(repository)
+	defer stop()
+
+	reader, err := openRepository(client, "build", 0)
+	s.Require().Nil(err)
+	defer reader.Close()
+
+	_, err = ioutil.ReadAll(reader)
+	s.NotNil(err)
+	s.Len(repository.requests, pullMaxTries)
+}
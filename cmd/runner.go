@@ -16,11 +16,15 @@ package cmd
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pborman/uuid"
@@ -28,6 +32,7 @@ import (
 	"github.com/wercker/wercker/core"
 	"github.com/wercker/wercker/docker"
 	"github.com/wercker/wercker/event"
+	"github.com/wercker/wercker/local"
 	"github.com/wercker/wercker/util"
 	"golang.org/x/net/context"
 )
@@ -82,10 +87,12 @@ type Runner struct {
 	literalLogger *event.LiteralLogHandler
 	metrics       *event.MetricsEventHandler
 	reporter      *event.ReportHandler
+	events        *event.JSONLinesHandler
 	getPipeline   pipelineGetter
 	logger        *util.LogEntry
 	emitter       *core.NormalizedEmitter
 	formatter     *util.Formatter
+	cacheStore    *core.RemoteCache
 }
 
 // NewRunner from global options
@@ -101,6 +108,24 @@ func NewRunner(ctx context.Context, options *core.PipelineOptions, dockerOptions
 	// }
 	// h.ListenTo(e)
 
+	// The local runtime keeps the guest paths in a scratch dir on the host
+	if options.Runtime == "local" {
+		local.PrepareOptions(options)
+		if options.ShouldArtifacts {
+			logger.Warnln("Artifacts are not supported by the local runtime, not storing them")
+			options.ShouldArtifacts = false
+		}
+	}
+
+	var cacheStore *core.RemoteCache
+	if options.CacheStore != "" {
+		store, err := core.NewStoreFromURL(options.CacheStore, options.AWSOptions)
+		if err != nil {
+			return nil, err
+		}
+		cacheStore = core.NewRemoteCache(store, options.CacheMaxSize)
+	}
+
 	if options.Debug {
 		dh := core.NewDebugHandler()
 		dh.ListenTo(e)
@@ -130,19 +155,38 @@ func NewRunner(ctx context.Context, options *core.PipelineOptions, dockerOptions
 		r.ListenTo(e)
 	}
 
+	var jh *event.JSONLinesHandler
+	if options.EventsOut != "" {
+		jh, err = event.NewJSONLinesHandler(options.EventsOut)
+		if err != nil {
+			return nil, err
+		}
+		jh.ListenTo(e)
+	}
+
 	return &Runner{
 		options:       options,
 		dockerOptions: dockerOptions,
 		literalLogger: l,
 		metrics:       mh,
 		reporter:      r,
+		events:        jh,
 		getPipeline:   getPipeline,
 		logger:        logger,
 		emitter:       e,
 		formatter:     &util.Formatter{options.GlobalOptions.ShowColors},
+		cacheStore:    cacheStore,
 	}, nil
 }
 
+// Close closes the event stream, if there is one
+func (p *Runner) Close() error {
+	if p.events != nil {
+		return p.events.Close()
+	}
+	return nil
+}
+
 // ProjectDir returns the directory where we expect to find the code for this project
 func (p *Runner) ProjectDir() string {
 	if p.options.DirectMount {
@@ -312,6 +356,9 @@ func (p *Runner) GetConfig() (*core.Config, string, error) {
 
 // AddServices fetches and links the services to the base box.
 func (p *Runner) AddServices(ctx context.Context, pipeline core.Pipeline, box core.Box) error {
+	if p.options.Runtime == "local" && len(pipeline.Services()) > 0 {
+		return fmt.Errorf("Services are not supported by the local runtime")
+	}
 	f := p.formatter
 	timer := util.NewTimer()
 	for _, service := range pipeline.Services() {
@@ -324,13 +371,21 @@ func (p *Runner) AddServices(ctx context.Context, pipeline core.Pipeline, box co
 		if p.options.Verbose {
 			p.logger.Printf(f.Success(fmt.Sprintf("Fetched %s", service.GetName()), timer.String()))
 		}
-		// TODO(mh): We want to make sure container is running fully before
-		// allowing build steps to run. We may need custom steps which block
-		// until service services are running.
 	}
 	return nil
 }
 
+// DumpServiceLogs shows the tail of the logs of the services, they usually
+// have something to say about why a step failed
+func (p *Runner) DumpServiceLogs(shared *RunnerShared) {
+	for _, service := range shared.pipeline.Services() {
+		err := service.DumpLogs(shared.sessionCtx)
+		if err != nil {
+			p.logger.WithField("Error", err).Debug("Unable to get service logs")
+		}
+	}
+}
+
 // CopyCache copies the source into the HostPath
 func (p *Runner) CopyCache() error {
 	timer := util.NewTimer()
@@ -377,14 +432,40 @@ func (p *Runner) CopySource() error {
 
 // GetSession attaches to the container and returns a session.
 func (p *Runner) GetSession(runnerContext context.Context, containerID string) (context.Context, *core.Session, error) {
-	dockerTransport, err := dockerlocal.NewDockerTransport(p.options, p.dockerOptions, containerID)
+	var transport core.Transport
+	var err error
+	if p.options.Runtime == "local" {
+		transport, err = local.NewLocalTransport(p.options)
+	} else {
+		transport, err = dockerlocal.NewDockerTransport(p.options, p.dockerOptions, containerID)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	sess := core.NewSession(p.options, dockerTransport)
+	sess := core.NewSession(p.options, transport)
+	sessionCtx, err := sess.Attach(runnerContext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sessionCtx, sess, nil
+}
+
+// GetExecSession returns a new session running next to the main process of the
+// container, used to run more than one step at the same time.
+func (p *Runner) GetExecSession(runnerContext context.Context, containerID string) (context.Context, *core.Session, error) {
+	var transport core.Transport
+	var err error
+	if p.options.Runtime == "local" {
+		// Every local session is a new shell already
+		transport, err = local.NewLocalTransport(p.options)
+	} else {
+		transport, err = dockerlocal.NewDockerExecTransport(p.options, p.dockerOptions, containerID)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
+	sess := core.NewSession(p.options, transport)
 	sessionCtx, err := sess.Attach(runnerContext)
 	if err != nil {
 		return nil, nil, err
@@ -393,6 +474,288 @@ func (p *Runner) GetSession(runnerContext context.Context, containerID string) (
 	return sessionCtx, sess, nil
 }
 
+// CollectFile gets a file from the guest, with the local runtime the guest
+// paths are on the host.
+func (p *Runner) CollectFile(shared *RunnerShared, step core.Step, path, name string, dst io.Writer) error {
+	if p.options.Runtime == "local" {
+		return local.CollectFile(path, name, dst)
+	}
+	return step.CollectFile(shared.containerID, path, name, dst)
+}
+
+// CollectGuestFile gets a file from the guest that doesn't belong to a step
+func (p *Runner) CollectGuestFile(shared *RunnerShared, path, name string, dst io.Writer) error {
+	if p.options.Runtime == "local" {
+		return local.CollectFile(path, name, dst)
+	}
+	client, err := dockerlocal.NewDockerClient(p.dockerOptions)
+	if err != nil {
+		return err
+	}
+	return client.CollectFile(shared.containerID, path, name, dst)
+}
+
+// keyedCacheStore is where the tarballs of the keyed caches are kept, not
+// in the CachePath as that gets copied into every build
+func (p *Runner) keyedCacheStore() *core.KeyedCacheStore {
+	return core.NewKeyedCacheStore(p.options.WorkingPath("caches"))
+}
+
+// RestoreCaches fills in the keys of the caches of the pipeline and stages
+// the tarballs we find for them, SetupGuest unpacks them in the source dir
+func (p *Runner) RestoreCaches(pipeline core.Pipeline) ([]*core.KeyedCache, error) {
+	caches := []*core.KeyedCache{}
+	if len(pipeline.Caches()) == 0 {
+		return caches, nil
+	}
+	if p.options.DirectMount {
+		p.logger.Warnln("Keyed caches are not used with direct mounts")
+		return caches, nil
+	}
+
+	store := p.keyedCacheStore()
+	data := &core.CacheKeyData{
+		Branch:   p.options.GitBranch,
+		Commit:   p.options.GitCommit,
+		Pipeline: p.options.Pipeline,
+	}
+	root := p.options.HostPath("source", p.options.SourceDir)
+
+	err := os.MkdirAll(p.options.HostPath("keyed-cache"), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, config := range pipeline.Caches() {
+		key, err := core.RenderCacheKey(config.Key, root, pipeline.Env(), data)
+		if err != nil {
+			p.logger.Warnln("Not using cache", config.Key, err)
+			continue
+		}
+		cache := &core.KeyedCache{Config: config, Key: key}
+		caches = append(caches, cache)
+
+		err = p.pullKeyedCache(store, key, config.RestoreKeys)
+		if err != nil {
+			p.logger.WithField("Error", err).Warnln("Unable to pull cache", key, "from the cache store")
+		}
+
+		cache.Restored, err = store.Find(key, config.RestoreKeys)
+		if err != nil {
+			return nil, err
+		}
+		if cache.Restored == "" {
+			p.logger.Println(p.formatter.Info("No cache found for", key))
+			continue
+		}
+
+		// Hard link it when we can, these can be big
+		src := store.Path(cache.Restored)
+		dst := p.options.HostPath("keyed-cache", fmt.Sprintf("%d.tar", i))
+		if err := os.Link(src, dst); err != nil {
+			err = shutil.CopyFile(src, dst, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.logger.Println(p.formatter.Info("Restoring cache", cache.Restored))
+	}
+	return caches, nil
+}
+
+// SaveCaches packs up the paths of the caches that were not restored with
+// their exact key and stores them under that key
+func (p *Runner) SaveCaches(shared *RunnerShared) error {
+	store := p.keyedCacheStore()
+	err := os.MkdirAll(p.options.WorkingPath("caches"), 0755)
+	if err != nil {
+		return err
+	}
+
+	shared.sess.HideLogs()
+	defer shared.sess.ShowLogs()
+
+	for i, cache := range shared.caches {
+		if cache.Hit() {
+			continue
+		}
+		name := fmt.Sprintf("%d.tar", i)
+		paths := []string{}
+		for _, cachePath := range cache.Config.Paths {
+			paths = append(paths, fmt.Sprintf("%q", cachePath))
+		}
+		cmd := fmt.Sprintf(`mkdir -p "%s" && cd "%s" && tar -cf "%s" %s`,
+			p.options.GuestPath("keyed-cache"),
+			p.options.SourcePath(),
+			p.options.GuestPath("keyed-cache", name),
+			strings.Join(paths, " "),
+		)
+		exit, _, err := shared.sess.SendChecked(shared.sessionCtx, cmd)
+		if err != nil {
+			return err
+		}
+		if exit != 0 {
+			p.logger.Warnln("Not saving cache", cache.Key, "some of its paths are missing")
+			continue
+		}
+
+		// Write it next to the others and move it in place once it's all there
+		tmp := store.Path(cache.Key) + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		err = p.CollectGuestFile(shared, p.options.GuestPath("keyed-cache"), name, f)
+		f.Close()
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		err = os.Rename(tmp, store.Path(cache.Key))
+		if err != nil {
+			return err
+		}
+		p.logger.Println(p.formatter.Info("Saved cache", cache.Key))
+
+		if p.cacheStore != nil {
+			err = p.pushCacheFile(store.Path(cache.Key), core.RemoteCacheKey(p.options, path.Join("keyed", cache.Key+".tar")))
+			if err != nil {
+				p.logger.WithField("Error", err).Warnln("Unable to push cache", cache.Key, "to the cache store")
+			}
+		}
+	}
+	return nil
+}
+
+// CollectCache stores the cache of the pipeline in the CachePath
+func (p *Runner) CollectCache(shared *RunnerShared) error {
+	if p.options.Runtime == "local" {
+		return local.CollectCache(p.options)
+	}
+	return shared.pipeline.CollectCache(shared.containerID)
+}
+
+// PullCache fills an empty CachePath with the cache from the cache store
+func (p *Runner) PullCache() error {
+	if p.cacheStore == nil {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(p.options.CachePath())
+	if err == nil && len(entries) > 0 {
+		return nil
+	}
+
+	err = os.MkdirAll(p.options.WorkingDir, 0755)
+	if err != nil {
+		return err
+	}
+	tarball := p.options.WorkingPath("cache.tar.gz")
+	defer os.Remove(tarball)
+	found, err := p.cacheStore.Pull(core.RemoteCacheKey(p.options, "cache.tar.gz"), tarball)
+	if err == core.ErrStoreTooLarge {
+		p.logger.Warnln("Not pulling cache, it is larger than the cache-max-size")
+		return nil
+	}
+	if err != nil || !found {
+		return err
+	}
+
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = util.Untargzip(p.options.CachePath(), f)
+	if err != nil {
+		return err
+	}
+	p.logger.Println(p.formatter.Info("Pulled cache from the cache store"))
+	return nil
+}
+
+// PushCache stores the CachePath in the cache store, call it after
+// CollectCache
+func (p *Runner) PushCache() error {
+	if p.cacheStore == nil {
+		return nil
+	}
+	tarball := p.options.WorkingPath("cache.tar.gz")
+	defer os.Remove(tarball)
+	f, err := os.Create(tarball)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	err = util.TarPath(gz, p.options.CachePath())
+	if err == nil {
+		err = gz.Close()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return p.pushCacheFile(tarball, core.RemoteCacheKey(p.options, "cache.tar.gz"))
+}
+
+func (p *Runner) pushCacheFile(tarball, key string) error {
+	err := p.cacheStore.Push(tarball, key)
+	if err == core.ErrStoreTooLarge {
+		p.logger.Warnln("Not pushing", key, "it is larger than the cache-max-size")
+		return nil
+	}
+	return err
+}
+
+// pullKeyedCache gets the tarball for key from the cache store when it's
+// not in the local store yet. Without one for key it pulls the newest
+// tarball in the cache store for the first restore key that has any, so
+// the fallbacks work on a machine that has no caches of its own.
+func (p *Runner) pullKeyedCache(store *core.KeyedCacheStore, key string, restoreKeys []string) error {
+	if p.cacheStore == nil {
+		return nil
+	}
+	if _, err := os.Stat(store.Path(key)); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(p.options.WorkingPath("caches"), 0755)
+	if err != nil {
+		return err
+	}
+
+	prefix := core.RemoteCacheKey(p.options, "keyed/")
+	found, err := p.pullKeyedTarball(store, prefix+key+".tar", key)
+	if err != nil || found {
+		return err
+	}
+
+	for _, restoreKey := range restoreKeys {
+		remote, err := p.cacheStore.Newest(prefix + core.SafeCacheKey(restoreKey))
+		if err != nil {
+			return err
+		}
+		if remote == "" {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(remote, prefix), ".tar")
+		if _, err := os.Stat(store.Path(name)); err == nil {
+			return nil
+		}
+		_, err = p.pullKeyedTarball(store, remote, name)
+		return err
+	}
+	return nil
+}
+
+// pullKeyedTarball pulls remote into the local store under name
+func (p *Runner) pullKeyedTarball(store *core.KeyedCacheStore, remote, name string) (bool, error) {
+	found, err := p.cacheStore.Pull(remote, store.Path(name))
+	if err == core.ErrStoreTooLarge {
+		p.logger.Warnln("Not pulling cache", name, "it is larger than the cache-max-size")
+		return false, nil
+	}
+	return found, err
+}
+
 // GetPipeline returns a pipeline based on the "build" config section
 func (p *Runner) GetPipeline(rawConfig *core.Config) (core.Pipeline, error) {
 	return p.getPipeline(rawConfig, p.options, p.dockerOptions)
@@ -407,6 +770,9 @@ type RunnerShared struct {
 	config      *core.Config
 	sessionCtx  context.Context
 	containerID string
+	// result is only set while running after-steps
+	result *core.PipelineResult
+	caches []*core.KeyedCache
 }
 
 // StartStep emits BuildStepStarted and returns a Finisher for the end event.
@@ -424,7 +790,10 @@ func (p *Runner) StartStep(ctx *RunnerShared, step core.Step, order int) *util.F
 		}
 		p.emitter.Emit(core.BuildStepFinished, &core.BuildStepFinishedArgs{
 			Box:                 ctx.box,
+			Step:                step,
+			Order:               order,
 			Successful:          r.Success,
+			Skipped:             r.Skipped,
 			Message:             r.Message,
 			ArtifactURL:         artifactURL,
 			PackageURL:          r.PackageURL,
@@ -515,9 +884,46 @@ func (p *Runner) SetupEnvironment(runnerCtx context.Context) (*RunnerShared, err
 	pipeline.InitEnv(p.options.HostEnv)
 	shared.pipeline = pipeline
 
+	// Start setting up the pipeline dir, boxes built from a Dockerfile
+	// need the source
+	p.logger.Debugln("Copying source to build directory")
+	err = p.CopySource()
+	if err != nil {
+		sr.Message = err.Error()
+		return shared, err
+	}
+
+	// ... and the cache dir, from the cache store if we don't have one
+	p.logger.Debugln("Copying cache to build directory")
+	err = p.PullCache()
+	if err != nil {
+		p.logger.WithField("Error", err).Warnln("Unable to pull cache from the cache store")
+	}
+	err = p.CopyCache()
+	if err != nil {
+		sr.Message = err.Error()
+		return shared, err
+	}
+
+	// ... and pick the keyed caches
+	shared.caches, err = p.RestoreCaches(pipeline)
+	if err != nil {
+		sr.Message = err.Error()
+		return shared, err
+	}
+
 	// Fetch the box
 	timer.Reset()
 	box := pipeline.Box()
+	if p.options.Runtime == "local" {
+		// The secrets would end up in the /run/secrets of the host
+		if len(pipeline.Secrets()) > 0 {
+			err = fmt.Errorf("Secrets are not supported by the local runtime")
+			sr.Message = err.Error()
+			return shared, err
+		}
+		box = local.NewLocalBox(p.options)
+	}
 	_, err = box.Fetch(runnerCtx, pipeline.Env())
 	if err != nil {
 		sr.Message = err.Error()
@@ -536,22 +942,6 @@ func (p *Runner) SetupEnvironment(runnerCtx context.Context) (*RunnerShared, err
 		return shared, err
 	}
 
-	// Start setting up the pipeline dir
-	p.logger.Debugln("Copying source to build directory")
-	err = p.CopySource()
-	if err != nil {
-		sr.Message = err.Error()
-		return shared, err
-	}
-
-	// ... and the cache dir
-	p.logger.Debugln("Copying cache to build directory")
-	err = p.CopyCache()
-	if err != nil {
-		sr.Message = err.Error()
-		return shared, err
-	}
-
 	pipeline.LocalSymlink()
 
 	p.logger.Debugln("Steps:", len(pipeline.Steps()))
@@ -647,6 +1037,7 @@ func (p *Runner) SetupEnvironment(runnerCtx context.Context) (*RunnerShared, err
 // StepResult holds the info we need to report on steps
 type StepResult struct {
 	Success             bool
+	Skipped             bool
 	Artifact            *core.Artifact
 	PackageURL          string
 	Message             string
@@ -656,6 +1047,162 @@ type StepResult struct {
 
 // RunStep runs a step and tosses error if it fails
 func (p *Runner) RunStep(shared *RunnerShared, step core.Step, order int) (*StepResult, error) {
+	return p.runStep(shared, step, order, func() error {
+		if step.ShouldSyncEnv() {
+			err := shared.pipeline.SyncEnvironment(shared.sessionCtx, shared.sess)
+			if err != nil {
+				// If an error occured, just log and ignore it
+				p.logger.WithField("Error", err).Warn("Unable to sync environment")
+			}
+		}
+		return nil
+	})
+}
+
+// RunParallelStep runs the children of a parallel group at the same time,
+// each in a new session in the box container. Every child is reported as a
+// step with its own order, the group fails if any of them fail.
+func (p *Runner) RunParallelStep(shared *RunnerShared, group *core.ParallelStep, counter *util.Counter) (*StepResult, error) {
+	// Syncing writes to the pipeline environment so we do it once up front,
+	// the children only read from it
+	if group.ShouldSyncEnv() {
+		err := shared.pipeline.SyncEnvironment(shared.sessionCtx, shared.sess)
+		if err != nil {
+			p.logger.WithField("Error", err).Warn("Unable to sync environment")
+		}
+	}
+
+	steps := group.Steps()
+	results := make([]*StepResult, len(steps))
+	errs := make([]error, len(steps))
+
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step core.Step, order int) {
+			defer wg.Done()
+			results[i], errs[i] = p.runParallelChild(shared, step, order)
+		}(i, step, counter.Increment())
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			sr := results[i]
+			sr.Message = fmt.Sprintf("%s: %s", steps[i].DisplayName(), sr.Message)
+			return sr, err
+		}
+	}
+	return &StepResult{Success: true, ExitCode: 0}, nil
+}
+
+// runParallelChild sets up a session of its own for a step in a parallel
+// group and runs the step in it.
+func (p *Runner) runParallelChild(shared *RunnerShared, step core.Step, order int) (*StepResult, error) {
+	child := *shared
+	sr, err := p.runStep(&child, step, order, func() error {
+		sessionCtx, sess, err := p.GetExecSession(shared.sessionCtx, shared.containerID)
+		if err != nil {
+			return err
+		}
+		sess.Scope(step, order)
+		child.sess = sess
+		child.sessionCtx = sessionCtx
+
+		// A new session starts with a clean shell
+		err = shared.pipeline.ExportEnvironment(sessionCtx, sess)
+		if err != nil {
+			return err
+		}
+		if shared.result != nil {
+			return shared.result.ExportEnvironment(sessionCtx, sess)
+		}
+		return nil
+	})
+	// Let the shell we started exit
+	if child.sess != shared.sess {
+		child.sess.Send(child.sessionCtx, true, "exit")
+	}
+	return sr, err
+}
+
+// shouldRun evaluates the when expression of the step against the pipeline
+// environment and the git information.
+func (p *Runner) shouldRun(shared *RunnerShared, step core.Step) (bool, error) {
+	when, err := core.ParseWhen(step.When())
+	if err != nil {
+		return false, err
+	}
+	result := "passed"
+	if shared.result != nil && !shared.result.Success {
+		result = "failed"
+	}
+	return when.Evaluate(&core.WhenContext{
+		Env:    shared.pipeline.Env(),
+		Git:    p.options.GitOptions,
+		Result: result,
+	})
+}
+
+// stepTimeout converts the minutes from a step config to milliseconds, using
+// the same maximum as the config
+func stepTimeout(minutes int) int {
+	if minutes <= 0 {
+		return 0
+	}
+	return util.MinInt(minutes, 60) * 60 * 1000
+}
+
+// executeStep executes the step, and tries it again for as long as its retry
+// policy allows. Only failures with an exit code are retried, after a timeout
+// the shell may still be busy. When the step can be retried every attempt
+// gets its own section in the logs.
+func (p *Runner) executeStep(shared *RunnerShared, step core.Step, order int) (int, error) {
+	retry := step.Retry()
+	if retry == nil || retry.Attempts <= 1 {
+		return step.Execute(shared.sessionCtx, shared.sess)
+	}
+	for attempt := 1; ; attempt++ {
+		name := fmt.Sprintf("%s (%d of %d)", step.DisplayName(), attempt, retry.Attempts)
+		timer := util.NewTimer()
+		p.logSection(step, order, p.formatter.Info("Running attempt", name))
+
+		exit, err := step.Execute(shared.sessionCtx, shared.sess)
+		if exit == 0 && err == nil {
+			p.logSection(step, order, p.formatter.Success("Attempt passed", name, timer.String()))
+			return exit, err
+		}
+		p.logSection(step, order, p.formatter.Fail("Attempt failed", name, timer.String()))
+		if exit <= 0 || !retry.ShouldRetry(attempt, exit) {
+			return exit, err
+		}
+
+		p.emitter.Emit(core.Logs, &core.LogsArgs{
+			Step:   step,
+			Order:  order,
+			Stream: "stderr",
+			Logs:   fmt.Sprintf("Exit code %d, retrying in %d seconds\n", exit, retry.Delay),
+		})
+		select {
+		case <-shared.sessionCtx.Done():
+			return exit, err
+		case <-time.After(time.Duration(retry.Delay) * time.Second):
+		}
+	}
+}
+
+// logSection writes a section header to the logs of the step
+func (p *Runner) logSection(step core.Step, order int, header string) {
+	p.emitter.Emit(core.Logs, &core.LogsArgs{
+		Step:  step,
+		Order: order,
+		Logs:  "\n" + header + "\n",
+	})
+}
+
+// runStep does the actual work for RunStep, prepare is called right after
+// the step has been started.
+func (p *Runner) runStep(shared *RunnerShared, step core.Step, order int, prepare func() error) (*StepResult, error) {
 	finisher := p.StartStep(shared, step, order)
 	sr := &StepResult{
 		Success:  false,
@@ -665,12 +1212,25 @@ func (p *Runner) RunStep(shared *RunnerShared, step core.Step, order int) (*Step
 	}
 	defer finisher.Finish(sr)
 
-	if step.ShouldSyncEnv() {
-		err := shared.pipeline.SyncEnvironment(shared.sessionCtx, shared.sess)
+	if step.When() != "" {
+		run, err := p.shouldRun(shared, step)
 		if err != nil {
-			// If an error occured, just log and ignore it
-			p.logger.WithField("Error", err).Warn("Unable to sync environment")
+			sr.Message = err.Error()
+			return sr, err
 		}
+		if !run {
+			sr.Success = true
+			sr.Skipped = true
+			sr.ExitCode = 0
+			// The handlers report the message of skipped steps
+			sr.Message = fmt.Sprintf("Skipped, when: %s", step.When())
+			return sr, nil
+		}
+	}
+
+	if err := prepare(); err != nil {
+		sr.Message = err.Error()
+		return sr, err
 	}
 
 	step.InitEnv(shared.pipeline.Env())
@@ -679,7 +1239,11 @@ func (p *Runner) RunStep(shared *RunnerShared, step core.Step, order int) (*Step
 		p.logger.Debugln(" ", pair[0], pair[1])
 	}
 
-	exit, err := step.Execute(shared.sessionCtx, shared.sess)
+	// Steps can override the timeouts from the config
+	shared.sess.SetTimeouts(stepTimeout(step.Timeout()), stepTimeout(step.NoResponseTimeout()))
+	defer shared.sess.SetTimeouts(0, 0)
+
+	exit, err := p.executeStep(shared, step, order)
 	if exit != 0 {
 		sr.ExitCode = exit
 		if p.options.AttachOnError {
@@ -696,7 +1260,7 @@ func (p *Runner) RunStep(shared *RunnerShared, step core.Step, order int) (*Step
 
 	// Grab the message
 	var message bytes.Buffer
-	messageErr := step.CollectFile(shared.containerID, step.ReportPath(), "message.txt", &message)
+	messageErr := p.CollectFile(shared, step, step.ReportPath(), "message.txt", &message)
 	if messageErr != nil {
 		if messageErr != util.ErrEmptyTarball {
 			return sr, messageErr
@@ -719,7 +1283,7 @@ func (p *Runner) RunStep(shared *RunnerShared, step core.Step, order int) (*Step
 			return sr, err
 		}
 
-		if artifact != nil && p.options.ShouldStoreS3 {
+		if artifact != nil && p.options.ShouldUploadArtifacts() {
 			artificer := dockerlocal.NewArtificer(p.options, p.dockerOptions)
 			err = artificer.Upload(artifact)
 			if err != nil {
@@ -0,0 +1,77 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/docker"
+	"github.com/wercker/wercker/util"
+)
+
+type RunnerSuite struct {
+	*util.TestSuite
+}
+
+func TestRunnerSuite(t *testing.T) {
+	suiteTester := &RunnerSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// envPipeline is a Pipeline that only has an env, enough to evaluate when
+// expressions against
+type envPipeline struct {
+	core.Pipeline
+	env *util.Environment
+}
+
+func (p *envPipeline) Env() *util.Environment {
+	return p.env
+}
+
+func (s *RunnerSuite) TestRunStepSkipsDockerPushWhenFalse() {
+	options := &core.PipelineOptions{
+		GlobalOptions: &core.GlobalOptions{},
+		GitOptions:    &core.GitOptions{GitBranch: "feature"},
+	}
+	stepConfig := &core.StepConfig{
+		ID:   "internal/docker-push",
+		When: `branch == "master"`,
+		Data: map[string]string{"repository": "wercker/test"},
+	}
+	step, err := dockerlocal.NewDockerPushStep(stepConfig, options, &dockerlocal.DockerOptions{})
+	s.Require().Nil(err)
+	s.Equal(`branch == "master"`, step.When())
+
+	runner := &Runner{
+		options: options,
+		emitter: core.NewNormalizedEmitter(),
+		logger:  util.RootLogger().WithField("Logger", "Test"),
+	}
+	shared := &RunnerShared{pipeline: &envPipeline{env: util.NewEnvironment()}}
+
+	prepared := false
+	sr, err := runner.runStep(shared, step, 3, func() error {
+		prepared = true
+		return nil
+	})
+	s.Nil(err)
+	s.True(sr.Skipped)
+	s.True(sr.Success)
+	s.Equal(0, sr.ExitCode)
+	s.False(prepared, "the push should not have been prepared")
+}
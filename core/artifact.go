@@ -17,13 +17,15 @@ package core
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/wercker/wercker/util"
 )
 
 // Artifact holds the information required to extract a folder
-// from a container and eventually upload it to S3.
+// from a container and eventually upload it to the artifact store.
 type Artifact struct {
 	ContainerID   string
 	GuestPath     string
@@ -34,13 +36,19 @@ type Artifact struct {
 	DeployID      string
 	BuildStepID   string
 	Bucket        string
+	BaseURL       string
 	Key           string
 	ContentType   string
 	Meta          map[string]*string
+	Include       []string
+	Exclude       []string
 }
 
-// URL returns the artifact's S3 url
+// URL returns the artifact's url in the store, S3 unless BaseURL is set
 func (art *Artifact) URL() string {
+	if art.BaseURL != "" {
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(art.BaseURL, "/"), art.RemotePath())
+	}
 	return fmt.Sprintf("https://s3.amazonaws.com/%s/%s", art.Bucket, art.RemotePath())
 }
 
@@ -62,6 +70,16 @@ func (art *Artifact) RemotePath() string {
 	return path
 }
 
+// ManifestPath returns the path of the manifest.json next to the tarball
+func (art *Artifact) ManifestPath() string {
+	return filepath.Join(filepath.Dir(art.HostTarPath), "manifest.json")
+}
+
+// RemoteManifestPath returns the store path for the manifest.json
+func (art *Artifact) RemoteManifestPath() string {
+	return path.Join(path.Dir(art.RemotePath()), "manifest.json")
+}
+
 // Cleanup removes files from the host
 func (art *Artifact) Cleanup() error {
 	return os.Remove(art.HostPath)
@@ -0,0 +1,68 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type ArtifactSuite struct {
+	*util.TestSuite
+}
+
+func TestArtifactSuite(t *testing.T) {
+	suiteTester := &ArtifactSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *ArtifactSuite) TestURL() {
+	artifact := &Artifact{
+		HostTarPath:   "/tmp/output.tar",
+		ApplicationID: "app",
+		BuildID:       "build",
+		Bucket:        "bucket",
+	}
+	s.Equal("https://s3.amazonaws.com/bucket/project-artifacts/app/build/build/output.tar", artifact.URL())
+
+	artifact.BaseURL = "file:///srv/artifacts/"
+	s.Equal("file:///srv/artifacts/project-artifacts/app/build/build/output.tar", artifact.URL())
+}
+
+func (s *ArtifactSuite) TestLocalStoreLayout() {
+	root := filepath.Join(s.WorkingDir(), "artifacts")
+	tarball := filepath.Join(s.WorkingDir(), "output.tar")
+	err := ioutil.WriteFile(tarball, []byte("artifact"), 0644)
+	s.Require().Nil(err)
+
+	artifact := &Artifact{
+		HostTarPath:   tarball,
+		ApplicationID: "app",
+		DeployID:      "deploy",
+		BuildStepID:   "step",
+	}
+	store, err := NewStoreFromURL("file://"+root, nil)
+	s.Require().Nil(err)
+	err = store.StoreFromFile(&StoreFromFileArgs{Path: tarball, Key: artifact.RemotePath()})
+	s.Require().Nil(err)
+
+	_, err = os.Stat(filepath.Join(root, "project-artifacts", "app", "deploy", "deploy", "step", "step", "output.tar"))
+	s.Nil(err)
+}
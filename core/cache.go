@@ -0,0 +1,186 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/wercker/wercker/util"
+)
+
+// CacheConfig is a keyed cache in a pipeline:
+//   cache:
+//     - key: npm-{{ checksum "package-lock.json" }}-{{ .Branch }}
+//       restore-keys: [npm-]
+//       paths: [node_modules]
+// The key is a template, the paths are relative to the source dir.
+type CacheConfig struct {
+	Key         string   `yaml:"key"`
+	Paths       []string `yaml:"paths"`
+	RestoreKeys []string `yaml:"restore-keys"`
+}
+
+// Validate makes sure the cache has a key and sane paths
+func (c *CacheConfig) Validate() error {
+	if c.Key == "" {
+		return fmt.Errorf("A cache needs a key")
+	}
+	if _, err := template.New("key").Funcs(cacheKeyFuncs("", nil)).Parse(c.Key); err != nil {
+		return fmt.Errorf("Invalid cache key %q: %s", c.Key, err)
+	}
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("Cache %s has no paths", c.Key)
+	}
+	for _, p := range c.Paths {
+		clean := filepath.Clean(p)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("Cache path %s should be relative to the source dir", p)
+		}
+	}
+	return nil
+}
+
+// CacheKeyData is what the key templates can refer to, next to the
+// checksum and env functions
+type CacheKeyData struct {
+	Branch   string
+	Commit   string
+	Pipeline string
+}
+
+// cacheKeyFuncs are the functions for key templates, checksum hashes files
+// relative to root
+func cacheKeyFuncs(root string, env *util.Environment) template.FuncMap {
+	return template.FuncMap{
+		"checksum": func(names ...string) (string, error) {
+			h := sha256.New()
+			for _, name := range names {
+				f, err := os.Open(filepath.Join(root, name))
+				if err != nil {
+					return "", err
+				}
+				_, err = io.Copy(h, f)
+				f.Close()
+				if err != nil {
+					return "", err
+				}
+			}
+			return fmt.Sprintf("%x", h.Sum(nil)), nil
+		},
+		"env": func(name string) string {
+			if env == nil {
+				return ""
+			}
+			return env.Get(name)
+		},
+	}
+}
+
+var unsafeCacheKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SafeCacheKey replaces the characters of key that are not safe in a file
+// name
+func SafeCacheKey(key string) string {
+	return unsafeCacheKeyChars.ReplaceAllString(key, "_")
+}
+
+// RenderCacheKey fills in the key template, the result is safe to use as a
+// file name
+func RenderCacheKey(key, root string, env *util.Environment, data *CacheKeyData) (string, error) {
+	tmpl, err := template.New("key").Funcs(cacheKeyFuncs(root, env)).Parse(key)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		return "", err
+	}
+	return SafeCacheKey(b.String()), nil
+}
+
+// KeyedCache is a cache of the pipeline with its key filled in
+type KeyedCache struct {
+	Config *CacheConfig
+	Key    string
+	// Restored is the key of the tarball we restored, if any
+	Restored string
+}
+
+// Hit tells us the cache was restored with the exact key, so there is no
+// need to save it again
+func (c *KeyedCache) Hit() bool {
+	return c.Restored == c.Key
+}
+
+// KeyedCacheStore keeps a tarball per cache key in a directory
+type KeyedCacheStore struct {
+	root string
+}
+
+// NewKeyedCacheStore constructor
+func NewKeyedCacheStore(root string) *KeyedCacheStore {
+	return &KeyedCacheStore{root: root}
+}
+
+// Path is where the tarball for a key lives
+func (s *KeyedCacheStore) Path(key string) string {
+	return filepath.Join(s.root, key+".tar")
+}
+
+// Find looks for the tarball of the key, falling back to the most recent
+// tarball that starts with one of the restore keys, in order. It returns
+// the key that was found or "" if there was nothing.
+func (s *KeyedCacheStore) Find(key string, restoreKeys []string) (string, error) {
+	if _, err := os.Stat(s.Path(key)); err == nil {
+		return key, nil
+	}
+
+	infos, err := ioutil.ReadDir(s.root)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	for _, prefix := range restoreKeys {
+		prefix = SafeCacheKey(prefix)
+		found := ""
+		var newest os.FileInfo
+		for _, info := range infos {
+			name := strings.TrimSuffix(info.Name(), ".tar")
+			if name == info.Name() || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if newest == nil || info.ModTime().After(newest.ModTime()) {
+				newest = info
+				found = name
+			}
+		}
+		if found != "" {
+			return found, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,88 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type CacheSuite struct {
+	*util.TestSuite
+}
+
+func TestCacheSuite(t *testing.T) {
+	suiteTester := &CacheSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *CacheSuite) TestRenderCacheKey() {
+	root := s.WorkingDir()
+	err := ioutil.WriteFile(filepath.Join(root, "package-lock.json"), []byte("{}"), 0644)
+	s.Require().Nil(err)
+
+	env := util.NewEnvironment("NODE_VERSION=6")
+	data := &CacheKeyData{Branch: "feature/cache"}
+
+	key, err := RenderCacheKey(`npm-{{ env "NODE_VERSION" }}-{{ .Branch }}-{{ checksum "package-lock.json" }}`, root, env, data)
+	s.Require().Nil(err)
+	s.Equal("npm-6-feature_cache-44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", key)
+
+	_, err = RenderCacheKey(`npm-{{ checksum "missing.json" }}`, root, env, data)
+	s.NotNil(err)
+}
+
+func (s *CacheSuite) TestStoreFind() {
+	root := s.WorkingDir()
+	store := NewKeyedCacheStore(root)
+
+	found, err := store.Find("npm-master-abc", []string{"npm-master-", "npm-"})
+	s.Nil(err)
+	s.Equal("", found)
+
+	for i, key := range []string{"npm-feature-aaa", "npm-feature-bbb", "npm-master-abc"} {
+		path := store.Path(key)
+		s.Require().Nil(ioutil.WriteFile(path, []byte{}, 0644))
+		mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		s.Require().Nil(os.Chtimes(path, mtime, mtime))
+	}
+
+	found, err = store.Find("npm-master-abc", []string{"npm-"})
+	s.Nil(err)
+	s.Equal("npm-master-abc", found)
+
+	found, err = store.Find("npm-feature-ccc", []string{"npm-feature-", "npm-"})
+	s.Nil(err)
+	s.Equal("npm-feature-bbb", found)
+
+	found, err = store.Find("yarn-abc", []string{"yarn-"})
+	s.Nil(err)
+	s.Equal("", found)
+}
+
+func (s *CacheSuite) TestCacheConfigValidate() {
+	s.Nil((&CacheConfig{Key: "npm", Paths: []string{"node_modules"}}).Validate())
+	s.NotNil((&CacheConfig{Paths: []string{"node_modules"}}).Validate())
+	s.NotNil((&CacheConfig{Key: "npm"}).Validate())
+	s.NotNil((&CacheConfig{Key: "npm", Paths: []string{"/root/.npm"}}).Validate())
+	s.NotNil((&CacheConfig{Key: "npm", Paths: []string{"../other"}}).Validate())
+	s.NotNil((&CacheConfig{Key: "npm-{{ .Branch", Paths: []string{"node_modules"}}).Validate())
+}
@@ -0,0 +1,174 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wercker/wercker/util"
+)
+
+// RemoteCacheKey returns the key of a project cache in the cache store
+func RemoteCacheKey(options *PipelineOptions, name string) string {
+	return fmt.Sprintf("project-cache/%s/%s", options.ApplicationID, name)
+}
+
+// RemoteCache pushes cache tarballs to a Store and pulls them back. Every
+// tarball gets a sha256 sidecar that is checked when it is pulled.
+type RemoteCache struct {
+	store   Store
+	maxSize int64
+	logger  *util.LogEntry
+}
+
+// NewRemoteCache constructor, maxSize of 0 means no limit
+func NewRemoteCache(store Store, maxSize int64) *RemoteCache {
+	return &RemoteCache{
+		store:   store,
+		maxSize: maxSize,
+		logger:  util.RootLogger().WithField("Logger", "RemoteCache"),
+	}
+}
+
+// Push stores the tarball at path under key, it returns ErrStoreTooLarge
+// without storing anything if the tarball exceeds the maximum size.
+func (c *RemoteCache) Push(path, key string) error {
+	sum, size, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if c.maxSize > 0 && size > c.maxSize {
+		return ErrStoreTooLarge
+	}
+
+	err = c.store.StoreFromFile(&StoreFromFileArgs{
+		Path:        path,
+		Key:         key,
+		ContentType: "application/x-tar",
+		MaxTries:    3,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The sidecar goes last so a pull never finds a checksum without the
+	// tarball it belongs to
+	sumFile, err := ioutil.TempFile("", "wercker-cache-sum")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sumFile.Name())
+	_, err = sumFile.WriteString(sum)
+	sumFile.Close()
+	if err != nil {
+		return err
+	}
+	return c.store.StoreFromFile(&StoreFromFileArgs{
+		Path:        sumFile.Name(),
+		Key:         key + ".sha256",
+		ContentType: "text/plain",
+		MaxTries:    3,
+	})
+}
+
+// Pull downloads the tarball stored under key to path, it returns false if
+// the store has no such cache.
+func (c *RemoteCache) Pull(key, path string) (bool, error) {
+	exists, err := c.store.Exists(key + ".sha256")
+	if err != nil || !exists {
+		return false, err
+	}
+
+	sumPath := path + ".sha256"
+	defer os.Remove(sumPath)
+	err = c.store.DownloadToFile(&DownloadToFileArgs{
+		Key:      key + ".sha256",
+		Path:     sumPath,
+		MaxSize:  1024,
+		MaxTries: 3,
+	})
+	if err != nil {
+		return false, err
+	}
+	expected, err := ioutil.ReadFile(sumPath)
+	if err != nil {
+		return false, err
+	}
+
+	tmp := path + ".tmp"
+	err = c.store.DownloadToFile(&DownloadToFileArgs{
+		Key:      key,
+		Path:     tmp,
+		MaxSize:  c.maxSize,
+		MaxTries: 3,
+	})
+	if err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	sum, _, err := fileChecksum(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	if sum != strings.TrimSpace(string(expected)) {
+		os.Remove(tmp)
+		return false, fmt.Errorf("Checksum mismatch for cache %s", key)
+	}
+	return true, os.Rename(tmp, path)
+}
+
+// Newest returns the key of the most recently pushed tarball whose key
+// starts with prefix, or "" if there is none.
+func (c *RemoteCache) Newest(prefix string) (string, error) {
+	objects, err := c.store.List(prefix)
+	if err != nil {
+		return "", err
+	}
+	newest := ""
+	var newestTime time.Time
+	for _, object := range objects {
+		// The sidecar goes last, so only tarballs that have one are complete
+		if !strings.HasSuffix(object.Key, ".sha256") {
+			continue
+		}
+		if newest == "" || object.LastModified.After(newestTime) {
+			newest = strings.TrimSuffix(object.Key, ".sha256")
+			newestTime = object.LastModified
+		}
+	}
+	return newest, nil
+}
+
+// fileChecksum returns the hex sha256 and the size of a file
+func fileChecksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), size, nil
+}
@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
 	"gopkg.in/yaml.v2"
 
 	"github.com/wercker/wercker/util"
@@ -45,6 +46,117 @@ type BoxConfig struct {
 	Entrypoint string
 	URL        string
 	Volumes    string
+	// Healthcheck and Logs are only used for services, Logs is "true" to
+	// stream the output of the service, "on-failure" (the default) to show
+	// the tail of it when a step fails or "false"
+	Healthcheck *HealthcheckConfig
+	Logs        string
+	// Resource limits and runtime options of the container, sizes are
+	// strings like "512m" and ulimits look like "nofile=1024:2048"
+	Memory     string   `yaml:"memory"`
+	CPUShares  int64    `yaml:"cpu-shares"`
+	CPUQuota   int64    `yaml:"cpu-quota"`
+	ShmSize    string   `yaml:"shm-size"`
+	Ulimits    []string `yaml:"ulimits"`
+	User       string   `yaml:"user"`
+	Privileged bool     `yaml:"privileged"`
+	CapAdd     []string `yaml:"cap-add"`
+	CapDrop    []string `yaml:"cap-drop"`
+	Tmpfs      []string `yaml:"tmpfs"`
+	// Build the box from a Dockerfile instead of pulling it, paths are
+	// relative to the project and the context defaults to the project root
+	Dockerfile string            `yaml:"dockerfile"`
+	Context    string            `yaml:"context"`
+	BuildArgs  map[string]string `yaml:"build-args"`
+}
+
+// Validate checks the service and container options
+func (c *BoxConfig) Validate() error {
+	switch c.Logs {
+	case "", "true", "false", "on-failure":
+	default:
+		return fmt.Errorf("Invalid logs option %q, use true, false or on-failure", c.Logs)
+	}
+	for _, size := range []string{c.Memory, c.ShmSize} {
+		if size == "" {
+			continue
+		}
+		if _, err := units.RAMInBytes(size); err != nil {
+			return err
+		}
+	}
+	if c.CPUShares < 0 || c.CPUQuota < 0 {
+		return fmt.Errorf("cpu-shares and cpu-quota can not be negative")
+	}
+	for _, ulimit := range c.Ulimits {
+		if _, err := units.ParseUlimit(ulimit); err != nil {
+			return err
+		}
+	}
+	for _, tmpfs := range c.Tmpfs {
+		if !strings.HasPrefix(tmpfs, "/") {
+			return fmt.Errorf("Invalid tmpfs %q, it should start with an absolute path", tmpfs)
+		}
+	}
+	if c.Dockerfile != "" && c.ID != "" {
+		return fmt.Errorf("A box can have an id or a dockerfile, not both")
+	}
+	if c.Dockerfile == "" && (c.Context != "" || len(c.BuildArgs) > 0) {
+		return fmt.Errorf("context and build-args can only be used with a dockerfile")
+	}
+	if c.Healthcheck != nil {
+		return c.Healthcheck.Validate()
+	}
+	return nil
+}
+
+// HealthcheckConfig describes how to tell that a service is ready, exactly
+// one of the probes should be set:
+//   healthcheck:
+//     tcp: 5432           # port accepts connections
+//     http: 8080/health   # GET returns a 2xx or 3xx
+//     cmd: pg_isready     # exits 0 inside the service
+//     timeout: 60         # seconds, default 60
+//     interval: 1         # seconds, default 1
+type HealthcheckConfig struct {
+	TCP      string `yaml:"tcp"`
+	HTTP     string `yaml:"http"`
+	Cmd      string `yaml:"cmd"`
+	Timeout  int    `yaml:"timeout"`
+	Interval int    `yaml:"interval"`
+}
+
+// Validate makes sure there is a single probe and sane durations
+func (c *HealthcheckConfig) Validate() error {
+	probes := 0
+	for _, probe := range []string{c.TCP, c.HTTP, c.Cmd} {
+		if probe != "" {
+			probes++
+		}
+	}
+	if probes != 1 {
+		return fmt.Errorf("healthcheck needs exactly one of tcp, http or cmd")
+	}
+	if c.Timeout < 0 || c.Interval < 0 {
+		return fmt.Errorf("healthcheck timeout and interval can not be negative")
+	}
+	return nil
+}
+
+// TimeoutOrDefault returns the timeout in seconds
+func (c *HealthcheckConfig) TimeoutOrDefault() int {
+	if c.Timeout == 0 {
+		return 60
+	}
+	return c.Timeout
+}
+
+// IntervalOrDefault returns the interval in seconds
+func (c *HealthcheckConfig) IntervalOrDefault() int {
+	if c.Interval == 0 {
+		return 1
+	}
+	return c.Interval
 }
 
 // IsExternal tells us if the box (service) is located on disk
@@ -60,6 +172,9 @@ func (r *RawBoxConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err != nil {
 		err = unmarshal(&r.BoxConfig)
 	}
+	if err == nil {
+		err = r.BoxConfig.Validate()
+	}
 	return err
 }
 
@@ -75,6 +190,62 @@ type StepConfig struct {
 	Name       string
 	Data       map[string]string
 	Checkpoint string
+	When       string
+	Parallel   RawStepsConfig
+	// Timeouts in minutes, these override the ones for the whole config
+	Timeout           int
+	NoResponseTimeout int
+	Retry             *RetryConfig
+}
+
+// RetryConfig is the retry policy of a step, it can be written as just the
+// number of attempts or as the full map:
+//   retry:
+//     attempts: 3
+//     delay: 10          # seconds
+//     on-exit-codes: [1]
+type RetryConfig struct {
+	Attempts    int   `yaml:"attempts"`
+	Delay       int   `yaml:"delay"`
+	OnExitCodes []int `yaml:"on-exit-codes"`
+}
+
+// ShouldRetry tells us whether a step that exited with exit after the given
+// attempt should be tried again
+func (c *RetryConfig) ShouldRetry(attempt, exit int) bool {
+	if c == nil || attempt >= c.Attempts {
+		return false
+	}
+	if len(c.OnExitCodes) == 0 {
+		return true
+	}
+	for _, code := range c.OnExitCodes {
+		if code == exit {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryConfig uses the marshal/unmarshal hack to parse the retry
+// section, which does not fit in the step data
+func parseRetryConfig(value interface{}) (*RetryConfig, error) {
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	retry := &RetryConfig{}
+	err = yaml.Unmarshal(b, &retry.Attempts)
+	if err != nil {
+		err = yaml.Unmarshal(b, retry)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid retry, expected the number of attempts or a map")
+	}
+	if retry.Attempts < 1 {
+		return nil, fmt.Errorf("Invalid retry, attempts should be at least 1")
+	}
+	return retry, nil
 }
 
 // ifaceToString takes a value from yaml and makes it a string (currently
@@ -108,6 +279,19 @@ func ifaceToString(dataValue interface{}) string {
 //        code: done right
 //    - script:      # this parses as a map[string]string
 //      code: done wrong
+// The timeouts and retry policy of the step itself go next to its id, so
+// they don't take the properties of the step that have the same name:
+//    - script:
+//        code: make
+//      timeout: 10
+//      no-response-timeout: 2
+//      retry: 3
+// Additionally a step can be a parallel group, a one-key map with a list of
+// steps that will be run at the same time:
+//    - parallel:
+//      - lint
+//      - script:
+//          code: go test ./...
 func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	r.StepConfig = &StepConfig{}
 
@@ -117,11 +301,39 @@ func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return nil
 	}
 
+	// Then check whether we are a parallel group
+	var group map[string]RawStepsConfig
+	err = unmarshal(&group)
+	if err == nil && len(group) == 1 {
+		if children, ok := group["parallel"]; ok {
+			if len(children) == 0 {
+				return fmt.Errorf("Parallel group is empty")
+			}
+			for _, child := range children {
+				if len(child.Parallel) > 0 {
+					return fmt.Errorf("Parallel groups can not be nested")
+				}
+			}
+			r.ID = "parallel"
+			r.Data = map[string]string{}
+			r.Parallel = children
+			return nil
+		}
+	}
+
 	// Next check whether we are a one-key map
 	var stepID string
 	stepData := make(map[string]string)
+	var retryData interface{}
 	var topMap yaml.MapSlice
 	err = unmarshal(&topMap)
+	var settings yaml.MapSlice
+	if len(topMap) > 1 {
+		if _, ok := topMap[0].Value.(yaml.MapSlice); ok {
+			settings = topMap[1:]
+			topMap = topMap[:1]
+		}
+	}
 	if len(topMap) == 1 {
 		// The only item's key will be the stepID, value is data
 		item := topMap[0]
@@ -131,6 +343,10 @@ func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			return fmt.Errorf("Step %s is empty", item.Key)
 		}
 		for _, item := range interData {
+			if item.Key == "retry" {
+				retryData = item.Value
+				continue
+			}
 			stepData[item.Key] = ifaceToString(item.Value)
 		}
 	} else {
@@ -140,6 +356,10 @@ func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		firstItem := topMap[0]
 		stepID = firstItem.Key
 		for _, item := range topMap[1:] {
+			if item.Key == "retry" {
+				retryData = item.Value
+				continue
+			}
 			stepData[item.Key] = ifaceToString(item.Value)
 		}
 	}
@@ -159,6 +379,39 @@ func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		r.Checkpoint = v
 		delete(stepData, "checkpoint")
 	}
+	if v, ok := stepData["when"]; ok {
+		// Parse it now so that mistakes show up before the build starts
+		if _, err := ParseWhen(v); err != nil {
+			return err
+		}
+		r.When = v
+		delete(stepData, "when")
+	}
+	for _, item := range settings {
+		switch item.Key {
+		case "timeout", "no-response-timeout":
+			timeout, err := strconv.Atoi(ifaceToString(item.Value))
+			if err != nil || timeout < 1 {
+				return fmt.Errorf("Invalid %s for step %s, expected minutes", item.Key, stepID)
+			}
+			if item.Key == "timeout" {
+				r.Timeout = timeout
+			} else {
+				r.NoResponseTimeout = timeout
+			}
+		case "retry":
+			retryData = item.Value
+		default:
+			return fmt.Errorf("Unknown setting %s for step %s", item.Key, stepID)
+		}
+	}
+	if retryData != nil {
+		retry, err := parseRetryConfig(retryData)
+		if err != nil {
+			return err
+		}
+		r.Retry = retry
+	}
 	r.Data = stepData
 	return nil
 }
@@ -175,13 +428,43 @@ type RawPipelineConfig struct {
 // StepsMap is for compat with the multiple deploy target configs
 // TODO(termie): it would be great to deprecate this behavior and switch
 //               to multiple pipelines instead
+// Secrets names hidden env vars that are written to files under
+// SecretsMountPath instead of being exported, see BasePipeline.HiddenExport
 type PipelineConfig struct {
 	Box        *RawBoxConfig
 	Steps      RawStepsConfig
 	AfterSteps RawStepsConfig `yaml:"after-steps"`
 	StepsMap   map[string][]*RawStepConfig
-	Services   []*RawBoxConfig `yaml:"services"`
-	BasePath   string          `yaml:"base-path"`
+	Services   []*RawBoxConfig  `yaml:"services"`
+	BasePath   string           `yaml:"base-path"`
+	Cache      []*CacheConfig   `yaml:"cache"`
+	Artifacts  *ArtifactsConfig `yaml:"artifacts"`
+	Secrets    []string         `yaml:"secrets"`
+}
+
+// ArtifactsConfig picks the files of the output dir that end up in the
+// artifact:
+//   artifacts:
+//     include: [dist/**]
+//     exclude: ["**/*.map"]
+// The patterns are relative to the output dir, ** matches any number of
+// directories.
+type ArtifactsConfig struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Validate checks the patterns
+func (c *ArtifactsConfig) Validate() error {
+	for _, pattern := range append(append([]string{}, c.Include...), c.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid artifacts pattern %s: %s", pattern, err)
+		}
+		if path.IsAbs(pattern) || strings.Contains(pattern, "..") {
+			return fmt.Errorf("Invalid artifacts pattern %s, it must be relative to the output dir", pattern)
+		}
+	}
+	return nil
 }
 
 var pipelineReservedWords = map[string]struct{}{
@@ -190,6 +473,9 @@ var pipelineReservedWords = map[string]struct{}{
 	"steps":       struct{}{},
 	"after-steps": struct{}{},
 	"base-path":   struct{}{},
+	"cache":       struct{}{},
+	"artifacts":   struct{}{},
+	"secrets":     struct{}{},
 }
 
 // UnmarshalYAML in this case is a little involved due to the myriad shapes our
@@ -205,6 +491,22 @@ func (r *RawPipelineConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 		return err
 	}
 
+	for _, cache := range r.PipelineConfig.Cache {
+		if err := cache.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.PipelineConfig.Artifacts != nil {
+		if err := r.PipelineConfig.Artifacts.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, name := range r.PipelineConfig.Secrets {
+		if err := ValidateSecretName(name); err != nil {
+			return err
+		}
+	}
+
 	// Having a slash in the path will cause sources to end up in /pipeline/source/source.
 	// Remove a potential trailing slash
 	r.PipelineConfig.BasePath = strings.TrimSuffix(r.PipelineConfig.BasePath, "/")
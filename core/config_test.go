@@ -78,3 +78,302 @@ func (s *ConfigSuite) TestIfaceToString() {
 		s.Equal(test.expected, actual, "")
 	}
 }
+
+func (s *ConfigSuite) TestConfigParallelSteps() {
+	b := []byte(`
+box: ubuntu
+build:
+  steps:
+    - setup
+    - parallel:
+      - lint
+      - script:
+          name: unit tests
+          code: go test ./...
+    - done
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	steps := config.PipelinesMap["build"].Steps
+	s.Require().Equal(3, len(steps))
+	s.Equal("setup", steps[0].ID)
+	s.Equal("parallel", steps[1].ID)
+	s.Equal("done", steps[2].ID)
+
+	children := steps[1].Parallel
+	s.Require().Equal(2, len(children))
+	s.Equal("lint", children[0].ID)
+	s.Equal("script", children[1].ID)
+	s.Equal("unit tests", children[1].Name)
+	s.Equal("go test ./...", children[1].Data["code"])
+}
+
+func (s *ConfigSuite) TestConfigParallelStepsNested() {
+	b := []byte(`
+box: ubuntu
+build:
+  steps:
+    - parallel:
+      - lint
+      - parallel:
+        - test
+`)
+	_, err := ConfigFromYaml(b)
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigStepTimeoutsAndRetry() {
+	b := []byte(`
+box: ubuntu
+build:
+  steps:
+    - install-packages:
+        packages: curl
+      timeout: 10
+      no-response-timeout: 2
+      retry: 3
+    - script:
+        code: make push
+        retry:
+          attempts: 2
+          delay: 5
+          on-exit-codes: [1, 7]
+    - script:
+        code: make
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	steps := config.PipelinesMap["build"].Steps
+	s.Equal(10, steps[0].Timeout)
+	s.Equal(2, steps[0].NoResponseTimeout)
+	s.Require().NotNil(steps[0].Retry)
+	s.Equal(3, steps[0].Retry.Attempts)
+	s.Equal(map[string]string{"packages": "curl"}, steps[0].Data)
+
+	s.Require().NotNil(steps[1].Retry)
+	s.Equal(2, steps[1].Retry.Attempts)
+	s.Equal(5, steps[1].Retry.Delay)
+	s.Equal([]int{1, 7}, steps[1].Retry.OnExitCodes)
+	s.Equal("make push", steps[1].Data["code"])
+
+	s.Equal(0, steps[2].Timeout)
+	s.Nil(steps[2].Retry)
+}
+
+func (s *ConfigSuite) TestConfigStepInvalidTimeout() {
+	b := []byte(`
+box: ubuntu
+build:
+  steps:
+    - script:
+        code: make
+      timeout: soon
+`)
+	_, err := ConfigFromYaml(b)
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigStepOwnTimeout() {
+	b := []byte(`
+box: ubuntu
+build:
+  steps:
+    - wait-for-deploy:
+        timeout: 30s
+        no-response-timeout: 5m
+      timeout: 10
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	step := config.PipelinesMap["build"].Steps[0]
+	s.Equal("30s", step.Data["timeout"])
+	s.Equal("5m", step.Data["no-response-timeout"])
+	s.Equal(10, step.Timeout)
+	s.Equal(0, step.NoResponseTimeout)
+}
+
+func (s *ConfigSuite) TestConfigStepUnknownSetting() {
+	b := []byte(`
+box: ubuntu
+build:
+  steps:
+    - script:
+        code: make
+      timeuot: 10
+`)
+	_, err := ConfigFromYaml(b)
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestRetryConfigShouldRetry() {
+	var none *RetryConfig
+	s.False(none.ShouldRetry(1, 1))
+
+	any := &RetryConfig{Attempts: 2}
+	s.True(any.ShouldRetry(1, 1))
+	s.False(any.ShouldRetry(2, 1))
+
+	some := &RetryConfig{Attempts: 3, OnExitCodes: []int{7}}
+	s.True(some.ShouldRetry(1, 7))
+	s.False(some.ShouldRetry(1, 1))
+}
+
+func (s *ConfigSuite) TestConfigServiceHealthcheck() {
+	b := []byte(`
+box: ubuntu
+services:
+  - id: postgres
+    healthcheck:
+      tcp: 5432
+      timeout: 30
+  - id: web
+    logs: true
+    healthcheck:
+      http: 8080/health
+  - redis
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	s.Require().NotNil(config.Services[0].Healthcheck)
+	s.Equal("5432", config.Services[0].Healthcheck.TCP)
+	s.Equal(30, config.Services[0].Healthcheck.TimeoutOrDefault())
+	s.Equal(1, config.Services[0].Healthcheck.IntervalOrDefault())
+
+	s.Require().NotNil(config.Services[1].Healthcheck)
+	s.Equal("8080/health", config.Services[1].Healthcheck.HTTP)
+	s.Equal(60, config.Services[1].Healthcheck.TimeoutOrDefault())
+	s.Equal("true", config.Services[1].Logs)
+
+	s.Nil(config.Services[2].Healthcheck)
+}
+
+func (s *ConfigSuite) TestConfigServiceHealthcheckInvalid() {
+	b := []byte(`
+box: ubuntu
+services:
+  - id: postgres
+    healthcheck:
+      tcp: 5432
+      cmd: pg_isready
+`)
+	_, err := ConfigFromYaml(b)
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigServiceLogsInvalid() {
+	b := []byte(`
+box: ubuntu
+services:
+  - id: redis
+    logs: always
+`)
+	_, err := ConfigFromYaml(b)
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigBoxResources() {
+	b := []byte(`
+box:
+  id: openjdk
+  memory: 2g
+  cpu-shares: 512
+  shm-size: 256m
+  ulimits:
+    - nofile=1024:2048
+  user: build
+  cap-drop: [NET_RAW]
+  tmpfs:
+    - /run:size=64m
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+	s.Equal("2g", config.Box.Memory)
+	s.Equal(int64(512), config.Box.CPUShares)
+	s.Equal("256m", config.Box.ShmSize)
+	s.Equal([]string{"nofile=1024:2048"}, config.Box.Ulimits)
+	s.Equal("build", config.Box.User)
+	s.Equal([]string{"NET_RAW"}, config.Box.CapDrop)
+	s.Equal([]string{"/run:size=64m"}, config.Box.Tmpfs)
+
+	_, err = ConfigFromYaml([]byte("box:\n  id: openjdk\n  memory: lots\n"))
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigPipelineCache() {
+	b := []byte(`
+box: node
+build:
+  cache:
+    - key: npm-{{ checksum "package-lock.json" }}
+      restore-keys: [npm-]
+      paths: [node_modules]
+  steps:
+    - npm-install
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	pipeline := config.PipelinesMap["build"]
+	s.Require().Equal(1, len(pipeline.Cache))
+	s.Equal(`npm-{{ checksum "package-lock.json" }}`, pipeline.Cache[0].Key)
+	s.Equal([]string{"npm-"}, pipeline.Cache[0].RestoreKeys)
+	s.Equal([]string{"node_modules"}, pipeline.Cache[0].Paths)
+	s.Equal(0, len(pipeline.StepsMap))
+}
+
+func (s *ConfigSuite) TestConfigPipelineArtifacts() {
+	b := []byte(`
+box: node
+build:
+  artifacts:
+    include: [dist/**]
+    exclude: ["**/*.map"]
+  steps:
+    - npm-install
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	pipeline := config.PipelinesMap["build"]
+	s.Require().NotNil(pipeline.Artifacts)
+	s.Equal([]string{"dist/**"}, pipeline.Artifacts.Include)
+	s.Equal([]string{"**/*.map"}, pipeline.Artifacts.Exclude)
+	s.Equal(0, len(pipeline.StepsMap))
+
+	b = []byte(`
+box: node
+build:
+  artifacts:
+    include: [../secrets]
+`)
+	_, err = ConfigFromYaml(b)
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigPipelineSecrets() {
+	b := []byte(`
+box: node
+deploy:
+  secrets: [NPM_TOKEN]
+  steps:
+    - npm-publish
+`)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	pipeline := config.PipelinesMap["deploy"]
+	s.Equal([]string{"NPM_TOKEN"}, pipeline.Secrets)
+	s.Equal(0, len(pipeline.StepsMap))
+
+	b = []byte(`
+box: node
+deploy:
+  secrets: [../token]
+`)
+	_, err = ConfigFromYaml(b)
+	s.NotNil(err)
+}
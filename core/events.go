@@ -19,6 +19,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/chuckpreslar/emission"
 	"github.com/wercker/wercker/util"
@@ -98,12 +99,15 @@ type BuildStepStartedArgs struct {
 // BuildStepFinishedArgs contains the args associated with the
 // "BuildStepFinished" event.
 type BuildStepFinishedArgs struct {
-	Options     *PipelineOptions
-	Box         Box
-	Build       Pipeline
-	Order       int
-	Step        Step
-	Successful  bool
+	Options    *PipelineOptions
+	Box        Box
+	Build      Pipeline
+	Order      int
+	Step       Step
+	Successful bool
+	// Skipped steps did not run because of their when expression, they are
+	// reported as successful
+	Skipped     bool
 	Message     string
 	ArtifactURL string
 	// Only applicable to the store step
@@ -194,20 +198,108 @@ func (h *DebugHandler) ListenTo(e *NormalizedEmitter) {
 type NormalizedEmitter struct {
 	*emission.Emitter
 
+	// Steps in a parallel group emit at the same time
+	l sync.Mutex
+
 	// All these are initially unset
 	options      *PipelineOptions // Set by BuildStarted
 	build        Pipeline         // Set by BuildStepsAdded
 	currentOrder int              // Set by BuildStepStarted
 	currentStep  Step             // Set by BuildStepStarted
+
+	// Hidden env values are masked in the logs, the end of a chunk that may
+	// be the start of one is held back per step and stream
+	redactor *Redactor
+	pending  map[string]*LogsArgs
 }
 
 // NewNormalizedEmitter constructor
 func NewNormalizedEmitter() *NormalizedEmitter {
-	return &NormalizedEmitter{Emitter: emission.NewEmitter()}
+	return &NormalizedEmitter{
+		Emitter:  emission.NewEmitter(),
+		redactor: NewRedactor(),
+		pending:  map[string]*LogsArgs{},
+	}
+}
+
+// AddSecrets masks values in all the logs emitted after this
+func (e *NormalizedEmitter) AddSecrets(values ...string) {
+	e.l.Lock()
+	defer e.l.Unlock()
+	for _, value := range values {
+		e.redactor.AddSecret(value)
+	}
+}
+
+// addHiddenEnv adds the values of the hidden env of the build to the secrets
+func (e *NormalizedEmitter) addHiddenEnv() {
+	if e.build == nil {
+		return
+	}
+	env := e.build.Env()
+	if env == nil || env.Hidden == nil {
+		return
+	}
+	for _, value := range env.Hidden.Map {
+		e.redactor.AddSecret(value)
+	}
+}
+
+// logsKey identifies the stream of a step that logs are held back for
+func logsKey(a *LogsArgs) string {
+	if a.Step == nil {
+		return a.Stream
+	}
+	return a.Step.SafeID() + "/" + a.Stream
+}
+
+// redactLogs masks the secrets in the logs, false when all of it is held
+// back for now
+func (e *NormalizedEmitter) redactLogs(a *LogsArgs) bool {
+	if !e.redactor.HasSecrets() {
+		return true
+	}
+	key := logsKey(a)
+	pending := ""
+	if held, ok := e.pending[key]; ok {
+		pending = held.Logs
+	}
+
+	var rest string
+	a.Logs, rest = e.redactor.Redact(pending, a.Logs)
+	if rest == "" {
+		delete(e.pending, key)
+	} else {
+		held := *a
+		held.Logs = rest
+		e.pending[key] = &held
+	}
+	return a.Logs != ""
+}
+
+// flushLogs emits what is held back for step, or for all steps when step is
+// nil
+func (e *NormalizedEmitter) flushLogs(step Step) {
+	keys := []string{}
+	for key, held := range e.pending {
+		if step == nil || (held.Step != nil && held.Step.SafeID() == step.SafeID()) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		held := e.pending[key]
+		delete(e.pending, key)
+		held.Logs = e.redactor.Flush(held.Logs)
+		e.Emitter.Emit(Logs, held)
+	}
 }
 
 // Emit normalizes our events by storing some state
 func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
 	switch event {
 	// store the options for later
 	case BuildStarted:
@@ -221,6 +313,7 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 			a.Options = e.options
 		}
 		e.build = a.Build
+		e.addHiddenEnv()
 		e.Emitter.Emit(event, a)
 	// Store step and order, add options, build
 	case BuildStepStarted:
@@ -233,6 +326,8 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 		}
 		e.currentStep = a.Step
 		e.currentOrder = a.Order
+		// Steps may have added to the hidden env
+		e.addHiddenEnv()
 		e.Emitter.Emit(event, a)
 	// Add options, build, step, order, default stream
 	case Logs:
@@ -252,7 +347,9 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 		if a.Stream == "" {
 			a.Stream = "stdout"
 		}
-		e.Emitter.Emit(event, a)
+		if e.redactLogs(a) {
+			e.Emitter.Emit(event, a)
+		}
 	// Add options, build, step, order, reset step and order after
 	case BuildStepFinished:
 		a := args.(*BuildStepFinishedArgs)
@@ -268,6 +365,9 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 		if a.Order == 0 {
 			a.Order = e.currentOrder
 		}
+		if a.Step != nil {
+			e.flushLogs(a.Step)
+		}
 		e.Emitter.Emit(event, a)
 		e.currentStep = nil
 		e.currentOrder = -1
@@ -277,6 +377,7 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 		if a.Options == nil {
 			a.Options = e.options
 		}
+		e.flushLogs(nil)
 		e.Emitter.Emit(event, a)
 	// Just add the options
 	case FullPipelineFinished:
@@ -284,6 +385,7 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 		if a.Options == nil {
 			a.Options = e.options
 		}
+		e.flushLogs(nil)
 		e.Emitter.Emit(event, a)
 	}
 }
@@ -0,0 +1,211 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wercker/wercker/util"
+)
+
+// NewLocalStore creates a new LocalStore rooted at root
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{
+		root:   root,
+		logger: util.RootLogger().WithField("Logger", "LocalStore"),
+	}
+}
+
+// LocalStore stores files in a directory, usually one shared between hosts
+type LocalStore struct {
+	root   string
+	logger *util.LogEntry
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+// localStoreTempPrefix marks files that are still being written, List
+// skips them
+const localStoreTempPrefix = ".wercker-store-"
+
+// StoreFromFile copies the file from args.Path to root + args.Key. The file
+// is written next to its destination first so readers never see a partial
+// file.
+func (s *LocalStore) StoreFromFile(args *StoreFromFileArgs) error {
+	dst := s.path(args.Key)
+	s.logger.WithFields(util.LogFields{
+		"Path": args.Path,
+		"Dest": dst,
+	}).Info("Copying file to local store")
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), localStoreTempPrefix)
+	if err != nil {
+		return err
+	}
+	// TempFile creates the file 0600, the store may be shared with others
+	err = tmp.Chmod(0644)
+	tmp.Close()
+	if err == nil {
+		err = copyFile(args.Path, tmp.Name())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// DownloadToFile copies root + args.Key to the file at args.Path.
+func (s *LocalStore) DownloadToFile(args *DownloadToFileArgs) error {
+	src := s.path(args.Key)
+	s.logger.WithFields(util.LogFields{
+		"Path":   args.Path,
+		"Source": src,
+	}).Info("Copying file from local store")
+
+	if args.MaxSize > 0 {
+		stat, err := os.Stat(src)
+		if os.IsNotExist(err) {
+			return ErrStoreNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if stat.Size() > args.MaxSize {
+			return ErrStoreTooLarge
+		}
+	}
+	err := copyFile(src, args.Path)
+	if os.IsNotExist(err) {
+		return ErrStoreNotFound
+	}
+	return err
+}
+
+// Exists checks whether root + key is present.
+func (s *LocalStore) Exists(key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Open opens root + key.
+func (s *LocalStore) Open(key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrStoreNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Stat returns the details of root + key.
+func (s *LocalStore) Stat(key string) (*StoreObject, error) {
+	stat, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) || (err == nil && stat.IsDir()) {
+		return nil, ErrStoreNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &StoreObject{
+		Key:          key,
+		Size:         stat.Size(),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// List walks root for the files whose key starts with prefix.
+func (s *LocalStore) List(prefix string) ([]*StoreObject, error) {
+	objects := []*StoreObject{}
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), localStoreTempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		objects = append(objects, &StoreObject{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	}
+	err := filepath.Walk(s.root, walkFn)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(storeObjectsByKey(objects))
+	return objects, nil
+}
+
+// Delete removes root + key.
+func (s *LocalStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return ErrStoreNotFound
+	}
+	return err
+}
+
+type storeObjectsByKey []*StoreObject
+
+func (a storeObjectsByKey) Len() int           { return len(a) }
+func (a storeObjectsByKey) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a storeObjectsByKey) Less(i, j int) bool { return a[i].Key < a[j].Key }
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,200 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArtifactManifest lists the files in an artifact tarball, it is kept as
+// manifest.json next to the tarball and uploaded with it
+type ArtifactManifest struct {
+	ApplicationID string          `json:"applicationId"`
+	BuildID       string          `json:"buildId,omitempty"`
+	DeployID      string          `json:"deployId,omitempty"`
+	BuildStepID   string          `json:"buildStepId,omitempty"`
+	Pipeline      string          `json:"pipeline,omitempty"`
+	GitBranch     string          `json:"gitBranch,omitempty"`
+	GitCommit     string          `json:"gitCommit,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	Tarball       string          `json:"tarball"`
+	Size          int64           `json:"size"`
+	Sha256        string          `json:"sha256"`
+	Files         []*ArtifactFile `json:"files"`
+}
+
+// ArtifactFile is a file in an artifact tarball, Mode is octal like 0644
+type ArtifactFile struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// NewArtifactManifest reads the tarball of a collected artifact
+func NewArtifactManifest(artifact *Artifact, options *PipelineOptions) (*ArtifactManifest, error) {
+	f, err := os.Open(artifact.HostTarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest, err := scanArtifactTarball(f)
+	if err != nil {
+		return nil, err
+	}
+	manifest.ApplicationID = artifact.ApplicationID
+	manifest.BuildID = artifact.BuildID
+	manifest.DeployID = artifact.DeployID
+	manifest.BuildStepID = artifact.BuildStepID
+	manifest.Tarball = filepath.Base(artifact.HostTarPath)
+	manifest.CreatedAt = time.Now().UTC()
+	if options != nil {
+		manifest.Pipeline = options.Pipeline
+		if options.GitOptions != nil {
+			manifest.GitBranch = options.GitBranch
+			manifest.GitCommit = options.GitCommit
+		}
+	}
+	return manifest, nil
+}
+
+// ReadArtifactManifest loads a manifest.json
+func ReadArtifactManifest(path string) (*ArtifactManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ArtifactManifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid manifest %s: %s", path, err)
+	}
+	return manifest, nil
+}
+
+// WriteFile stores the manifest as json
+func (m *ArtifactManifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Verify checks the tarball against the manifest, the error lists all the
+// files that are missing, unexpected or changed
+func (m *ArtifactManifest) Verify(tarball io.Reader) error {
+	actual, err := scanArtifactTarball(tarball)
+	if err != nil {
+		return err
+	}
+
+	problems := []string{}
+	expected := map[string]*ArtifactFile{}
+	for _, file := range m.Files {
+		expected[file.Path] = file
+	}
+	for _, file := range actual.Files {
+		want, ok := expected[file.Path]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unexpected file %s", file.Path))
+			continue
+		}
+		delete(expected, file.Path)
+		if *want != *file {
+			problems = append(problems, fmt.Sprintf("changed file %s", file.Path))
+		}
+	}
+	for path := range expected {
+		problems = append(problems, fmt.Sprintf("missing file %s", path))
+	}
+	sort.Strings(problems)
+
+	// Everything else matching, the tarball itself can still differ
+	if len(problems) == 0 && actual.Sha256 != m.Sha256 {
+		problems = append(problems, fmt.Sprintf("tarball sha256 %s, expected %s", actual.Sha256, m.Sha256))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Artifact does not match its manifest:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// scanArtifactTarball hashes the tarball and every regular file in it,
+// directories are not listed
+func scanArtifactTarball(r io.Reader) (*ArtifactManifest, error) {
+	hash := sha256.New()
+	counter := &countingWriter{}
+	tee := io.TeeReader(r, io.MultiWriter(hash, counter))
+	tr := tar.NewReader(tee)
+
+	manifest := &ArtifactManifest{Files: []*ArtifactFile{}}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		file := &ArtifactFile{
+			Path: hdr.Name,
+			Mode: fmt.Sprintf("%04o", hdr.FileInfo().Mode().Perm()),
+			Size: hdr.Size,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			fileHash := sha256.New()
+			if _, err := io.Copy(fileHash, tr); err != nil {
+				return nil, err
+			}
+			file.Sha256 = fmt.Sprintf("%x", fileHash.Sum(nil))
+		case tar.TypeSymlink, tar.TypeLink:
+			file.Link = hdr.Linkname
+		default:
+			continue
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	// Read the padding at the end so the hash covers the whole tarball
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return nil, err
+	}
+	manifest.Sha256 = fmt.Sprintf("%x", hash.Sum(nil))
+	manifest.Size = counter.count
+	return manifest, nil
+}
+
+type countingWriter struct {
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}
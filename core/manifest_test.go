@@ -0,0 +1,107 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type ManifestSuite struct {
+	*util.TestSuite
+}
+
+func TestManifestSuite(t *testing.T) {
+	suiteTester := &ManifestSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func makeArtifactTarball(files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "output/", Mode: 0755, Typeflag: tar.TypeDir})
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func (s *ManifestSuite) TestNewArtifactManifest() {
+	tarball := filepath.Join(s.WorkingDir(), "output.tar")
+	err := ioutil.WriteFile(tarball, makeArtifactTarball(map[string]string{"output/app": "binary"}), 0644)
+	s.Require().Nil(err)
+
+	artifact := &Artifact{
+		HostTarPath:   tarball,
+		ApplicationID: "app",
+		BuildID:       "build",
+		BuildStepID:   "step",
+	}
+	options := &PipelineOptions{
+		Pipeline:   "build",
+		GitOptions: &GitOptions{GitBranch: "master", GitCommit: "abc"},
+	}
+	manifest, err := NewArtifactManifest(artifact, options)
+	s.Require().Nil(err)
+	s.Equal("output.tar", manifest.Tarball)
+	s.Equal("step", manifest.BuildStepID)
+	s.Equal("master", manifest.GitBranch)
+	s.Require().Len(manifest.Files, 1)
+	s.Equal(&ArtifactFile{
+		Path:   "output/app",
+		Mode:   "0644",
+		Size:   6,
+		Sha256: "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd",
+	}, manifest.Files[0])
+
+	stat, err := os.Stat(tarball)
+	s.Require().Nil(err)
+	s.Equal(stat.Size(), manifest.Size)
+
+	// It survives a round trip through manifest.json
+	err = manifest.WriteFile(artifact.ManifestPath())
+	s.Require().Nil(err)
+	read, err := ReadArtifactManifest(filepath.Join(s.WorkingDir(), "manifest.json"))
+	s.Require().Nil(err)
+	s.Equal(manifest.Files, read.Files)
+	s.Equal(manifest.Sha256, read.Sha256)
+}
+
+func (s *ManifestSuite) TestVerify() {
+	original := makeArtifactTarball(map[string]string{"output/app": "binary", "output/README": "docs"})
+	tarball := filepath.Join(s.WorkingDir(), "output.tar")
+	err := ioutil.WriteFile(tarball, original, 0644)
+	s.Require().Nil(err)
+	manifest, err := NewArtifactManifest(&Artifact{HostTarPath: tarball}, nil)
+	s.Require().Nil(err)
+
+	s.Nil(manifest.Verify(bytes.NewReader(original)))
+
+	changed := makeArtifactTarball(map[string]string{"output/app": "changed", "output/extra": "extra"})
+	err = manifest.Verify(bytes.NewReader(changed))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "changed file output/app")
+	s.Contains(err.Error(), "unexpected file output/extra")
+	s.Contains(err.Error(), "missing file output/README")
+}
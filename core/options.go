@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
@@ -27,6 +28,7 @@ import (
 	"strings"
 
 	"github.com/codegangsta/cli"
+	"github.com/docker/go-units"
 	"github.com/pborman/uuid"
 	"github.com/wercker/wercker/util"
 )
@@ -106,8 +108,14 @@ type AWSOptions struct {
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
 	AWSRegion          string
+	AWSProfile         string
 	S3Bucket           string
 	S3PartSize         int64
+	S3Endpoint         string
+	S3ForcePathStyle   bool
+	S3SkipVerify       bool
+	S3ACL              string
+	S3SSE              string
 }
 
 // NewAWSOptions constructor
@@ -115,18 +123,59 @@ func NewAWSOptions(c util.Settings, e *util.Environment, globalOpts *GlobalOptio
 	awsAccessKeyID, _ := c.String("aws-access-key")
 	awsRegion, _ := c.String("aws-region")
 	awsSecretAccessKey, _ := c.String("aws-secret-key")
+	awsProfile, _ := c.String("aws-profile")
 	s3Bucket, _ := c.String("s3-bucket")
+	s3Endpoint, _ := c.String("s3-endpoint")
+	if s3Endpoint != "" {
+		u, err := url.Parse(s3Endpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("Invalid s3-endpoint %s, expected a url like https://minio.example.com:9000", s3Endpoint)
+		}
+	}
+	s3ForcePathStyle, _ := c.Bool("s3-path-style")
+	s3SkipVerify, _ := c.Bool("s3-insecure-skip-verify")
+	s3ACL, _ := c.String("s3-acl")
+	s3SSE, _ := c.String("s3-sse")
+	// SSE is on unless it is explicitly turned off
+	if s3SSE == "none" {
+		s3SSE = ""
+	} else if s3SSE == "" {
+		s3SSE = "AES256"
+	}
 
 	return &AWSOptions{
 		GlobalOptions:      globalOpts,
 		AWSAccessKeyID:     awsAccessKeyID,
 		AWSRegion:          awsRegion,
 		AWSSecretAccessKey: awsSecretAccessKey,
+		AWSProfile:         awsProfile,
 		S3Bucket:           s3Bucket,
 		S3PartSize:         100 * 1024 * 1024, // 100 MB
+		S3Endpoint:         s3Endpoint,
+		S3ForcePathStyle:   s3ForcePathStyle,
+		S3SkipVerify:       s3SkipVerify,
+		S3ACL:              s3ACL,
+		S3SSE:              s3SSE,
 	}, nil
 }
 
+// S3BucketURL returns the url of a bucket on the configured endpoint
+func (o *AWSOptions) S3BucketURL(bucket string) string {
+	if o.S3Endpoint == "" {
+		return fmt.Sprintf("https://s3.amazonaws.com/%s", bucket)
+	}
+	endpoint := strings.TrimSuffix(o.S3Endpoint, "/")
+	if o.S3ForcePathStyle {
+		return fmt.Sprintf("%s/%s", endpoint, bucket)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Sprintf("%s/%s", endpoint, bucket)
+	}
+	u.Host = fmt.Sprintf("%s.%s", bucket, u.Host)
+	return u.String()
+}
+
 // GitOptions for the users, mostly
 type GitOptions struct {
 	*GlobalOptions
@@ -135,6 +184,7 @@ type GitOptions struct {
 	GitDomain     string
 	GitOwner      string
 	GitRepository string
+	GitTag        string
 }
 
 func guessGitBranch(c util.Settings, e *util.Environment) string {
@@ -201,6 +251,39 @@ func guessGitCommit(c util.Settings, e *util.Environment) string {
 	return strings.Trim(out.String(), "\n")
 }
 
+func guessGitTag(c util.Settings, e *util.Environment) string {
+	tag, _ := c.String("git-tag")
+	if tag != "" {
+		return tag
+	}
+
+	projectPath := guessProjectPath(c, e)
+	if projectPath == "" {
+		return ""
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	defer os.Chdir(cwd)
+	os.Chdir(projectPath)
+
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return ""
+	}
+
+	// Only a tag pointing at HEAD counts, this fails otherwise
+	var out bytes.Buffer
+	cmd := exec.Command(git, "describe", "--tags", "--exact-match", "HEAD")
+	cmd.Stdout = &out
+	err = cmd.Run()
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(out.String(), "\n")
+}
+
 func guessGitOwner(c util.Settings, e *util.Environment) string {
 	owner, _ := c.String("git-owner")
 	if owner != "" {
@@ -233,6 +316,7 @@ func NewGitOptions(c util.Settings, e *util.Environment, globalOpts *GlobalOptio
 	gitDomain, _ := c.String("git-domain")
 	gitOwner := guessGitOwner(c, e)
 	gitRepository := guessGitRepository(c, e)
+	gitTag := guessGitTag(c, e)
 
 	return &GitOptions{
 		GlobalOptions: globalOpts,
@@ -241,6 +325,7 @@ func NewGitOptions(c util.Settings, e *util.Environment, globalOpts *GlobalOptio
 		GitDomain:     gitDomain,
 		GitOwner:      gitOwner,
 		GitRepository: gitRepository,
+		GitTag:        gitTag,
 	}, nil
 }
 
@@ -282,6 +367,9 @@ type ReporterOptions struct {
 	ReporterHost string
 	ReporterKey  string
 	ShouldReport bool
+	// EventsOut is where the JSON lines event stream is written, a path, a
+	// file descriptor number or - for stdout
+	EventsOut string
 }
 
 // NewReporterOptions constructor
@@ -289,6 +377,7 @@ func NewReporterOptions(c util.Settings, e *util.Environment, globalOpts *Global
 	shouldReport, _ := c.Bool("report")
 	reporterHost, _ := c.String("wercker-host")
 	reporterKey, _ := c.String("wercker-token")
+	eventsOut, _ := c.String("events-out")
 
 	if shouldReport {
 		if reporterKey == "" {
@@ -305,6 +394,7 @@ func NewReporterOptions(c util.Settings, e *util.Environment, globalOpts *Global
 		ReporterHost:  reporterHost,
 		ReporterKey:   reporterKey,
 		ShouldReport:  shouldReport,
+		EventsOut:     eventsOut,
 	}, nil
 }
 
@@ -337,6 +427,7 @@ type PipelineOptions struct {
 	Tag           string
 	Message       string
 	ShouldStoreS3 bool
+	ArtifactStore string
 
 	WorkingDir string
 
@@ -352,10 +443,15 @@ type PipelineOptions struct {
 
 	CommandTimeout    int
 	NoResponseTimeout int
+	CommandProtocol   string
+	Runtime           string
 	ShouldArtifacts   bool
 	ShouldRemove      bool
 	SourceDir         string
 
+	CacheStore   string
+	CacheMaxSize int64
+
 	AttachOnError  bool
 	DirectMount    bool
 	EnableDevSteps bool
@@ -533,6 +629,12 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 	tag := guessTag(c, e)
 	message := guessMessage(c, e)
 	shouldStoreS3, _ := c.Bool("store-s3")
+	artifactStore, _ := c.String("artifact-store")
+	if artifactStore != "" {
+		if _, err := NewStoreFromURL(artifactStore, awsOpts); err != nil {
+			return nil, err
+		}
+	}
 
 	workingDir, _ := c.String("working-dir")
 	workingDir, _ = filepath.Abs(workingDir)
@@ -554,12 +656,36 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 	commandTimeout := int(commandTimeoutFloat * 1000 * 60)
 	noResponseTimeoutFloat, _ := c.Float64("no-response-timeout")
 	noResponseTimeout := int(noResponseTimeoutFloat * 1000 * 60)
+	commandProtocol, _ := c.String("command-protocol")
+	if commandProtocol == "" {
+		commandProtocol = "sentinel"
+	}
+	if commandProtocol != "sentinel" && commandProtocol != "framed" {
+		return nil, fmt.Errorf("Unknown command protocol %s, expected sentinel or framed", commandProtocol)
+	}
+	runtime, _ := c.String("runtime")
+	if runtime == "" {
+		runtime = "docker"
+	}
+	if runtime != "docker" && runtime != "local" {
+		return nil, fmt.Errorf("Unknown runtime %s, expected docker or local", runtime)
+	}
 	shouldArtifacts, _ := c.Bool("artifacts")
 	// TODO(termie): switch negative flag
 	shouldRemove, _ := c.Bool("no-remove")
 	shouldRemove = !shouldRemove
 	sourceDir, _ := c.String("source-dir")
 
+	cacheStore, _ := c.String("cache-store")
+	cacheMaxSizeString, _ := c.String("cache-max-size")
+	cacheMaxSize := int64(0)
+	if cacheMaxSizeString != "" {
+		cacheMaxSize, err = units.RAMInBytes(cacheMaxSizeString)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cache-max-size %s: %s", cacheMaxSizeString, err)
+		}
+	}
+
 	attachOnError, _ := c.Bool("attach-on-error")
 	directMount, _ := c.Bool("direct-mount")
 	enableDevSteps, _ := c.Bool("enable-dev-steps")
@@ -596,6 +722,7 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 		Repository:    repository,
 		ShouldCommit:  shouldCommit,
 		ShouldStoreS3: shouldStoreS3,
+		ArtifactStore: artifactStore,
 
 		WorkingDir: workingDir,
 
@@ -609,10 +736,15 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 
 		CommandTimeout:    commandTimeout,
 		NoResponseTimeout: noResponseTimeout,
+		CommandProtocol:   commandProtocol,
+		Runtime:           runtime,
 		ShouldArtifacts:   shouldArtifacts,
 		ShouldRemove:      shouldRemove,
 		SourceDir:         sourceDir,
 
+		CacheStore:   cacheStore,
+		CacheMaxSize: cacheMaxSize,
+
 		AttachOnError:  attachOnError,
 		DirectMount:    directMount,
 		EnableDevSteps: enableDevSteps,
@@ -625,6 +757,11 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 	}, nil
 }
 
+// ShouldUploadArtifacts is true when there is a store to upload artifacts to
+func (o *PipelineOptions) ShouldUploadArtifacts() bool {
+	return o.ShouldStoreS3 || o.ArtifactStore != ""
+}
+
 // HostPath returns a path relative to the build root on the host.
 func (o *PipelineOptions) HostPath(s ...string) string {
 	return path.Join(o.BuildPath(), o.PipelineID, path.Join(s...))
@@ -839,9 +976,12 @@ func NewPullOptions(c util.Settings, e *util.Environment) (*PullOptions, error)
 
 	repository, _ := c.String("target")
 	output, _ := c.String("output")
-	outputDir, err := filepath.Abs(output)
-	if err != nil {
-		return nil, err
+	// "-" streams the repository to stdout or, with load, into docker
+	if output != "-" {
+		output, err = filepath.Abs(output)
+		if err != nil {
+			return nil, err
+		}
 	}
 	branch, _ := c.String("branch")
 	status, _ := c.String("status")
@@ -857,12 +997,97 @@ func NewPullOptions(c util.Settings, e *util.Environment) (*PullOptions, error)
 		Branch:     branch,
 		Status:     status,
 		Result:     result,
-		Output:     outputDir,
+		Output:     output,
 		Load:       load,
 		Force:      force,
 	}, nil
 }
 
+// ArtifactsOptions for the artifacts list and get commands, artifacts come
+// from the store at ArtifactStore
+type ArtifactsOptions struct {
+	*GlobalOptions
+	*AWSOptions
+
+	Target        string
+	ArtifactStore string
+	Branch        string
+	Result        string
+	Step          string
+	Output        string
+}
+
+// NewArtifactsOptions constructor
+func NewArtifactsOptions(c util.Settings, e *util.Environment) (*ArtifactsOptions, error) {
+	globalOpts, err := NewGlobalOptions(c, e)
+	if err != nil {
+		return nil, err
+	}
+
+	awsOpts, err := NewAWSOptions(c, e, globalOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	target, _ := c.String("target")
+	artifactStore, _ := c.String("artifact-store")
+	if artifactStore == "" {
+		return nil, fmt.Errorf("No --artifact-store to get the artifacts from")
+	}
+	if _, err := NewStoreFromURL(artifactStore, awsOpts); err != nil {
+		return nil, err
+	}
+	branch, _ := c.String("branch")
+	result, _ := c.String("result")
+	step, _ := c.String("step")
+	output, _ := c.String("output")
+	outputDir, err := filepath.Abs(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArtifactsOptions{
+		GlobalOptions: globalOpts,
+		AWSOptions:    awsOpts,
+
+		Target:        target,
+		ArtifactStore: artifactStore,
+		Branch:        branch,
+		Result:        result,
+		Step:          step,
+		Output:        outputDir,
+	}, nil
+}
+
+// ArtifactsVerifyOptions for the artifacts verify command
+type ArtifactsVerifyOptions struct {
+	*GlobalOptions
+
+	Tarball  string
+	Manifest string
+}
+
+// NewArtifactsVerifyOptions constructor
+func NewArtifactsVerifyOptions(c util.Settings, e *util.Environment) (*ArtifactsVerifyOptions, error) {
+	globalOpts, err := NewGlobalOptions(c, e)
+	if err != nil {
+		return nil, err
+	}
+
+	tarball, _ := c.String("target")
+	manifest, _ := c.String("manifest")
+	if manifest == "" {
+		manifest = filepath.Join(filepath.Dir(tarball), "manifest.json")
+	}
+
+	return &ArtifactsVerifyOptions{
+		GlobalOptions: globalOpts,
+
+		Tarball:  tarball,
+		Manifest: manifest,
+	}, nil
+}
+
 // VersionOptions contains the options associated with the version
 // command.
 type VersionOptions struct {
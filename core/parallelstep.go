@@ -0,0 +1,118 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pborman/uuid"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+// ParallelStep is a group of steps that are run at the same time, each of
+// them in its own session. It is only a container, the runner is in charge
+// of executing the children and reporting on them.
+type ParallelStep struct {
+	*BaseStep
+	steps []Step
+}
+
+// NewParallelStep returns a group for the given children.
+func NewParallelStep(steps []Step) *ParallelStep {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.DisplayName())
+	}
+	displayName := fmt.Sprintf("parallel (%s)", strings.Join(names, ", "))
+
+	baseStep := NewBaseStep(BaseStepOptions{
+		DisplayName: displayName,
+		Env:         util.NewEnvironment(),
+		ID:          "parallel",
+		Name:        "parallel",
+		Owner:       "wercker",
+		SafeID:      fmt.Sprintf("parallel-%s", uuid.NewRandom().String()),
+		Version:     util.Version(),
+	})
+
+	return &ParallelStep{BaseStep: baseStep, steps: steps}
+}
+
+// Steps getter
+func (s *ParallelStep) Steps() []Step {
+	return s.steps
+}
+
+// Fetch fetches all the children
+func (s *ParallelStep) Fetch() (string, error) {
+	for _, step := range s.steps {
+		if _, err := step.Fetch(); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// InitEnv NOP, the children get their own environment
+func (s *ParallelStep) InitEnv(env *util.Environment) {
+}
+
+// Execute is not supported on the group itself
+func (s *ParallelStep) Execute(sessionCtx context.Context, sess *Session) (int, error) {
+	return -1, fmt.Errorf("Parallel groups can only be run by the runner")
+}
+
+// CollectFile NOP
+func (s *ParallelStep) CollectFile(a, b, c string, dst io.Writer) error {
+	return nil
+}
+
+// CollectArtifact NOP
+func (s *ParallelStep) CollectArtifact(string) (*Artifact, error) {
+	return nil, nil
+}
+
+// ReportPath getter
+func (s *ParallelStep) ReportPath(...string) string {
+	// for now we just want something that doesn't exist
+	return uuid.NewRandom().String()
+}
+
+// ShouldSyncEnv if any of the children want to
+func (s *ParallelStep) ShouldSyncEnv() bool {
+	for _, step := range s.steps {
+		if step.ShouldSyncEnv() {
+			return true
+		}
+	}
+	return false
+}
+
+// FlattenSteps replaces parallel groups with their children, this is the
+// list of steps as they are ordered and reported.
+func FlattenSteps(steps ...Step) []Step {
+	flat := []Step{}
+	for _, step := range steps {
+		if group, ok := step.(*ParallelStep); ok {
+			flat = append(flat, group.Steps()...)
+			continue
+		}
+		flat = append(flat, step)
+	}
+	return flat
+}
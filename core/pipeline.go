@@ -17,6 +17,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -48,11 +49,15 @@ func IsBuildID(input string) bool {
 // both Build and Deploy
 type Pipeline interface {
 	// Getters
-	Env() *util.Environment // base
-	Box() Box               // base
-	Services() []ServiceBox //base
-	Steps() []Step          // base
-	AfterSteps() []Step     // base
+	Env() *util.Environment      // base
+	Box() Box                    // base
+	Services() []ServiceBox      //base
+	Steps() []Step               // base
+	AfterSteps() []Step          // base
+	Caches() []*CacheConfig      // base
+	Artifacts() *ArtifactsConfig // base
+	Secrets() []string           // base
+	HiddenExport() []string      // base
 
 	// Methods
 	CommonEnv() [][]string     // base
@@ -159,6 +164,22 @@ func (p *BasePipeline) AfterSteps() []Step {
 	return p.afterSteps
 }
 
+// Caches is a getter for the keyed caches in the config
+func (p *BasePipeline) Caches() []*CacheConfig {
+	return p.config.Cache
+}
+
+// Artifacts is a getter for the artifacts config, it may be nil
+func (p *BasePipeline) Artifacts() *ArtifactsConfig {
+	return p.config.Artifacts
+}
+
+// Secrets is a getter for the names of the hidden env vars that are
+// written to SecretsMountPath instead of being exported
+func (p *BasePipeline) Secrets() []string {
+	return p.config.Secrets
+}
+
 // Env is a getter for env
 func (p *BasePipeline) Env() *util.Environment {
 	return p.env
@@ -206,6 +227,8 @@ func (p *BasePipeline) SetupGuest(sessionCtx context.Context, sess *Session) err
 			fmt.Sprintf(`cp -r "%s" "%s"`, p.options.MntPath("source"), p.options.BasePath()),
 			// Copy the cache from the mounted directory to the pipeline dir
 			fmt.Sprintf(`cp -r "%s" "%s"`, p.options.MntPath("cache"), p.options.GuestPath("cache")),
+			// Unpack the keyed caches the runner picked, if any
+			fmt.Sprintf(`for f in "%s"/*.tar; do if [ -f "$f" ]; then tar -xf "$f" -C "%s"; fi; done`, p.options.MntPath("keyed-cache"), p.options.SourcePath()),
 		)
 	}
 
@@ -240,7 +263,7 @@ func (p *BasePipeline) ExportEnvironment(sessionCtx context.Context, sess *Sessi
 	// Export the hidden variables separately
 	sess.HideLogs()
 	defer sess.ShowLogs()
-	exit, _, err = sess.SendChecked(sessionCtx, p.Env().Hidden.Export()...)
+	exit, _, err = sess.SendChecked(sessionCtx, p.HiddenExport()...)
 	if err != nil {
 		return err
 	}
@@ -250,6 +273,56 @@ func (p *BasePipeline) ExportEnvironment(sessionCtx context.Context, sess *Sessi
 	return nil
 }
 
+// SecretsMountPath is the tmpfs in the box the pipeline's secrets are
+// written to
+const SecretsMountPath = "/run/secrets"
+
+// SecretFile is the path of the file holding the secret name in the box
+func SecretFile(name string) string {
+	return path.Join(SecretsMountPath, name)
+}
+
+// HiddenExport returns the commands that export the hidden env, the secrets
+// of the pipeline are written to a file readable only by the box user and
+// NAME_FILE is exported with its path instead of the value
+func (p *BasePipeline) HiddenExport() []string {
+	hidden := p.Env().Hidden
+	secrets := map[string]bool{}
+	for _, name := range p.Secrets() {
+		secrets[name] = true
+	}
+
+	cmds := []string{}
+	for _, key := range hidden.Order {
+		if !secrets[key] {
+			cmds = append(cmds, fmt.Sprintf(`export %s=%q`, key, hidden.Map[key]))
+		}
+	}
+	for _, name := range p.Secrets() {
+		value, ok := hidden.Map[name]
+		if !ok {
+			p.logger.Warnln("Secret", name, "is not set, skipping it")
+			continue
+		}
+		cmds = append(cmds, secretExport(name, value)...)
+	}
+	return cmds
+}
+
+// secretExport writes value to the secret file of name and exports its path
+func secretExport(name, value string) []string {
+	file := SecretFile(name)
+	return []string{
+		fmt.Sprintf(`(umask 0377 && rm -f %s && printf '%%s' %s > %s)`, file, shellQuote(value), file),
+		fmt.Sprintf(`export %s_FILE=%q`, name, file),
+	}
+}
+
+// shellQuote single quotes s for the shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
 // LogEnvironment dumps the base environment
 func (p *BasePipeline) LogEnvironment() {
 	p.logger.Debugln("Base Pipeline Environment:")
@@ -91,3 +91,25 @@ func (s *PipelineSuite) TestIsBuildIDInvalid3() {
 
 	s.Equal(false, ok)
 }
+
+func (s *PipelineSuite) TestHiddenExportSecrets() {
+	env := util.NewEnvironment()
+	env.Hidden.Add("API_TOKEN", "tok'en")
+	env.Hidden.Add("DEPLOY_KEY", "key")
+	p := &BasePipeline{
+		config: &PipelineConfig{Secrets: []string{"DEPLOY_KEY", "MISSING"}},
+		env:    env,
+		logger: util.RootLogger().WithField("Logger", "Test"),
+	}
+
+	s.Equal([]string{
+		`export API_TOKEN="tok'en"`,
+		`(umask 0377 && rm -f /run/secrets/DEPLOY_KEY && printf '%s' 'key' > /run/secrets/DEPLOY_KEY)`,
+		`export DEPLOY_KEY_FILE="/run/secrets/DEPLOY_KEY"`,
+	}, p.HiddenExport())
+}
+
+func (s *PipelineSuite) TestShellQuote() {
+	s.Equal(`'plain'`, shellQuote("plain"))
+	s.Equal(`'it'\''s $HOME'`, shellQuote("it's $HOME"))
+}
@@ -0,0 +1,185 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Protocol is how a Session finds out that the commands it sent have finished
+// and what their exit code was.
+type Protocol interface {
+	// Setup returns the commands that need to run once, right after attaching
+	Setup() []string
+	// Terminator returns the command sent after every batch of commands to
+	// report the result
+	Terminator(sentinel string) string
+	// NewScanner returns a Scanner looking for the result of one batch
+	NewScanner(sentinel string) Scanner
+	// SeparateStderr is true if the protocol needs stdout and stderr to be
+	// kept apart by the transport
+	SeparateStderr() bool
+}
+
+// Scanner goes through the output of a batch of commands. Scan returns the
+// output that belongs to the commands and, once it has been seen, the frame
+// with the exit code.
+type Scanner interface {
+	Scan(stream, chunk string) (output []string, frame string, exit int)
+}
+
+// ProtocolTransport can be implemented by a Transport to pick the Protocol
+// used by its sessions, the SentinelProtocol is used otherwise.
+type ProtocolTransport interface {
+	Transport
+	Protocol() Protocol
+}
+
+// SentinelProtocol echoes a random string and $? after the commands and looks
+// for it in the output, this works with any box but gets confused by output
+// without a trailing newline or steps that redirect stdout.
+type SentinelProtocol struct{}
+
+// NewSentinelProtocol constructor
+func NewSentinelProtocol() *SentinelProtocol {
+	return &SentinelProtocol{}
+}
+
+// Setup NOP
+func (p *SentinelProtocol) Setup() []string {
+	return []string{}
+}
+
+// Terminator echoes the sentinel and exit code
+func (p *SentinelProtocol) Terminator(sentinel string) string {
+	return fmt.Sprintf("echo %s $?", sentinel)
+}
+
+// SeparateStderr is not needed, everything is scanned the same way
+func (p *SentinelProtocol) SeparateStderr() bool {
+	return false
+}
+
+// NewScanner returns a line based scanner
+func (p *SentinelProtocol) NewScanner(sentinel string) Scanner {
+	return &sentinelScanner{sentinel: sentinel}
+}
+
+type sentinelScanner struct {
+	sentinel string
+}
+
+func (s *sentinelScanner) Scan(stream, chunk string) ([]string, string, int) {
+	output := []string{}
+	for _, subline := range smartSplitLines(chunk, s.sentinel) {
+		// If we found the exit code, we're done
+		foundExit, exit := checkLine(subline, s.sentinel)
+		if foundExit {
+			return output, subline, exit
+		}
+		output = append(output, subline)
+	}
+	return output, "", 0
+}
+
+// frameMarker delimits the frames of the FramedProtocol, the ASCII record
+// separator doesn't show up in regular output
+const frameMarker = "\x1e"
+
+// FramedProtocol keeps a copy of the original stderr of the shell as fd 3 and
+// writes a frame with the exit code to it after every batch of commands. The
+// frame does not depend on newlines and is not affected by steps redirecting
+// their output. It needs a POSIX shell and a transport that keeps stdout and
+// stderr apart.
+type FramedProtocol struct{}
+
+// NewFramedProtocol constructor
+func NewFramedProtocol() *FramedProtocol {
+	return &FramedProtocol{}
+}
+
+// Setup opens fd 3 as the side channel for the frames
+func (p *FramedProtocol) Setup() []string {
+	return []string{"exec 3>&2"}
+}
+
+// Terminator writes the frame to fd 3
+func (p *FramedProtocol) Terminator(sentinel string) string {
+	return fmt.Sprintf(`printf '\036%%s %%d\036' %s $? >&3`, sentinel)
+}
+
+// SeparateStderr is needed so frames don't get mixed with stdout
+func (p *FramedProtocol) SeparateStderr() bool {
+	return true
+}
+
+// NewScanner returns a scanner that looks for the frame on stderr
+func (p *FramedProtocol) NewScanner(sentinel string) Scanner {
+	return &framedScanner{start: frameMarker + sentinel + " "}
+}
+
+type framedScanner struct {
+	start string
+	// pending holds stderr that may be the beginning of a frame
+	pending string
+}
+
+func (s *framedScanner) Scan(stream, chunk string) ([]string, string, int) {
+	if stream != "stderr" {
+		return []string{chunk}, "", 0
+	}
+
+	buf := s.pending + chunk
+	s.pending = ""
+	output := []string{}
+
+	i := strings.Index(buf, s.start)
+	if i == -1 {
+		// Hold back anything that could be the start of a frame split over
+		// multiple chunks
+		keep := 0
+		for n := len(s.start) - 1; n > 0; n-- {
+			if strings.HasSuffix(buf, s.start[:n]) {
+				keep = n
+				break
+			}
+		}
+		s.pending = buf[len(buf)-keep:]
+		if len(buf)-keep > 0 {
+			output = append(output, buf[:len(buf)-keep])
+		}
+		return output, "", 0
+	}
+
+	if i > 0 {
+		output = append(output, buf[:i])
+	}
+	rest := buf[i+len(s.start):]
+	end := strings.Index(rest, frameMarker)
+	if end == -1 {
+		// The frame isn't complete yet
+		s.pending = buf[i:]
+		return output, "", 0
+	}
+	exit, err := strconv.Atoi(rest[:end])
+	if err != nil {
+		// Not a frame after all, treat it as output
+		output = append(output, buf[i:])
+		return output, "", 0
+	}
+	return output, buf[i : i+len(s.start)+end+1], exit
+}
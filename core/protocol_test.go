@@ -0,0 +1,84 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type ProtocolSuite struct {
+	*util.TestSuite
+}
+
+func TestProtocolSuite(t *testing.T) {
+	suiteTester := &ProtocolSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *ProtocolSuite) TestSentinelScanner() {
+	scanner := NewSentinelProtocol().NewScanner("FOO9000")
+
+	output, frame, _ := scanner.Scan("stdout", "some garbage\n")
+	s.Equal([]string{"some garbage\n"}, output)
+	s.Equal("", frame)
+
+	output, frame, exit := scanner.Scan("stdout", "more garbage\nFOO9000 3\n")
+	s.Equal([]string{"more garbage\n"}, output)
+	s.Equal("FOO9000 3\n", frame)
+	s.Equal(3, exit)
+}
+
+func (s *ProtocolSuite) TestFramedScanner() {
+	scanner := NewFramedProtocol().NewScanner("FOO9000")
+
+	// stdout is passed through untouched
+	output, frame, _ := scanner.Scan("stdout", "no newline")
+	s.Equal([]string{"no newline"}, output)
+	s.Equal("", frame)
+
+	// stderr without a trailing newline followed by the frame
+	output, frame, exit := scanner.Scan("stderr", "warning\x1eFOO9000 0\x1e")
+	s.Equal([]string{"warning"}, output)
+	s.Equal("\x1eFOO9000 0\x1e", frame)
+	s.Equal(0, exit)
+}
+
+func (s *ProtocolSuite) TestFramedScannerSplitFrame() {
+	scanner := NewFramedProtocol().NewScanner("FOO9000")
+
+	output, frame, _ := scanner.Scan("stderr", "oops\x1eFOO")
+	s.Equal([]string{"oops"}, output)
+	s.Equal("", frame)
+
+	output, frame, _ = scanner.Scan("stderr", "9000 12")
+	s.Equal(0, len(output))
+	s.Equal("", frame)
+
+	output, frame, exit := scanner.Scan("stderr", "7\x1e")
+	s.Equal(0, len(output))
+	s.Equal("\x1eFOO9000 127\x1e", frame)
+	s.Equal(127, exit)
+}
+
+func (s *ProtocolSuite) TestFramedScannerNotAFrame() {
+	scanner := NewFramedProtocol().NewScanner("FOO9000")
+
+	output, frame, _ := scanner.Scan("stderr", "\x1eFOO9000 nope\x1e")
+	s.Equal([]string{"\x1eFOO9000 nope\x1e"}, output)
+	s.Equal("", frame)
+}
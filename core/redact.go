@@ -0,0 +1,139 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RedactedValue replaces secrets in the logs
+const RedactedValue = "****"
+
+// redactMinLength is the length below which values aren't treated as
+// secrets, masking those would hide most of the output
+const redactMinLength = 4
+
+// Redactor replaces secret values, and their base64, URL and quoted forms,
+// with RedactedValue. Logs come in chunks, so the end of a chunk that could
+// be the start of a secret is held back until the next chunk shows whether
+// it is.
+type Redactor struct {
+	secrets []string
+	known   map[string]bool
+	maxLen  int
+}
+
+// NewRedactor constructor
+func NewRedactor() *Redactor {
+	return &Redactor{known: map[string]bool{}}
+}
+
+// AddSecret adds a value, and the forms it is likely to be printed in, to
+// the secrets
+func (r *Redactor) AddSecret(value string) {
+	if len(value) < redactMinLength {
+		return
+	}
+	quoted := strconv.Quote(value)
+	forms := []string{
+		value,
+		strings.TrimRight(base64.StdEncoding.EncodeToString([]byte(value)), "="),
+		strings.TrimRight(base64.URLEncoding.EncodeToString([]byte(value)), "="),
+		url.QueryEscape(value),
+		quoted[1 : len(quoted)-1],
+	}
+	added := false
+	for _, form := range forms {
+		if r.known[form] {
+			continue
+		}
+		r.known[form] = true
+		r.secrets = append(r.secrets, form)
+		if len(form) > r.maxLen {
+			r.maxLen = len(form)
+		}
+		added = true
+	}
+	if added {
+		// Longest first, so a secret that contains another is masked as a whole
+		sort.Sort(byLengthDesc(r.secrets))
+	}
+}
+
+// HasSecrets is true once a secret has been added
+func (r *Redactor) HasSecrets() bool {
+	return len(r.secrets) > 0
+}
+
+// Redact masks the secrets in s. pending is what was held back from the
+// previous chunk, the returned rest should be passed with the next one.
+func (r *Redactor) Redact(pending, s string) (redacted, rest string) {
+	s = pending + s
+	out := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		tail := s[i:]
+		if len(tail) < r.maxLen && r.isPartial(tail) {
+			out = append(out, s[start:i])
+			return strings.Join(out, ""), tail
+		}
+		if secret := r.match(tail); secret != "" {
+			out = append(out, s[start:i], RedactedValue)
+			i += len(secret) - 1
+			start = i + 1
+		}
+	}
+	out = append(out, s[start:])
+	return strings.Join(out, ""), ""
+}
+
+// Flush masks what was held back once no more chunks will follow
+func (r *Redactor) Flush(pending string) string {
+	for _, secret := range r.secrets {
+		pending = strings.Replace(pending, secret, RedactedValue, -1)
+	}
+	return pending
+}
+
+// match returns the longest secret that s starts with
+func (r *Redactor) match(s string) string {
+	for _, secret := range r.secrets {
+		if strings.HasPrefix(s, secret) {
+			return secret
+		}
+	}
+	return ""
+}
+
+// isPartial is true when s is the start of a secret that continues in the
+// next chunk
+func (r *Redactor) isPartial(s string) bool {
+	for _, secret := range r.secrets {
+		if len(s) < len(secret) && strings.HasPrefix(secret, s) {
+			return true
+		}
+	}
+	return false
+}
+
+type byLengthDesc []string
+
+func (s byLengthDesc) Len() int           { return len(s) }
+func (s byLengthDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLengthDesc) Less(i, j int) bool { return len(s[i]) > len(s[j]) }
@@ -0,0 +1,90 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type RedactSuite struct {
+	*util.TestSuite
+}
+
+func TestRedactSuite(t *testing.T) {
+	suiteTester := &RedactSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *RedactSuite) TestRedact() {
+	r := NewRedactor()
+	r.AddSecret("hunter2")
+	r.AddSecret("s3cr3t/value")
+	r.AddSecret("abc")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"token is hunter2\n", "token is ****\n"},
+		{"hunter2hunter2", "********"},
+		{"base64: " + base64.StdEncoding.EncodeToString([]byte("hunter2")), "base64: ****=="},
+		{"url: a=s3cr3t%2Fvalue&b", "url: a=****&b"},
+		{"short values like abc are not masked", "short values like abc are not masked"},
+	}
+	for _, test := range tests {
+		redacted, rest := r.Redact("", test.input)
+		s.Equal(test.expected, redacted+r.Flush(rest), test.input)
+	}
+}
+
+func (s *RedactSuite) TestRedactChunks() {
+	r := NewRedactor()
+	r.AddSecret("hunter2")
+	r.AddSecret("hunter2-and-more")
+
+	output := []string{}
+	rest := ""
+	for _, chunk := range []string{"export TOKEN=hun", "ter", "2\n", "and hunter2-and", "-more done\n"} {
+		var redacted string
+		redacted, rest = r.Redact(rest, chunk)
+		s.NotContains(redacted, "hun")
+		output = append(output, redacted)
+	}
+	output = append(output, r.Flush(rest))
+	s.Equal("export TOKEN=****\nand **** done\n", strings.Join(output, ""))
+}
+
+func (s *RedactSuite) TestEmitterRedactsLogs() {
+	e := NewNormalizedEmitter()
+	logs := []string{}
+	e.AddListener(Logs, func(args *LogsArgs) {
+		logs = append(logs, args.Logs)
+	})
+	e.AddSecrets("deploy-token-1234")
+
+	e.Emit(Logs, &LogsArgs{Logs: "pushing with deploy-tok"})
+	e.Emit(Logs, &LogsArgs{Logs: "en-1234 and "})
+	e.Emit(Logs, &LogsArgs{Logs: "deploy"})
+	s.Equal("pushing with **** and ", strings.Join(logs, ""))
+
+	// Whatever is held back is flushed when the build finishes
+	e.Emit(BuildFinished, &BuildFinishedArgs{})
+	s.Equal("pushing with **** and deploy", strings.Join(logs, ""))
+}
@@ -15,11 +15,17 @@
 package core
 
 import (
+	"crypto/tls"
+	"io"
+	"net/http"
 	"os"
+	"sort"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/wercker/wercker/util"
 )
@@ -32,11 +38,30 @@ func NewS3Store(options *AWSOptions) *S3Store {
 		logger.Panic("options cannot be nil")
 	}
 	conf := aws.NewConfig()
+	// Without static keys or a profile we use the default chain: the
+	// environment, ~/.aws/credentials and the instance role
 	if options.AWSAccessKeyID != "" && options.AWSSecretAccessKey != "" {
 		creds := credentials.NewStaticCredentials(options.AWSAccessKeyID, options.AWSSecretAccessKey, "")
 		conf = conf.WithCredentials(creds)
+	} else if options.AWSProfile != "" {
+		creds := credentials.NewSharedCredentials("", options.AWSProfile)
+		conf = conf.WithCredentials(creds)
 	}
 	conf = conf.WithRegion(options.AWSRegion)
+	if options.S3Endpoint != "" {
+		conf = conf.WithEndpoint(options.S3Endpoint)
+	}
+	if options.S3ForcePathStyle {
+		conf = conf.WithS3ForcePathStyle(true)
+	}
+	if options.S3SkipVerify {
+		conf = conf.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		})
+	}
 	sess := session.New(conf)
 
 	return &S3Store{
@@ -80,14 +105,19 @@ func (s *S3Store) StoreFromFile(args *StoreFromFileArgs) error {
 	})
 	for try := 1; try <= args.MaxTries; try++ {
 
-		_, err = uploadManager.Upload(&s3manager.UploadInput{
-			ACL:                  aws.String("private"),
-			Body:                 file,
-			Bucket:               aws.String(s.options.S3Bucket),
-			Key:                  aws.String(args.Key),
-			Metadata:             args.Meta,
-			ServerSideEncryption: aws.String("AES256"),
-		})
+		input := &s3manager.UploadInput{
+			Body:     file,
+			Bucket:   aws.String(s.options.S3Bucket),
+			Key:      aws.String(args.Key),
+			Metadata: args.Meta,
+		}
+		if s.options.S3ACL != "" {
+			input.ACL = aws.String(s.options.S3ACL)
+		}
+		if s.options.S3SSE != "" {
+			input.ServerSideEncryption = aws.String(s.options.S3SSE)
+		}
+		_, err = uploadManager.Upload(input)
 
 		if err != nil {
 			s.logger.WithFields(util.LogFields{
@@ -116,3 +146,154 @@ func (s *S3Store) StoreFromFile(args *StoreFromFileArgs) error {
 
 	return outerErr
 }
+
+// Exists checks whether key is present in options.Bucket.
+func (s *S3Store) Exists(key string) (bool, error) {
+	_, err := s.head(key)
+	if err == ErrStoreNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3Store) head(key string) (*s3.HeadObjectOutput, error) {
+	head, err := s3.New(s.session).HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.options.S3Bucket),
+		Key:    aws.String(key),
+	})
+	return head, s3Error(err)
+}
+
+// s3Error turns the ways S3 says a key doesn't exist into ErrStoreNotFound
+func s3Error(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "NotFound", "NoSuchKey":
+			return ErrStoreNotFound
+		}
+	}
+	return err
+}
+
+// Open returns the body of options.Bucket + key.
+func (s *S3Store) Open(key string) (io.ReadCloser, error) {
+	object, err := s3.New(s.session).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.options.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return object.Body, nil
+}
+
+// Stat returns the details of options.Bucket + key.
+func (s *S3Store) Stat(key string) (*StoreObject, error) {
+	head, err := s.head(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StoreObject{
+		Key:          key,
+		Size:         aws.Int64Value(head.ContentLength),
+		LastModified: aws.TimeValue(head.LastModified),
+	}, nil
+}
+
+// List returns the keys in options.Bucket that start with prefix.
+func (s *S3Store) List(prefix string) ([]*StoreObject, error) {
+	objects := []*StoreObject{}
+	err := s3.New(s.session).ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(s.options.S3Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, content := range page.Contents {
+			objects = append(objects, &StoreObject{
+				Key:          aws.StringValue(content.Key),
+				Size:         aws.Int64Value(content.Size),
+				LastModified: aws.TimeValue(content.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(storeObjectsByKey(objects))
+	return objects, nil
+}
+
+// Delete removes options.Bucket + key. S3 doesn't complain about keys that
+// don't exist, so we check first.
+func (s *S3Store) Delete(key string) error {
+	if _, err := s.head(key); err != nil {
+		return err
+	}
+	_, err := s3.New(s.session).DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.options.S3Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// DownloadToFile copies options.Bucket + args.Key to the file at args.Path.
+func (s *S3Store) DownloadToFile(args *DownloadToFileArgs) error {
+	if args.MaxTries == 0 {
+		args.MaxTries = 1
+	}
+
+	logger := s.logger.WithFields(util.LogFields{
+		"Bucket":   s.options.S3Bucket,
+		"Path":     args.Path,
+		"Region":   s.options.AWSRegion,
+		"S3Key":    args.Key,
+		"MaxTries": args.MaxTries,
+	})
+	logger.Info("Downloading file from S3")
+
+	if args.MaxSize > 0 {
+		head, err := s.head(args.Key)
+		if err != nil {
+			return err
+		}
+		if aws.Int64Value(head.ContentLength) > args.MaxSize {
+			return ErrStoreTooLarge
+		}
+	}
+
+	file, err := os.Create(args.Path)
+	if err != nil {
+		logger.WithField("Error", err).Error("Unable to create output file")
+		return err
+	}
+	defer file.Close()
+
+	var outerErr error
+	downloadManager := s3manager.NewDownloader(s.session, func(d *s3manager.Downloader) {
+		d.PartSize = s.options.S3PartSize
+	})
+	for try := 1; try <= args.MaxTries; try++ {
+		_, err = downloadManager.Download(file, &s3.GetObjectInput{
+			Bucket: aws.String(s.options.S3Bucket),
+			Key:    aws.String(args.Key),
+		})
+		err = s3Error(err)
+		if err == ErrStoreNotFound {
+			return err
+		}
+
+		if err != nil {
+			logger.WithField("Try", try).Error("Unable to download file from S3")
+			outerErr = err
+			continue
+		}
+
+		logger.WithField("Try", try).Info("Downloading file from S3 complete")
+		return nil
+	}
+
+	return outerErr
+}
@@ -0,0 +1,153 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+// fakeS3 is a stand-in for the parts of the S3 API that S3Store uses, it
+// only understands path-style requests: /bucket/key
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string]*fakeS3Object
+}
+
+type fakeS3Object struct {
+	body     []byte
+	modified time.Time
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name        string          `xml:"Name"`
+	Prefix      string          `xml:"Prefix"`
+	IsTruncated bool            `xml:"IsTruncated"`
+	Contents    []fakeS3Content `xml:"Contents"`
+}
+
+type fakeS3Content struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]*fakeS3Object{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	if len(parts) == 1 || parts[1] == "" {
+		f.list(w, r, bucket)
+		return
+	}
+	id := bucket + "/" + parts[1]
+
+	switch r.Method {
+	case "PUT":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f.objects[id] = &fakeS3Object{body: body, modified: time.Now()}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(body)))
+	case "GET", "HEAD":
+		object, ok := f.objects[id]
+		if !ok {
+			f.notFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, id, object.modified, bytes.NewReader(object.body))
+	case "DELETE":
+		delete(f.objects, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	result := fakeS3ListResult{Name: bucket, Prefix: prefix}
+	ids := []string{}
+	for id := range f.objects {
+		if strings.HasPrefix(id, bucket+"/"+prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		object := f.objects[id]
+		result.Contents = append(result.Contents, fakeS3Content{
+			Key:          strings.TrimPrefix(id, bucket+"/"),
+			Size:         int64(len(object.body)),
+			LastModified: object.modified.UTC().Format("2006-01-02T15:04:05.000Z"),
+		})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) notFound(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != "HEAD" {
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+	}
+}
+
+func TestS3StoreConformance(t *testing.T) {
+	server := httptest.NewServer(newFakeS3())
+	defer server.Close()
+
+	// Every test gets its own bucket
+	buckets := 0
+	suiteTester := &StoreConformanceSuite{
+		TestSuite: &util.TestSuite{},
+		newStore: func(dir string) Store {
+			buckets++
+			return NewS3Store(&AWSOptions{
+				AWSAccessKeyID:     "access-key",
+				AWSSecretAccessKey: "secret-key",
+				AWSRegion:          "us-east-1",
+				S3Bucket:           fmt.Sprintf("bucket-%d", buckets),
+				S3PartSize:         5 * 1024 * 1024,
+				S3Endpoint:         server.URL,
+				S3ForcePathStyle:   true,
+			})
+		},
+	}
+	suite.Run(t, suiteTester)
+}
@@ -0,0 +1,295 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wercker/wercker/util"
+)
+
+// SecretsKeyEnv holds the base64 key of the secrets file, it is used instead
+// of the key file when it is set
+const SecretsKeyEnv = "WERCKER_SECRETS_KEY"
+
+// secretsHeader is the first line of a secrets file, the rest is the base64
+// nonce and AES-256-GCM sealed variables
+const secretsHeader = "wercker-secrets v1 aes-256-gcm"
+
+// secretsKeySize is the size of an AES-256 key
+const secretsKeySize = 32
+
+var secretNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ErrSecretsKeyNotFound is returned when there is neither a key file nor a
+// key in the env
+var ErrSecretsKeyNotFound = fmt.Errorf("No secrets key found, set %s or create a key file", SecretsKeyEnv)
+
+// SecretsOptions for the secrets commands and for loading the secrets file
+// into the hidden env
+type SecretsOptions struct {
+	*GlobalOptions
+	SecretsFile    string
+	SecretsKeyFile string
+}
+
+// NewSecretsOptions constructor
+func NewSecretsOptions(c util.Settings, e *util.Environment) (*SecretsOptions, error) {
+	globalOpts, err := NewGlobalOptions(c, e)
+	if err != nil {
+		return nil, err
+	}
+
+	secretsFile, _ := c.GlobalString("secrets-file")
+	secretsKeyFile, _ := c.GlobalString("secrets-key-file")
+	secretsKeyFile = util.ExpandHomePath(secretsKeyFile, e.Get("HOME"))
+
+	return &SecretsOptions{
+		GlobalOptions:  globalOpts,
+		SecretsFile:    secretsFile,
+		SecretsKeyFile: secretsKeyFile,
+	}, nil
+}
+
+// ReadSecretsKey reads the key from the env or, when it isn't set there,
+// from keyFile
+func ReadSecretsKey(keyFile string, e *util.Environment) ([]byte, error) {
+	encoded := e.Get(SecretsKeyEnv)
+	if encoded == "" {
+		data, err := ioutil.ReadFile(keyFile)
+		if os.IsNotExist(err) {
+			return nil, ErrSecretsKeyNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid secrets key: %s", err)
+	}
+	if len(key) != secretsKeySize {
+		return nil, fmt.Errorf("Invalid secrets key: need %d bytes, got %d", secretsKeySize, len(key))
+	}
+	return key, nil
+}
+
+// GenerateSecretsKey writes a new random key to keyFile, readable only by
+// the user
+func GenerateSecretsKey(keyFile string) ([]byte, error) {
+	key := make([]byte, secretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	file, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(encoded); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncryptSecrets seals the variables with key
+func EncryptSecrets(key []byte, secrets map[string]string) ([]byte, error) {
+	gcm, err := newSecretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, FormatSecrets(secrets), []byte(secretsHeader))
+
+	b := &bytes.Buffer{}
+	b.WriteString(secretsHeader + "\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(sealed) + "\n")
+	return b.Bytes(), nil
+}
+
+// DecryptSecrets opens a secrets file sealed by EncryptSecrets
+func DecryptSecrets(key []byte, data []byte) (map[string]string, error) {
+	lines := strings.SplitN(string(data), "\n", 2)
+	if len(lines) != 2 || strings.TrimSpace(lines[0]) != secretsHeader {
+		return nil, errors.New("Not a wercker secrets file")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid secrets file: %s", err)
+	}
+
+	gcm, err := newSecretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Invalid secrets file: too short")
+	}
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(secretsHeader))
+	if err != nil {
+		return nil, errors.New("Unable to decrypt secrets file, wrong key?")
+	}
+	return ParseSecrets(plain)
+}
+
+func newSecretsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadSecrets reads and decrypts the secrets file at path
+func ReadSecrets(path string, key []byte) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptSecrets(key, data)
+}
+
+// WriteSecrets encrypts the secrets and replaces the file at path with them
+func WriteSecrets(path string, key []byte, secrets map[string]string) error {
+	data, err := EncryptSecrets(key, secrets)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".wercker-secrets-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ParseSecrets reads NAME=value lines, values may be quoted like Go strings
+// to hold newlines. Empty lines and lines starting with # are skipped.
+func ParseSecrets(data []byte) (map[string]string, error) {
+	secrets := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Line %d: expected NAME=value", n)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if err := ValidateSecretName(name); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", n, err)
+		}
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: invalid quoted value", n)
+			}
+			value = unquoted
+		}
+		secrets[name] = value
+	}
+	return secrets, scanner.Err()
+}
+
+// FormatSecrets writes the secrets as sorted NAME=value lines for
+// ParseSecrets
+func FormatSecrets(secrets map[string]string) []byte {
+	b := &bytes.Buffer{}
+	for _, name := range SecretNames(secrets) {
+		value := secrets[name]
+		if strings.ContainsAny(value, "\r\n") || strings.HasPrefix(value, `"`) || strings.TrimSpace(value) != value {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+	}
+	return b.Bytes()
+}
+
+// SecretNames returns the sorted names of the secrets
+func SecretNames(secrets map[string]string) []string {
+	names := []string{}
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateSecretName checks that name can be used as an env var
+func ValidateSecretName(name string) error {
+	if !secretNameRe.MatchString(name) {
+		return fmt.Errorf("Invalid secret name %q", name)
+	}
+	return nil
+}
+
+// LoadSecrets decrypts the secrets file, when there is one, into the hidden
+// env
+func LoadSecrets(options *SecretsOptions, e *util.Environment) error {
+	if options.SecretsFile == "" {
+		return nil
+	}
+	if exists, _ := util.Exists(options.SecretsFile); !exists {
+		return nil
+	}
+	key, err := ReadSecretsKey(options.SecretsKeyFile, e)
+	if err != nil {
+		return err
+	}
+	secrets, err := ReadSecrets(options.SecretsFile, key)
+	if err != nil {
+		return err
+	}
+	if e.Hidden == nil {
+		e.Hidden = &util.Environment{}
+	}
+	for _, name := range SecretNames(secrets) {
+		e.Hidden.Add(name, secrets[name])
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type SecretsSuite struct {
+	*util.TestSuite
+}
+
+func TestSecretsSuite(t *testing.T) {
+	suiteTester := &SecretsSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *SecretsSuite) TestEncryptDecrypt() {
+	key := make([]byte, 32)
+	secrets := map[string]string{
+		"DEPLOY_TOKEN": "hunter2",
+		"SSH_KEY":      "-----BEGIN KEY-----\nabc\n-----END KEY-----\n",
+		"PADDED":       "  spaces ",
+	}
+	data, err := EncryptSecrets(key, secrets)
+	s.Require().Nil(err)
+	s.NotContains(string(data), "hunter2")
+
+	decrypted, err := DecryptSecrets(key, data)
+	s.Require().Nil(err)
+	s.Equal(secrets, decrypted)
+
+	other := make([]byte, 32)
+	other[0] = 1
+	_, err = DecryptSecrets(other, data)
+	s.NotNil(err)
+
+	_, err = DecryptSecrets(key, []byte("DEPLOY_TOKEN=hunter2\n"))
+	s.NotNil(err)
+}
+
+func (s *SecretsSuite) TestParseSecrets() {
+	secrets, err := ParseSecrets([]byte("# deploy\nTOKEN = abc\n\nMULTI=\"a\\nb\"\n"))
+	s.Require().Nil(err)
+	s.Equal(map[string]string{"TOKEN": "abc", "MULTI": "a\nb"}, secrets)
+
+	_, err = ParseSecrets([]byte("NO VALUE\n"))
+	s.NotNil(err)
+	_, err = ParseSecrets([]byte("1BAD=name\n"))
+	s.NotNil(err)
+}
+
+func (s *SecretsSuite) TestLoadSecrets() {
+	keyFile := filepath.Join(s.WorkingDir(), "secrets.key")
+	key, err := GenerateSecretsKey(keyFile)
+	s.Require().Nil(err)
+	_, err = GenerateSecretsKey(keyFile)
+	s.NotNil(err, "an existing key is not overwritten")
+
+	secretsFile := filepath.Join(s.WorkingDir(), "SECRETS")
+	s.Require().Nil(WriteSecrets(secretsFile, key, map[string]string{"TOKEN": "hunter2"}))
+
+	env := util.NewEnvironment("PUBLIC=foo")
+	options := &SecretsOptions{SecretsFile: secretsFile, SecretsKeyFile: keyFile}
+	s.Require().Nil(LoadSecrets(options, env))
+	s.Equal("hunter2", env.Hidden.Get("TOKEN"))
+	s.Equal("", env.Get("TOKEN"))
+
+	// The key in the env is used instead of the key file
+	env = util.NewEnvironment(SecretsKeyEnv + "=" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	s.NotNil(LoadSecrets(options, env))
+
+	// Without a secrets file there is nothing to load
+	options.SecretsFile = filepath.Join(s.WorkingDir(), "missing")
+	s.Nil(LoadSecrets(options, util.NewEnvironment()))
+}
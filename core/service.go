@@ -22,9 +22,16 @@ import (
 
 // ServiceBox interface to services
 type ServiceBox interface {
-	Run(context.Context, *util.Environment, []string) (*docker.Container, error)
+	// Run starts the service on a network, with the link environment of the
+	// services started before it
+	Run(context.Context, *util.Environment, string, []string) (*docker.Container, error)
 	Fetch(ctx context.Context, env *util.Environment) (*docker.Image, error)
-	Link() string
+	Alias() string
+	LinkEnv() []string
 	GetID() string
 	GetName() string
+	// WaitHealthy blocks until the service is ready to be used
+	WaitHealthy(context.Context) error
+	// DumpLogs emits the tail of the service's output
+	DumpLogs(context.Context) error
 }
@@ -72,18 +72,30 @@ type Session struct {
 	logsHidden bool
 	send       chan string
 	recv       chan string
+	recvErr    chan string
 	exit       chan int
+	protocol   Protocol
 	logger     *util.LogEntry
+	step       Step
+	order      int
+	// Overrides for the timeouts in options, in milliseconds
+	commandTimeout    int
+	noResponseTimeout int
 }
 
 // NewSession returns a new interactive session to a container.
 func NewSession(options *PipelineOptions, transport Transport) *Session {
 	logger := util.RootLogger().WithField("Logger", "Session")
+	var protocol Protocol = NewSentinelProtocol()
+	if t, ok := transport.(ProtocolTransport); ok {
+		protocol = t.Protocol()
+	}
 	return &Session{
 		options:    options,
 		transport:  transport,
 		logsHidden: false,
 		logger:     logger,
+		protocol:   protocol,
 	}
 }
 
@@ -95,6 +107,12 @@ func (s *Session) Recv() chan string {
 	return s.recv
 }
 
+// RecvErr is the stderr of the session, it is nil unless the protocol needs
+// stderr to be separate, in which case it is included in Recv.
+func (s *Session) RecvErr() chan string {
+	return s.recvErr
+}
+
 // Attach us to our container and set up read and write queues.
 // Returns a context object for the transport so we can propagate cancels
 // on errors and closed connections.
@@ -103,12 +121,58 @@ func (s *Session) Attach(runnerCtx context.Context) (context.Context, error) {
 	outputStream := NewReceiver(recv)
 	s.recv = recv
 
+	errorStream := outputStream
+	if s.protocol.SeparateStderr() {
+		recvErr := make(chan string)
+		errorStream = NewReceiver(recvErr)
+		s.recvErr = recvErr
+	}
+
 	send := make(chan string)
 	inputStream := NewSender(send)
 	s.send = send
 
 	// We treat the transport context as the session context everywhere
-	return s.transport.Attach(runnerCtx, inputStream, outputStream, outputStream)
+	sessionCtx, err := s.transport.Attach(runnerCtx, inputStream, outputStream, errorStream)
+	if err != nil {
+		return nil, err
+	}
+
+	setup := s.protocol.Setup()
+	if len(setup) > 0 {
+		err = s.Send(sessionCtx, true, setup...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sessionCtx, nil
+}
+
+// Scope makes all Logs emitted by this session belong to step, this is needed
+// when multiple sessions are running steps at the same time.
+func (s *Session) Scope(step Step, order int) {
+	s.step = step
+	s.order = order
+}
+
+// SetTimeouts overrides the CommandTimeout and NoResponseTimeout from the
+// options for the following commands, 0 means use the one from the options.
+func (s *Session) SetTimeouts(commandTimeout, noResponseTimeout int) {
+	s.commandTimeout = commandTimeout
+	s.noResponseTimeout = noResponseTimeout
+}
+
+// timeouts returns the timeouts that apply to the next command
+func (s *Session) timeouts() (time.Duration, time.Duration) {
+	commandTimeout := s.options.CommandTimeout
+	if s.commandTimeout > 0 {
+		commandTimeout = s.commandTimeout
+	}
+	noResponseTimeout := s.options.NoResponseTimeout
+	if s.noResponseTimeout > 0 {
+		noResponseTimeout = s.noResponseTimeout
+	}
+	return time.Duration(commandTimeout) * time.Millisecond, time.Duration(noResponseTimeout) * time.Millisecond
 }
 
 // HideLogs will emit Logs with args.Hidden set to true
@@ -150,6 +214,8 @@ func (s *Session) Send(sessionCtx context.Context, forceHidden bool, commands ..
 			}
 
 			e.Emit(Logs, &LogsArgs{
+				Step:   s.step,
+				Order:  s.order,
 				Hidden: hidden,
 				Stream: "stdin",
 				Logs:   command,
@@ -165,9 +231,37 @@ var randomSentinel = func() string {
 
 // CommandResult exists so that we can make a channel of them
 type CommandResult struct {
-	exit int
-	recv []string
-	err  error
+	exit     int
+	recv     []string
+	stderr   []string
+	err      error
+	duration time.Duration
+}
+
+// Exit code of the commands, -1 if there was an error getting it
+func (r *CommandResult) Exit() int {
+	return r.exit
+}
+
+// Stdout of the commands, this includes stderr unless the protocol keeps
+// them apart
+func (r *CommandResult) Stdout() []string {
+	return r.recv
+}
+
+// Stderr of the commands, only filled in if the protocol keeps it apart
+func (r *CommandResult) Stderr() []string {
+	return r.stderr
+}
+
+// Duration is the time it took for the result to come back
+func (r *CommandResult) Duration() time.Duration {
+	return r.duration
+}
+
+// Err is set if the commands failed, timed out or the session went away
+func (r *CommandResult) Err() error {
+	return r.err
 }
 
 func checkLine(line, sentinel string) (bool, int) {
@@ -223,21 +317,31 @@ func smartSplitLines(line, sentinel string) []string {
 // SendChecked sends commands, waits for them to complete and returns the
 // exit status and output
 // Ways to know a command is done:
-//  [x] We received the sentinel echo
+//  [x] We received the result from the protocol
 //  [x] The container has exited and we've exhausted the incoming data
 //  [x] The session has closed and we've exhaused the incoming data
 //  [x] The command has timed out
 // Ways for a command to be successful:
-//  [x] We received the sentinel echo with exit code 0
+//  [x] We received the result from the protocol with exit code 0
 func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (int, []string, error) {
+	r := s.Run(sessionCtx, commands...)
+	return r.exit, r.recv, r.err
+}
+
+// Run sends commands like SendChecked and returns the full CommandResult.
+func (s *Session) Run(sessionCtx context.Context, commands ...string) *CommandResult {
 	e, err := EmitterFromContext(sessionCtx)
 	if err != nil {
-		return -1, []string{}, err
+		return &CommandResult{exit: -1, recv: []string{}, err: err}
 	}
 	recv := []string{}
+	stderr := []string{}
 	sentinel := randomSentinel()
+	scanner := s.protocol.NewScanner(sentinel)
+	started := time.Now()
 
-	sendCtx, _ := context.WithTimeout(sessionCtx, time.Duration(s.options.CommandTimeout)*time.Millisecond)
+	commandTimeout, noResponseTimeout := s.timeouts()
+	sendCtx, _ := context.WithTimeout(sessionCtx, commandTimeout)
 
 	commandComplete := make(chan CommandResult)
 
@@ -258,27 +362,27 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 			if exit != 0 {
 				err = fmt.Errorf("Command exited with exit code: %d", exit)
 			}
-			commandComplete <- CommandResult{exit: exit, recv: recv, err: err}
+			commandComplete <- CommandResult{exit: exit, recv: recv, stderr: stderr, err: err}
 		case err = <-errChan:
-			commandComplete <- CommandResult{exit: -1, recv: recv, err: err}
+			commandComplete <- CommandResult{exit: -1, recv: recv, stderr: stderr, err: err}
 		case <-sendCtx.Done():
 			// We timed out or something closed, try to read in the rest of the data
 			// over the next 100 milliseconds and then return
 			<-time.After(time.Duration(100) * time.Millisecond)
 			// close(stopReading)
 			stopReading <- struct{}{}
-			commandComplete <- CommandResult{exit: -1, recv: recv, err: sendCtx.Err()}
+			commandComplete <- CommandResult{exit: -1, recv: recv, stderr: stderr, err: sendCtx.Err()}
 		}
 	}()
 
 	// If we don't get a response in a certain amount of time, timeout
-	noResponseTimeout := make(chan struct{})
+	noResponseTimeoutChan := make(chan struct{})
 	go func() {
 		for {
 			select {
-			case <-noResponseTimeout:
+			case <-noResponseTimeoutChan:
 				continue
-			case <-time.After(time.Duration(s.options.NoResponseTimeout) * time.Millisecond):
+			case <-time.After(noResponseTimeout):
 				stopReading <- struct{}{}
 				errChan <- fmt.Errorf("Command timed out after no response")
 				return
@@ -286,31 +390,52 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 		}
 	}()
 
-	// Read in data until we get our sentinel or are asked to stop
+	// handle passes output through the protocol's scanner, it returns true
+	// once we have the result
+	handle := func(stream, chunk string) bool {
+		// If we found a line reset the NoResponseTimeout timer
+		noResponseTimeoutChan <- struct{}{}
+		output, frame, exit := scanner.Scan(stream, chunk)
+		for _, subline := range output {
+			e.Emit(Logs, &LogsArgs{
+				Step:   s.step,
+				Order:  s.order,
+				Hidden: s.logsHidden,
+				Stream: stream,
+				Logs:   subline,
+			})
+			if stream == "stderr" {
+				stderr = append(stderr, subline)
+			} else {
+				recv = append(recv, subline)
+			}
+		}
+		// If we found the exit code, we're done
+		if frame != "" {
+			e.Emit(Logs, &LogsArgs{
+				Step:   s.step,
+				Order:  s.order,
+				Hidden: true,
+				Stream: stream,
+				Logs:   frame,
+			})
+			exitChan <- exit
+			return true
+		}
+		return false
+	}
+
+	// Read in data until we get our result or are asked to stop
 	go func() {
 		for {
 			select {
 			case line := <-s.recv:
-				// If we found a line reset the NoResponseTimeout timer
-				noResponseTimeout <- struct{}{}
-				lines := smartSplitLines(line, sentinel)
-				for _, subline := range lines {
-					// subline = fmt.Sprintf("%s\n", subline)
-					// If we found the exit code, we're done
-					foundExit, exit := checkLine(subline, sentinel)
-					if foundExit {
-						e.Emit(Logs, &LogsArgs{
-							Hidden: true,
-							Logs:   subline,
-						})
-						exitChan <- exit
-						return
-					}
-					e.Emit(Logs, &LogsArgs{
-						Hidden: s.logsHidden,
-						Logs:   subline,
-					})
-					recv = append(recv, subline)
+				if handle("stdout", line) {
+					return
+				}
+			case line := <-s.recvErr:
+				if handle("stderr", line) {
+					return
 				}
 			case <-stopReading:
 				return
@@ -320,19 +445,21 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 
 	err = s.Send(sessionCtx, false, commands...)
 	if err != nil {
-		return -1, []string{}, err
+		return &CommandResult{exit: -1, recv: []string{}, err: err}
 	}
-	err = s.Send(sessionCtx, true, fmt.Sprintf("echo %s $?", sentinel))
+	err = s.Send(sessionCtx, true, s.protocol.Terminator(sentinel))
 	if err != nil {
-		return -1, []string{}, err
+		return &CommandResult{exit: -1, recv: []string{}, err: err}
 	}
 
 	r := <-commandComplete
+	r.duration = time.Since(started)
 	// Pretty up the error messages
 	if r.err == context.DeadlineExceeded {
 		r.err = fmt.Errorf("Command timed out")
 	} else if r.err == context.Canceled {
 		r.err = fmt.Errorf("Command cancelled due to error")
 	}
-	return r.exit, r.recv, r.err
+	s.logger.Debugln("Command finished in", r.duration, "with exit code", r.exit)
+	return &r
 }
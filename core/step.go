@@ -90,6 +90,10 @@ type Step interface {
 	Version() string
 	ShouldSyncEnv() bool
 	Checkpoint() string
+	When() string
+	Timeout() int
+	NoResponseTimeout() int
+	Retry() *RetryConfig
 
 	// Actual methods
 	Fetch() (string, error)
@@ -105,41 +109,53 @@ type Step interface {
 // BaseStepOptions are exported fields so that we can make a BaseStep from
 // other packages, see: https://gist.github.com/termie/8b66a2b4206e8e042766
 type BaseStepOptions struct {
-	DisplayName string
-	Env         *util.Environment
-	ID          string
-	Name        string
-	Owner       string
-	SafeID      string
-	Version     string
-	Cwd         string
-	Checkpoint  string
+	DisplayName       string
+	Env               *util.Environment
+	ID                string
+	Name              string
+	Owner             string
+	SafeID            string
+	Version           string
+	Cwd               string
+	Checkpoint        string
+	When              string
+	Timeout           int
+	NoResponseTimeout int
+	Retry             *RetryConfig
 }
 
 // BaseStep type for extending
 type BaseStep struct {
-	displayName string
-	env         *util.Environment
-	id          string
-	name        string
-	owner       string
-	safeID      string
-	version     string
-	cwd         string
-	checkpoint  string
+	displayName       string
+	env               *util.Environment
+	id                string
+	name              string
+	owner             string
+	safeID            string
+	version           string
+	cwd               string
+	checkpoint        string
+	when              string
+	timeout           int
+	noResponseTimeout int
+	retry             *RetryConfig
 }
 
 func NewBaseStep(args BaseStepOptions) *BaseStep {
 	return &BaseStep{
-		displayName: args.DisplayName,
-		env:         args.Env,
-		id:          args.ID,
-		name:        args.Name,
-		owner:       args.Owner,
-		safeID:      args.SafeID,
-		version:     args.Version,
-		cwd:         args.Cwd,
-		checkpoint:  args.Checkpoint,
+		displayName:       args.DisplayName,
+		env:               args.Env,
+		id:                args.ID,
+		name:              args.Name,
+		owner:             args.Owner,
+		safeID:            args.SafeID,
+		version:           args.Version,
+		cwd:               args.Cwd,
+		checkpoint:        args.Checkpoint,
+		when:              args.When,
+		timeout:           args.Timeout,
+		noResponseTimeout: args.NoResponseTimeout,
+		retry:             args.Retry,
 	}
 }
 
@@ -188,6 +204,26 @@ func (s *BaseStep) Checkpoint() string {
 	return s.checkpoint
 }
 
+// When getter, the expression that decides whether the step runs
+func (s *BaseStep) When() string {
+	return s.when
+}
+
+// Timeout getter, in minutes, 0 if not set for this step
+func (s *BaseStep) Timeout() int {
+	return s.timeout
+}
+
+// NoResponseTimeout getter, in minutes, 0 if not set for this step
+func (s *BaseStep) NoResponseTimeout() int {
+	return s.noResponseTimeout
+}
+
+// Retry getter, nil if the step should not be retried
+func (s *BaseStep) Retry() *RetryConfig {
+	return s.retry
+}
+
 // ExternalStep is the holder of the Step methods.
 type ExternalStep struct {
 	*BaseStep
@@ -263,15 +299,19 @@ func NewStep(stepConfig *StepConfig, options *PipelineOptions) (*ExternalStep, e
 
 	return &ExternalStep{
 		BaseStep: &BaseStep{
-			displayName: displayName,
-			env:         util.NewEnvironment(),
-			id:          identifier,
-			name:        name,
-			owner:       owner,
-			safeID:      stepSafeID,
-			version:     version,
-			cwd:         stepConfig.Cwd,
-			checkpoint:  stepConfig.Checkpoint,
+			displayName:       displayName,
+			env:               util.NewEnvironment(),
+			id:                identifier,
+			name:              name,
+			owner:             owner,
+			safeID:            stepSafeID,
+			version:           version,
+			cwd:               stepConfig.Cwd,
+			checkpoint:        stepConfig.Checkpoint,
+			when:              stepConfig.When,
+			timeout:           stepConfig.Timeout,
+			noResponseTimeout: stepConfig.NoResponseTimeout,
+			retry:             stepConfig.Retry,
 		},
 		options: options,
 		data:    data,
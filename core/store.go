@@ -14,12 +14,54 @@
 
 package core
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrStoreTooLarge is returned when a file in the store is larger than
+	// the caller allows
+	ErrStoreTooLarge = errors.New("file in store exceeds the maximum size")
+
+	// ErrStoreNotFound is returned when there is no file under a key
+	ErrStoreNotFound = errors.New("file not found in store")
+)
 
 // Store is generic store interface
 type Store interface {
 	// StoreFromFile copies a file from local disk to the store
 	StoreFromFile(*StoreFromFileArgs) error
+
+	// DownloadToFile copies a file from the store to local disk
+	DownloadToFile(*DownloadToFileArgs) error
+
+	// Exists checks whether a key is present in the store
+	Exists(key string) (bool, error)
+
+	// Open returns a reader for the file stored under key
+	Open(key string) (io.ReadCloser, error)
+
+	// Stat returns the details of the file stored under key
+	Stat(key string) (*StoreObject, error)
+
+	// List returns the files whose key starts with prefix, sorted by key
+	List(prefix string) ([]*StoreObject, error)
+
+	// Delete removes the file stored under key
+	Delete(key string) error
+}
+
+// StoreObject describes a file in the store
+type StoreObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
 }
 
 // StoreFromFileArgs are the args for storing a file
@@ -40,6 +82,151 @@ type StoreFromFileArgs struct {
 	MaxTries int
 }
 
+// DownloadToFileArgs are the args for downloading a file
+type DownloadToFileArgs struct {
+	// Key of the file as stored in the store.
+	Key string
+
+	// Path to the local file, it will be overwritten.
+	Path string
+
+	// MaxSize is the largest file we are willing to download, 0 means no
+	// limit. Stores return ErrStoreTooLarge if the file is larger.
+	MaxSize int64
+
+	// MaxTries is the maximum that a store should retry should the store fail.
+	MaxTries int
+}
+
+// NewStoreFromURL returns a Store for a url like s3://bucket/prefix or
+// file:///some/dir. S3 stores use the credentials and endpoint from options,
+// another S3-compatible endpoint can be given with ?endpoint=http://host:port.
+func NewStoreFromURL(rawurl string, options *AWSOptions) (Store, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("Store url %s is missing a bucket", rawurl)
+		}
+		return NewPrefixStore(NewS3Store(storeS3Options(u, options)), u.Path), nil
+	case "file":
+		if u.Host != "" || u.Path == "" {
+			return nil, fmt.Errorf("Store url %s needs an absolute path, like file:///srv/wercker", rawurl)
+		}
+		return NewLocalStore(u.Path), nil
+	}
+	return nil, fmt.Errorf("Unknown store url %s, expected s3:// or file://", rawurl)
+}
+
+// StoreBaseURL returns the url that the keys of the store at rawurl are
+// relative to, like file:///some/dir or https://s3.amazonaws.com/bucket/prefix
+func StoreBaseURL(rawurl string, options *AWSOptions) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "s3":
+		bucketURL := storeS3Options(u, options).S3BucketURL(u.Host)
+		return strings.TrimSuffix(bucketURL+u.Path, "/"), nil
+	case "file":
+		return strings.TrimSuffix(fmt.Sprintf("file://%s", u.Path), "/"), nil
+	}
+	return "", fmt.Errorf("Unknown store url %s, expected s3:// or file://", rawurl)
+}
+
+// storeS3Options copies options for the bucket in an s3:// store url, an
+// ?endpoint= in the url overrides the configured endpoint and uses path-style
+// addressing
+func storeS3Options(u *url.URL, options *AWSOptions) *AWSOptions {
+	s3Options := AWSOptions{}
+	if options != nil {
+		s3Options = *options
+	}
+	s3Options.S3Bucket = u.Host
+	if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+		s3Options.S3Endpoint = endpoint
+		s3Options.S3ForcePathStyle = true
+	}
+	if s3Options.S3PartSize == 0 {
+		s3Options.S3PartSize = 100 * 1024 * 1024 // 100 MB
+	}
+	return &s3Options
+}
+
+// NewPrefixStore wraps a Store so that all keys are placed under prefix
+func NewPrefixStore(store Store, prefix string) Store {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return store
+	}
+	return &PrefixStore{store: store, prefix: prefix}
+}
+
+// PrefixStore places all keys of the wrapped Store under a prefix
+type PrefixStore struct {
+	store  Store
+	prefix string
+}
+
+func (s *PrefixStore) key(key string) string {
+	return path.Join(s.prefix, key)
+}
+
+// StoreFromFile stores the file under the prefixed key
+func (s *PrefixStore) StoreFromFile(args *StoreFromFileArgs) error {
+	prefixed := *args
+	prefixed.Key = s.key(args.Key)
+	return s.store.StoreFromFile(&prefixed)
+}
+
+// DownloadToFile downloads the file from the prefixed key
+func (s *PrefixStore) DownloadToFile(args *DownloadToFileArgs) error {
+	prefixed := *args
+	prefixed.Key = s.key(args.Key)
+	return s.store.DownloadToFile(&prefixed)
+}
+
+// Exists checks the prefixed key
+func (s *PrefixStore) Exists(key string) (bool, error) {
+	return s.store.Exists(s.key(key))
+}
+
+// Open opens the prefixed key
+func (s *PrefixStore) Open(key string) (io.ReadCloser, error) {
+	return s.store.Open(s.key(key))
+}
+
+// Stat returns the details of the prefixed key, without the prefix
+func (s *PrefixStore) Stat(key string) (*StoreObject, error) {
+	object, err := s.store.Stat(s.key(key))
+	if err != nil {
+		return nil, err
+	}
+	object.Key = key
+	return object, nil
+}
+
+// List lists the keys under the prefix, without the prefix
+func (s *PrefixStore) List(prefix string) ([]*StoreObject, error) {
+	objects, err := s.store.List(s.prefix + "/" + prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		object.Key = strings.TrimPrefix(object.Key, s.prefix+"/")
+	}
+	return objects, nil
+}
+
+// Delete removes the prefixed key
+func (s *PrefixStore) Delete(key string) error {
+	return s.store.Delete(s.key(key))
+}
+
 // GenerateBaseKey generates the base key based on ApplicationID and either
 // DeployID or BuilID
 func GenerateBaseKey(options *PipelineOptions) string {
@@ -0,0 +1,182 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+// StoreConformanceSuite checks the behaviour all the Stores share, newStore
+// returns an empty store for every test.
+type StoreConformanceSuite struct {
+	*util.TestSuite
+	newStore func(dir string) Store
+	store    Store
+}
+
+func TestLocalStoreConformance(t *testing.T) {
+	suiteTester := &StoreConformanceSuite{
+		TestSuite: &util.TestSuite{},
+		newStore: func(dir string) Store {
+			return NewLocalStore(filepath.Join(dir, "store"))
+		},
+	}
+	suite.Run(t, suiteTester)
+}
+
+func TestPrefixStoreConformance(t *testing.T) {
+	suiteTester := &StoreConformanceSuite{
+		TestSuite: &util.TestSuite{},
+		newStore: func(dir string) Store {
+			return NewPrefixStore(NewLocalStore(filepath.Join(dir, "store")), "some/prefix")
+		},
+	}
+	suite.Run(t, suiteTester)
+}
+
+func (s *StoreConformanceSuite) SetupTest() {
+	s.TestSuite.SetupTest()
+	s.store = s.newStore(s.WorkingDir())
+}
+
+func (s *StoreConformanceSuite) put(key, content string) {
+	src, err := ioutil.TempFile(s.WorkingDir(), "src")
+	s.Require().Nil(err)
+	_, err = src.WriteString(content)
+	src.Close()
+	s.Require().Nil(err)
+	err = s.store.StoreFromFile(&StoreFromFileArgs{Path: src.Name(), Key: key})
+	s.Require().Nil(err)
+}
+
+func (s *StoreConformanceSuite) read(key string) string {
+	r, err := s.store.Open(key)
+	s.Require().Nil(err)
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	s.Require().Nil(err)
+	return string(content)
+}
+
+func (s *StoreConformanceSuite) TestStoreAndOpen() {
+	s.put("build/1/artifacts.tar", "artifacts")
+	s.Equal("artifacts", s.read("build/1/artifacts.tar"))
+
+	exists, err := s.store.Exists("build/1/artifacts.tar")
+	s.Nil(err)
+	s.True(exists)
+
+	// Storing again replaces the file
+	s.put("build/1/artifacts.tar", "new artifacts")
+	s.Equal("new artifacts", s.read("build/1/artifacts.tar"))
+}
+
+func (s *StoreConformanceSuite) TestStoredFileMode() {
+	s.put("build/1/artifacts.tar", "artifacts")
+
+	// The stores in this suite are all backed by a directory
+	files := 0
+	err := filepath.Walk(filepath.Join(s.WorkingDir(), "store"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		files++
+		s.Equal(os.FileMode(0644), info.Mode().Perm(), path)
+		return nil
+	})
+	s.Nil(err)
+	s.Equal(1, files)
+}
+
+func (s *StoreConformanceSuite) TestMissing() {
+	exists, err := s.store.Exists("missing")
+	s.Nil(err)
+	s.False(exists)
+
+	_, err = s.store.Open("missing")
+	s.Equal(ErrStoreNotFound, err)
+	_, err = s.store.Stat("missing")
+	s.Equal(ErrStoreNotFound, err)
+	err = s.store.Delete("missing")
+	s.Equal(ErrStoreNotFound, err)
+	err = s.store.DownloadToFile(&DownloadToFileArgs{Key: "missing", Path: filepath.Join(s.WorkingDir(), "dst")})
+	s.Equal(ErrStoreNotFound, err)
+}
+
+func (s *StoreConformanceSuite) TestStat() {
+	s.put("build/1/artifacts.tar", "artifacts")
+	object, err := s.store.Stat("build/1/artifacts.tar")
+	s.Require().Nil(err)
+	s.Equal("build/1/artifacts.tar", object.Key)
+	s.Equal(int64(len("artifacts")), object.Size)
+	s.False(object.LastModified.IsZero())
+}
+
+func (s *StoreConformanceSuite) TestList() {
+	s.put("build/2/artifacts.tar", "two")
+	s.put("build/1/artifacts.tar", "one")
+	s.put("deploy/1/artifacts.tar", "deploy")
+
+	objects, err := s.store.List("build/")
+	s.Require().Nil(err)
+	s.Require().Len(objects, 2)
+	s.Equal("build/1/artifacts.tar", objects[0].Key)
+	s.Equal(int64(3), objects[0].Size)
+	s.Equal("build/2/artifacts.tar", objects[1].Key)
+
+	objects, err = s.store.List("")
+	s.Nil(err)
+	s.Len(objects, 3)
+
+	objects, err = s.store.List("nothing/")
+	s.Nil(err)
+	s.Len(objects, 0)
+}
+
+func (s *StoreConformanceSuite) TestDelete() {
+	s.put("build/1/artifacts.tar", "one")
+	s.put("build/2/artifacts.tar", "two")
+
+	err := s.store.Delete("build/1/artifacts.tar")
+	s.Require().Nil(err)
+	exists, err := s.store.Exists("build/1/artifacts.tar")
+	s.Nil(err)
+	s.False(exists)
+
+	objects, err := s.store.List("build/")
+	s.Nil(err)
+	s.Require().Len(objects, 1)
+	s.Equal("build/2/artifacts.tar", objects[0].Key)
+}
+
+func (s *StoreConformanceSuite) TestDownloadToFile() {
+	s.put("cache.tar", "cached")
+	dst := filepath.Join(s.WorkingDir(), "dst")
+
+	err := s.store.DownloadToFile(&DownloadToFileArgs{Key: "cache.tar", Path: dst, MaxSize: 100})
+	s.Require().Nil(err)
+	content, err := ioutil.ReadFile(dst)
+	s.Nil(err)
+	s.Equal("cached", string(content))
+
+	err = s.store.DownloadToFile(&DownloadToFileArgs{Key: "cache.tar", Path: dst, MaxSize: 3})
+	s.Equal(ErrStoreTooLarge, err)
+}
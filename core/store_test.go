@@ -0,0 +1,194 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type StoreSuite struct {
+	*util.TestSuite
+}
+
+func TestStoreSuite(t *testing.T) {
+	suiteTester := &StoreSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *StoreSuite) TestNewStoreFromURL() {
+	store, err := NewStoreFromURL("file:///shared/wercker", nil)
+	s.Require().Nil(err)
+	local, ok := store.(*LocalStore)
+	s.Require().True(ok)
+	s.Equal("/shared/wercker", local.root)
+
+	store, err = NewStoreFromURL("s3://caches/ci/wercker?endpoint=http://minio:9000", &AWSOptions{AWSRegion: "us-east-1"})
+	s.Require().Nil(err)
+	prefixed, ok := store.(*PrefixStore)
+	s.Require().True(ok)
+	s.Equal("ci/wercker", prefixed.prefix)
+	s3store, ok := prefixed.store.(*S3Store)
+	s.Require().True(ok)
+	s.Equal("caches", s3store.options.S3Bucket)
+	s.Equal("http://minio:9000", s3store.options.S3Endpoint)
+
+	_, err = NewStoreFromURL("s3:///no-bucket", nil)
+	s.NotNil(err)
+	_, err = NewStoreFromURL("ftp://example.com/caches", nil)
+	s.NotNil(err)
+	_, err = NewStoreFromURL("file://relative/dir", nil)
+	s.NotNil(err)
+}
+
+func (s *StoreSuite) TestStoreBaseURL() {
+	tests := []struct {
+		store    string
+		expected string
+	}{
+		{"file:///srv/artifacts/", "file:///srv/artifacts"},
+		{"s3://bucket", "https://s3.amazonaws.com/bucket"},
+		{"s3://bucket/prefix", "https://s3.amazonaws.com/bucket/prefix"},
+		{"s3://bucket/prefix?endpoint=http://minio:9000/", "http://minio:9000/bucket/prefix"},
+	}
+	for _, test := range tests {
+		baseURL, err := StoreBaseURL(test.store, nil)
+		s.Nil(err)
+		s.Equal(test.expected, baseURL, test.store)
+	}
+
+	// The configured endpoint is used unless the url has its own
+	options := &AWSOptions{S3Endpoint: "https://ceph.example.com", S3ForcePathStyle: true}
+	baseURL, err := StoreBaseURL("s3://bucket/prefix", options)
+	s.Nil(err)
+	s.Equal("https://ceph.example.com/bucket/prefix", baseURL)
+}
+
+func (s *StoreSuite) TestS3BucketURL() {
+	options := &AWSOptions{}
+	s.Equal("https://s3.amazonaws.com/bucket", options.S3BucketURL("bucket"))
+
+	options.S3Endpoint = "https://minio.example.com:9000/"
+	s.Equal("https://bucket.minio.example.com:9000", options.S3BucketURL("bucket"))
+
+	options.S3ForcePathStyle = true
+	s.Equal("https://minio.example.com:9000/bucket", options.S3BucketURL("bucket"))
+}
+
+func (s *StoreSuite) TestLocalStore() {
+	store := NewLocalStore(filepath.Join(s.WorkingDir(), "store"))
+	src := filepath.Join(s.WorkingDir(), "src")
+	dst := filepath.Join(s.WorkingDir(), "dst")
+	err := ioutil.WriteFile(src, []byte("hello"), 0644)
+	s.Require().Nil(err)
+
+	exists, err := store.Exists("some/key")
+	s.Nil(err)
+	s.False(exists)
+
+	err = store.StoreFromFile(&StoreFromFileArgs{Path: src, Key: "some/key"})
+	s.Require().Nil(err)
+	exists, err = store.Exists("some/key")
+	s.Nil(err)
+	s.True(exists)
+
+	err = store.DownloadToFile(&DownloadToFileArgs{Key: "some/key", Path: dst})
+	s.Require().Nil(err)
+	content, err := ioutil.ReadFile(dst)
+	s.Nil(err)
+	s.Equal("hello", string(content))
+
+	err = store.DownloadToFile(&DownloadToFileArgs{Key: "some/key", Path: dst, MaxSize: 3})
+	s.Equal(ErrStoreTooLarge, err)
+
+	// Keys can't escape the root
+	s.Equal(filepath.Join(s.WorkingDir(), "store", "etc", "passwd"), store.path("../../etc/passwd"))
+}
+
+func (s *StoreSuite) TestRemoteCache() {
+	store := NewLocalStore(filepath.Join(s.WorkingDir(), "store"))
+	cache := NewRemoteCache(store, 10)
+	src := filepath.Join(s.WorkingDir(), "cache.tar")
+	dst := filepath.Join(s.WorkingDir(), "pulled.tar")
+	err := ioutil.WriteFile(src, []byte("tarball"), 0644)
+	s.Require().Nil(err)
+
+	found, err := cache.Pull("project-cache/app/cache.tar", dst)
+	s.Nil(err)
+	s.False(found)
+
+	err = cache.Push(src, "project-cache/app/cache.tar")
+	s.Require().Nil(err)
+	found, err = cache.Pull("project-cache/app/cache.tar", dst)
+	s.Require().Nil(err)
+	s.True(found)
+	content, err := ioutil.ReadFile(dst)
+	s.Nil(err)
+	s.Equal("tarball", string(content))
+
+	// A tarball that doesn't match its checksum is not used
+	err = ioutil.WriteFile(filepath.Join(s.WorkingDir(), "store", "project-cache", "app", "cache.tar"), []byte("corrupt"), 0644)
+	s.Require().Nil(err)
+	found, err = cache.Pull("project-cache/app/cache.tar", filepath.Join(s.WorkingDir(), "corrupt.tar"))
+	s.NotNil(err)
+	s.False(found)
+
+	err = ioutil.WriteFile(src, []byte("a large tarball"), 0644)
+	s.Require().Nil(err)
+	err = cache.Push(src, "project-cache/app/large.tar")
+	s.Equal(ErrStoreTooLarge, err)
+}
+
+func (s *StoreSuite) TestRemoteCacheNewest() {
+	root := filepath.Join(s.WorkingDir(), "store")
+	cache := NewRemoteCache(NewLocalStore(root), 0)
+	src := filepath.Join(s.WorkingDir(), "cache.tar")
+	err := ioutil.WriteFile(src, []byte("tarball"), 0644)
+	s.Require().Nil(err)
+
+	newest, err := cache.Newest("project-cache/app/keyed/npm-")
+	s.Nil(err)
+	s.Equal("", newest)
+
+	for i, key := range []string{"npm-master-aaa", "npm-feature-bbb", "npm-master-ccc"} {
+		err = cache.Push(src, "project-cache/app/keyed/"+key+".tar")
+		s.Require().Nil(err)
+		mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		sum := filepath.Join(root, "project-cache", "app", "keyed", key+".tar.sha256")
+		s.Require().Nil(os.Chtimes(sum, mtime, mtime))
+	}
+
+	// A tarball without a checksum is still being pushed
+	err = ioutil.WriteFile(filepath.Join(root, "project-cache", "app", "keyed", "npm-master-ddd.tar"), []byte("tarball"), 0644)
+	s.Require().Nil(err)
+
+	newest, err = cache.Newest("project-cache/app/keyed/npm-master-")
+	s.Nil(err)
+	s.Equal("project-cache/app/keyed/npm-master-ccc.tar", newest)
+
+	newest, err = cache.Newest("project-cache/app/keyed/npm-")
+	s.Nil(err)
+	s.Equal("project-cache/app/keyed/npm-master-ccc.tar", newest)
+
+	newest, err = cache.Newest("project-cache/app/keyed/yarn-")
+	s.Nil(err)
+	s.Equal("", newest)
+}
@@ -0,0 +1,121 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// StoredArtifact is an artifact tarball found in a store that uses the
+// GenerateBaseKey/Artifact.RemotePath layout
+type StoredArtifact struct {
+	ApplicationID string
+	BuildID       string
+	DeployID      string
+	BuildStepID   string
+	Key           string
+	ManifestKey   string
+	Size          int64
+	LastModified  time.Time
+}
+
+// ParseArtifactKey reads the ids out of a key like
+// project-artifacts/<app>/build/<id>/step/<step-id>/output.tar
+func ParseArtifactKey(key string) (*StoredArtifact, bool) {
+	parts := strings.Split(key, "/")
+	n := len(parts)
+	if n < 5 || parts[0] != "project-artifacts" || path.Ext(parts[n-1]) != ".tar" {
+		return nil, false
+	}
+
+	artifact := &StoredArtifact{Key: key}
+	rest := parts[:n-1]
+	if len(rest) >= 6 && rest[len(rest)-2] == "step" {
+		artifact.BuildStepID = rest[len(rest)-1]
+		rest = rest[:len(rest)-2]
+	}
+	kind, id := rest[len(rest)-2], rest[len(rest)-1]
+	switch kind {
+	case "build":
+		artifact.BuildID = id
+	case "deploy":
+		artifact.DeployID = id
+	default:
+		return nil, false
+	}
+	artifact.ApplicationID = strings.Join(rest[1:len(rest)-2], "/")
+	if artifact.ApplicationID == "" {
+		return nil, false
+	}
+	return artifact, true
+}
+
+// ListStoredArtifacts finds all the artifacts in the store along with their
+// manifests
+func ListStoredArtifacts(store Store) ([]*StoredArtifact, error) {
+	objects, err := store.List("project-artifacts/")
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := map[string]string{}
+	for _, object := range objects {
+		if path.Base(object.Key) == "manifest.json" {
+			manifests[path.Dir(object.Key)] = object.Key
+		}
+	}
+
+	artifacts := []*StoredArtifact{}
+	for _, object := range objects {
+		artifact, ok := ParseArtifactKey(object.Key)
+		if !ok {
+			continue
+		}
+		artifact.ManifestKey = manifests[path.Dir(object.Key)]
+		artifact.Size = object.Size
+		artifact.LastModified = object.LastModified
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// PipelineID is the id of the build or deploy that made the artifact
+func (a *StoredArtifact) PipelineID() string {
+	if a.DeployID != "" {
+		return a.DeployID
+	}
+	return a.BuildID
+}
+
+// StepName is the name of the step that made the artifact, without the
+// random suffix of its id, or "pipeline" for the output of the pipeline
+func (a *StoredArtifact) StepName() string {
+	if a.BuildStepID == "" {
+		return "pipeline"
+	}
+	return StepNameFromSafeID(a.BuildStepID)
+}
+
+// StepNameFromSafeID strips the uuid that is added to step names to make
+// them unique on disk
+func StepNameFromSafeID(safeID string) string {
+	// name + "-" + 36 characters of uuid
+	if len(safeID) > 37 && safeID[len(safeID)-37] == '-' {
+		return safeID[:len(safeID)-37]
+	}
+	return safeID
+}
@@ -0,0 +1,91 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type StoredArtifactSuite struct {
+	*util.TestSuite
+}
+
+func TestStoredArtifactSuite(t *testing.T) {
+	suiteTester := &StoredArtifactSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *StoredArtifactSuite) TestParseArtifactKey() {
+	stepID := "build-0b4f3a1e-2c7d-4d8e-9f10-1a2b3c4d5e6f"
+
+	artifact, ok := ParseArtifactKey("project-artifacts/acme/web/build/55ab/step/" + stepID + "/output.tar")
+	s.Require().True(ok)
+	s.Equal("acme/web", artifact.ApplicationID)
+	s.Equal("55ab", artifact.BuildID)
+	s.Equal("", artifact.DeployID)
+	s.Equal(stepID, artifact.BuildStepID)
+	s.Equal("build", artifact.StepName())
+	s.Equal("55ab", artifact.PipelineID())
+
+	artifact, ok = ParseArtifactKey("project-artifacts/acme/web/deploy/66cd/output.tar")
+	s.Require().True(ok)
+	s.Equal("66cd", artifact.DeployID)
+	s.Equal("66cd", artifact.PipelineID())
+	s.Equal("pipeline", artifact.StepName())
+
+	for _, key := range []string{
+		"project-cache/acme/web/cache.tar.gz",
+		"project-artifacts/acme/web/build/55ab/manifest.json",
+		"project-artifacts/build/55ab/output.tar",
+		"project-artifacts/acme/web/other/55ab/output.tar",
+	} {
+		_, ok := ParseArtifactKey(key)
+		s.False(ok, key)
+	}
+}
+
+func (s *StoredArtifactSuite) TestStepNameFromSafeID() {
+	s.Equal("npm-install", StepNameFromSafeID("npm-install-0b4f3a1e-2c7d-4d8e-9f10-1a2b3c4d5e6f"))
+	s.Equal("npm-install", StepNameFromSafeID("npm-install"))
+}
+
+func (s *StoredArtifactSuite) TestListStoredArtifacts() {
+	file := filepath.Join(s.WorkingDir(), "file")
+	s.Require().Nil(ioutil.WriteFile(file, []byte("data"), 0644))
+
+	store := NewLocalStore(filepath.Join(s.WorkingDir(), "store"))
+	for _, key := range []string{
+		"project-artifacts/acme/web/build/55ab/output.tar",
+		"project-artifacts/acme/web/build/55ab/manifest.json",
+		"project-artifacts/acme/web/build/55ab/step/test/output.tar",
+		"project-cache/acme/web/cache.tar.gz",
+	} {
+		s.Require().Nil(store.StoreFromFile(&StoreFromFileArgs{Path: file, Key: key}))
+	}
+
+	artifacts, err := ListStoredArtifacts(store)
+	s.Require().Nil(err)
+	s.Require().Len(artifacts, 2)
+	s.Equal("project-artifacts/acme/web/build/55ab/output.tar", artifacts[0].Key)
+	s.Equal("project-artifacts/acme/web/build/55ab/manifest.json", artifacts[0].ManifestKey)
+	s.Equal(int64(4), artifacts[0].Size)
+	s.Equal("test", artifacts[1].StepName())
+	s.Equal("", artifacts[1].ManifestKey)
+}
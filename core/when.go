@@ -0,0 +1,399 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wercker/wercker/util"
+)
+
+// WhenContext holds the values a `when` expression can refer to:
+//   branch, tag, commit  the git information of the pipeline
+//   result               "passed" or "failed", the result so far
+//   env.NAME             a variable from the pipeline environment
+type WhenContext struct {
+	Env    *util.Environment
+	Git    *GitOptions
+	Result string
+}
+
+// WhenExpression is a parsed `when` expression, it supports string
+// comparisons (==, !=, =~ for regular expressions), the boolean operators
+// &&, || and ! and parentheses, for example:
+//   branch == "master" && env.DEPLOY == "1"
+type WhenExpression struct {
+	source string
+	root   whenNode
+}
+
+// ParseWhen parses the expression so it can be evaluated later on
+func ParseWhen(source string) (*WhenExpression, error) {
+	tokens, err := tokenizeWhen(source)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid when expression %q: %s", source, err)
+	}
+	p := &whenParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid when expression %q: %s", source, err)
+	}
+	return &WhenExpression{source: source, root: root}, nil
+}
+
+// String returns the expression as it was written
+func (w *WhenExpression) String() string {
+	return w.source
+}
+
+// Evaluate tells us whether the step should run
+func (w *WhenExpression) Evaluate(ctx *WhenContext) (bool, error) {
+	value, err := w.root.eval(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Unable to evaluate when expression %q: %s", w.source, err)
+	}
+	return whenTruthy(value), nil
+}
+
+// whenTruthy treats empty strings, "false" and "0" as false
+func whenTruthy(value string) bool {
+	return value != "" && value != "false" && value != "0"
+}
+
+func whenBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+const (
+	whenTokenString = iota
+	whenTokenIdent
+	whenTokenOperator
+)
+
+type whenToken struct {
+	kind  int
+	value string
+}
+
+var whenOperators = []string{"&&", "||", "==", "!=", "=~", "!", "(", ")"}
+
+func isWhenIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func tokenizeWhen(source string) ([]whenToken, error) {
+	tokens := []whenToken{}
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			i++
+			continue
+		}
+
+		// Quoted strings, either "" or ''
+		if c == '"' || c == '\'' {
+			value, n, err := scanWhenString(source[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, whenToken{whenTokenString, value})
+			i += n
+			continue
+		}
+
+		if isWhenIdentChar(c) {
+			start := i
+			for i < len(source) && isWhenIdentChar(source[i]) {
+				i++
+			}
+			tokens = append(tokens, whenToken{whenTokenIdent, source[start:i]})
+			continue
+		}
+
+		found := false
+		for _, op := range whenOperators {
+			if strings.HasPrefix(source[i:], op) {
+				tokens = append(tokens, whenToken{whenTokenOperator, op})
+				i += len(op)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// scanWhenString reads the quoted string at the start of source and returns
+// its value and length. A backslash escapes the quote and a backslash, other
+// backslashes are kept so regular expressions can be written as is.
+func scanWhenString(source string) (string, int, error) {
+	quote := source[0]
+	value := []byte{}
+	for i := 1; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case c == quote:
+			return string(value), i + 1, nil
+		case c == '\\' && i+1 < len(source) && (source[i+1] == quote || source[i+1] == '\\'):
+			i++
+			value = append(value, source[i])
+		default:
+			value = append(value, c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type whenNode interface {
+	eval(*WhenContext) (string, error)
+}
+
+type whenLiteral string
+
+func (n whenLiteral) eval(ctx *WhenContext) (string, error) {
+	return string(n), nil
+}
+
+type whenVariable string
+
+func (n whenVariable) eval(ctx *WhenContext) (string, error) {
+	name := string(n)
+	if strings.HasPrefix(name, "env.") {
+		if ctx.Env == nil {
+			return "", nil
+		}
+		return ctx.Env.Get(strings.TrimPrefix(name, "env.")), nil
+	}
+	switch name {
+	case "result":
+		return ctx.Result, nil
+	}
+	if ctx.Git == nil {
+		return "", nil
+	}
+	switch name {
+	case "branch":
+		return ctx.Git.GitBranch, nil
+	case "tag":
+		return ctx.Git.GitTag, nil
+	case "commit":
+		return ctx.Git.GitCommit, nil
+	}
+	return "", fmt.Errorf("unknown variable %s", name)
+}
+
+type whenNot struct {
+	operand whenNode
+}
+
+func (n *whenNot) eval(ctx *WhenContext) (string, error) {
+	value, err := n.operand.eval(ctx)
+	if err != nil {
+		return "", err
+	}
+	return whenBool(!whenTruthy(value)), nil
+}
+
+type whenBinary struct {
+	op          string
+	left, right whenNode
+}
+
+func (n *whenBinary) eval(ctx *WhenContext) (string, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Short circuit the boolean operators
+	switch n.op {
+	case "&&":
+		if !whenTruthy(left) {
+			return whenBool(false), nil
+		}
+	case "||":
+		if whenTruthy(left) {
+			return whenBool(true), nil
+		}
+	}
+
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return whenBool(whenTruthy(right)), nil
+	case "==":
+		return whenBool(left == right), nil
+	case "!=":
+		return whenBool(left != right), nil
+	case "=~":
+		matched, err := regexp.MatchString(right, left)
+		if err != nil {
+			return "", err
+		}
+		return whenBool(matched), nil
+	}
+	return "", fmt.Errorf("unknown operator %s", n.op)
+}
+
+var whenKnownVariables = map[string]struct{}{
+	"branch": struct{}{},
+	"tag":    struct{}{},
+	"commit": struct{}{},
+	"result": struct{}{},
+}
+
+// whenParser is a small recursive descent parser, from low to high
+// precedence: ||, &&, !, comparisons
+type whenParser struct {
+	tokens []whenToken
+	pos    int
+}
+
+func (p *whenParser) peekOperator(ops ...string) string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	if t.kind != whenTokenOperator {
+		return ""
+	}
+	for _, op := range ops {
+		if t.value == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *whenParser) parseOr() (whenNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOperator("||") != "" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &whenBinary{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseAnd() (whenNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOperator("&&") != "" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &whenBinary{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseUnary() (whenNode, error) {
+	if p.peekOperator("!") != "" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &whenNot{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *whenParser) parseComparison() (whenNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peekOperator("==", "!=", "=~"); op != "" {
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if op == "=~" {
+			// Catch broken regular expressions early
+			if literal, ok := right.(whenLiteral); ok {
+				if _, err := regexp.Compile(string(literal)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return &whenBinary{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseOperand() (whenNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case whenTokenString:
+		return whenLiteral(t.value), nil
+	case whenTokenIdent:
+		if t.value == "true" || t.value == "false" {
+			return whenLiteral(t.value), nil
+		}
+		if _, ok := whenKnownVariables[t.value]; ok {
+			return whenVariable(t.value), nil
+		}
+		if strings.HasPrefix(t.value, "env.") && len(t.value) > len("env.") {
+			return whenVariable(t.value), nil
+		}
+		return nil, fmt.Errorf("unknown variable %s", t.value)
+	case whenTokenOperator:
+		if t.value == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if p.peekOperator(")") == "" {
+				return nil, fmt.Errorf("missing )")
+			}
+			p.pos++
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", t.value)
+}
@@ -0,0 +1,88 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type WhenSuite struct {
+	*util.TestSuite
+}
+
+func TestWhenSuite(t *testing.T) {
+	suiteTester := &WhenSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *WhenSuite) TestEvaluate() {
+	ctx := &WhenContext{
+		Env:    util.NewEnvironment("DEPLOY=1", "EMPTY=", `QUOTED=say "hi" \o/`, "APOSTROPHE=it's"),
+		Git:    &GitOptions{GitBranch: "master", GitTag: "v1.2.0", GitCommit: "abcdef"},
+		Result: "passed",
+	}
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`branch == "master"`, true},
+		{`branch != 'master'`, false},
+		{`branch == "master" && env.DEPLOY == "1"`, true},
+		{`branch == "dev" || env.DEPLOY == "1"`, true},
+		{`!(branch == "dev")`, true},
+		{`tag =~ "^v1\\."`, true},
+		{`tag =~ "^v1\.2"`, true},
+		{`env.QUOTED == "say \"hi\" \\o/"`, true},
+		{`env.QUOTED == 'say "hi" \\o/'`, true},
+		{`env.APOSTROPHE == 'it\'s'`, true},
+		{`tag`, true},
+		{`env.EMPTY`, false},
+		{`env.MISSING`, false},
+		{`!env.MISSING && result == "passed"`, true},
+		{`result == "failed"`, false},
+		{`true`, true},
+		{`false || false`, false},
+	}
+
+	for _, test := range tests {
+		when, err := ParseWhen(test.expression)
+		s.Require().Nil(err, test.expression)
+		actual, err := when.Evaluate(ctx)
+		s.Nil(err, test.expression)
+		s.Equal(test.expected, actual, test.expression)
+	}
+}
+
+func (s *WhenSuite) TestParseErrors() {
+	tests := []string{
+		``,
+		`branch =`,
+		`branch == "master`,
+		`branch == "master\"`,
+		`(branch == "master"`,
+		`brnach == "master"`,
+		`branch == "master" env.DEPLOY`,
+		`tag =~ "("`,
+	}
+
+	for _, test := range tests {
+		_, err := ParseWhen(test)
+		s.NotNil(err, test)
+	}
+}
@@ -15,6 +15,7 @@
 package dockerlocal
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -32,15 +33,22 @@ type Artificer struct {
 	dockerOptions *DockerOptions
 	logger        *util.LogEntry
 	store         core.Store
+	baseURL       string
 }
 
 // NewArtificer returns an Artificer
 func NewArtificer(options *core.PipelineOptions, dockerOptions *DockerOptions) *Artificer {
 	logger := util.RootLogger().WithField("Logger", "Artificer")
 
+	// NewPipelineOptions made sure the artifact store url is valid
 	var store core.Store
-	if options.ShouldStoreS3 {
+	baseURL := ""
+	if options.ArtifactStore != "" {
+		store, _ = core.NewStoreFromURL(options.ArtifactStore, options.AWSOptions)
+		baseURL, _ = core.StoreBaseURL(options.ArtifactStore, options.AWSOptions)
+	} else if options.ShouldStoreS3 {
 		store = core.NewS3Store(options.AWSOptions)
+		baseURL = options.S3BucketURL(options.S3Bucket)
 	}
 
 	return &Artificer{
@@ -48,6 +56,7 @@ func NewArtificer(options *core.PipelineOptions, dockerOptions *DockerOptions) *
 		dockerOptions: dockerOptions,
 		logger:        logger,
 		store:         store,
+		baseURL:       baseURL,
 	}
 }
 
@@ -68,7 +77,20 @@ func (a *Artificer) Collect(artifact *core.Artifact) (*core.Artifact, error) {
 
 	dfc := NewDockerFileCollector(client, artifact.ContainerID)
 	archive, errs := dfc.Collect(artifact.GuestPath)
-	archive.Tee(outputFile)
+
+	// Without filters the tarball is what docker gives us, otherwise we
+	// write a new one with the files that pass them
+	filters := []util.ArchiveProcessor{}
+	var tarWriter *util.ArchiveTarWriter
+	if len(artifact.Include) > 0 || len(artifact.Exclude) > 0 {
+		tarWriter = util.NewArchiveTarWriter(outputFile)
+		filters = append(filters, &util.ArchiveFilter{
+			Include: artifact.Include,
+			Exclude: artifact.Exclude,
+		}, tarWriter)
+	} else {
+		archive.Tee(outputFile)
+	}
 
 	select {
 	case err = <-errs:
@@ -76,7 +98,10 @@ func (a *Artificer) Collect(artifact *core.Artifact) (*core.Artifact, error) {
 	//               or we don't care about it, needs to be replaced by some
 	//               sort of cancellable context
 	case <-time.After(1 * time.Second):
-		err = <-archive.Multi(filepath.Base(artifact.GuestPath), artifact.HostPath, 1024*1024*1000)
+		err = <-archive.Multi(filepath.Base(artifact.GuestPath), artifact.HostPath, 1024*1024*1000, filters...)
+	}
+	if err == nil && tarWriter != nil {
+		err = tarWriter.Close()
 	}
 
 	if err != nil {
@@ -85,18 +110,56 @@ func (a *Artificer) Collect(artifact *core.Artifact) (*core.Artifact, error) {
 		}
 		return nil, err
 	}
+
+	// Make sure the tarball is all there before we read it back
+	err = outputFile.Close()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := core.NewArtifactManifest(artifact, a.options)
+	if err != nil {
+		return nil, err
+	}
+	err = manifest.WriteFile(artifact.ManifestPath())
+	if err != nil {
+		return nil, err
+	}
 	return artifact, nil
 }
 
-// Upload an artifact to S3
+// Upload an artifact to the artifact store, S3 unless --artifact-store is set
 func (a *Artificer) Upload(artifact *core.Artifact) error {
-	return a.store.StoreFromFile(&core.StoreFromFileArgs{
+	if a.store == nil {
+		return fmt.Errorf("No artifact store to upload %s to", artifact.RemotePath())
+	}
+	if a.baseURL != "" {
+		artifact.BaseURL = a.baseURL
+	}
+	err := a.store.StoreFromFile(&core.StoreFromFileArgs{
 		Path:        artifact.HostTarPath,
 		Key:         artifact.RemotePath(),
 		ContentType: artifact.ContentType,
 		MaxTries:    3,
 		Meta:        artifact.Meta,
 	})
+	if err != nil {
+		return err
+	}
+
+	// Artifacts that weren't collected, like exported containers, have no
+	// manifest
+	if artifact.HostTarPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(artifact.ManifestPath()); os.IsNotExist(err) {
+		return nil
+	}
+	return a.store.StoreFromFile(&core.StoreFromFileArgs{
+		Path:        artifact.ManifestPath(),
+		Key:         artifact.RemoteManifestPath(),
+		ContentType: "application/json",
+		MaxTries:    3,
+	})
 }
 
 // DockerFileCollector impl of FileCollector
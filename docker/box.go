@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/fsouza/go-dockerclient"
@@ -51,11 +52,20 @@ type DockerBox struct {
 	entrypoint      string
 	image           *docker.Image
 	volumes         []string
+	// network is only set on the box that created it
+	network string
+	linkEnv []string
+	// secrets mounts a tmpfs at core.SecretsMountPath
+	secrets bool
 }
 
 // NewDockerBox from a name and other references
 func NewDockerBox(boxConfig *core.BoxConfig, options *core.PipelineOptions, dockerOptions *DockerOptions) (*DockerBox, error) {
 	name := boxConfig.ID
+	// The tag is filled in when we know the hash of the build context
+	if boxConfig.Dockerfile != "" {
+		name = dockerfileRepository
+	}
 
 	if strings.Contains(name, "@") {
 		return nil, fmt.Errorf("Invalid box name, '@' is not allowed in docker repositories.")
@@ -91,6 +101,12 @@ func NewDockerBox(boxConfig *core.BoxConfig, options *core.PipelineOptions, dock
 
 	entrypoint := boxConfig.Entrypoint
 
+	// Check the resources against the host policy before we get started
+	err := applyResources(&docker.HostConfig{}, boxConfig, dockerOptions)
+	if err != nil {
+		return nil, fmt.Errorf("Box %s: %s", name, err)
+	}
+
 	logger := util.RootLogger().WithFields(util.LogFields{
 		"Logger":    "Box",
 		"Name":      name,
@@ -118,23 +134,102 @@ func NewDockerBox(boxConfig *core.BoxConfig, options *core.PipelineOptions, dock
 	}, nil
 }
 
-func (b *DockerBox) links() []string {
-	serviceLinks := []string{}
-
+// serviceEnv gathers the link style environment of all the services
+func (b *DockerBox) serviceEnv() []string {
+	env := []string{}
 	for _, service := range b.services {
-		serviceLinks = append(serviceLinks, service.Link())
+		env = append(env, service.LinkEnv()...)
 	}
-	b.logger.Debugln("Creating links:", serviceLinks)
-	return serviceLinks
+	return env
 }
 
-// Link gives us the parameter to Docker to link to this box
-func (b *DockerBox) Link() string {
+// Alias is the name other containers on the network can reach this box by
+func (b *DockerBox) Alias() string {
 	name := b.config.Name
 	if name == "" {
 		name = b.ShortName
 	}
-	return fmt.Sprintf("%s:%s", b.container.Name, name)
+	return name
+}
+
+// LinkEnv gives us the environment docker used to set for links to this box
+func (b *DockerBox) LinkEnv() []string {
+	return b.linkEnv
+}
+
+// networkName is the name of the network of the pipeline
+func (b *DockerBox) networkName() string {
+	return fmt.Sprintf("wercker-pipeline-%s", b.options.PipelineID)
+}
+
+// createNetwork creates the network the box and its services share
+func (b *DockerBox) createNetwork() error {
+	name := b.networkName()
+	b.logger.Debugln("Creating network:", name)
+	_, err := b.client.CreateNetwork(docker.CreateNetworkOptions{
+		Name:           name,
+		Driver:         "bridge",
+		CheckDuplicate: true,
+	})
+	if err != nil {
+		return err
+	}
+	b.network = name
+	return nil
+}
+
+// networkingConfig connects a container to the network with an alias
+func networkingConfig(network, alias string) *docker.NetworkingConfig {
+	return &docker.NetworkingConfig{
+		EndpointsConfig: map[string]*docker.EndpointConfig{
+			network: &docker.EndpointConfig{
+				Aliases: []string{alias},
+			},
+		},
+	}
+}
+
+// linkEnv builds the variables docker sets for a link, like
+// REDIS_PORT_6379_TCP_ADDR, so that builds relying on them keep working
+func linkEnv(alias, ip string, ports map[docker.Port]struct{}, env []string) []string {
+	prefix := strings.ToUpper(linkEnvReplacer.Replace(alias))
+	s := []string{}
+
+	sorted := []string{}
+	for port := range ports {
+		sorted = append(sorted, string(port))
+	}
+	sort.Strings(sorted)
+
+	for i, portdef := range sorted {
+		port := docker.Port(portdef)
+		url := fmt.Sprintf("%s://%s:%s", port.Proto(), ip, port.Port())
+		if i == 0 {
+			s = append(s, fmt.Sprintf("%s_PORT=%s", prefix, url))
+		}
+		name := fmt.Sprintf("%s_PORT_%s_%s", prefix, port.Port(), strings.ToUpper(port.Proto()))
+		s = append(s, fmt.Sprintf("%s=%s", name, url))
+		s = append(s, fmt.Sprintf("%s_ADDR=%s", name, ip))
+		s = append(s, fmt.Sprintf("%s_PORT=%s", name, port.Port()))
+		s = append(s, fmt.Sprintf("%s_PROTO=%s", name, port.Proto()))
+	}
+
+	for _, kv := range env {
+		s = append(s, fmt.Sprintf("%s_ENV_%s", prefix, kv))
+	}
+	return s
+}
+
+var linkEnvReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// networkIP is the address of the container on the given network
+func networkIP(container *docker.Container, network string) string {
+	if container.NetworkSettings != nil {
+		if endpoint, ok := container.NetworkSettings.Networks[network]; ok {
+			return endpoint.IPAddress
+		}
+	}
+	return containerIP(container)
 }
 
 // GetName gets the box name
@@ -197,17 +292,26 @@ func (b *DockerBox) binds(env *util.Environment) ([]string, error) {
 	return binds, nil
 }
 
-// RunServices runs the services associated with this box
+// RunServices runs the services associated with this box, each service gets
+// the link environment of the ones started before it
 func (b *DockerBox) RunServices(ctx context.Context, env *util.Environment) error {
-	links := []string{}
+	serviceEnv := []string{}
 
 	for _, service := range b.services {
 		b.logger.Debugln("Startinq service:", service.GetName())
-		_, err := service.Run(ctx, env, links)
+		_, err := service.Run(ctx, env, b.network, serviceEnv)
+		if err != nil {
+			return err
+		}
+		serviceEnv = append(serviceEnv, service.LinkEnv()...)
+	}
+
+	// Wait for all of them at once, they are starting up in parallel anyway
+	for _, service := range b.services {
+		err := service.WaitHealthy(ctx)
 		if err != nil {
 			return err
 		}
-		links = append(links, service.Link())
 	}
 	return nil
 }
@@ -317,7 +421,8 @@ func (b *DockerBox) RecoverInteractive(cwd string, pipeline core.Pipeline, step
 
 	env := []string{}
 	env = append(env, pipeline.Env().Export()...)
-	env = append(env, pipeline.Env().Hidden.Export()...)
+	// The tmpfs for the secrets is empty again after the restart
+	env = append(env, pipeline.HiddenExport()...)
 	env = append(env, step.Env().Export()...)
 	env = append(env, fmt.Sprintf("cd %s", cwd))
 	env = append(env, fmt.Sprintf("clear"))
@@ -331,7 +436,12 @@ func (b *DockerBox) getContainerName() string {
 
 // Run creates the container and runs it.
 func (b *DockerBox) Run(ctx context.Context, env *util.Environment) (*docker.Container, error) {
-	err := b.RunServices(ctx, env)
+	err := b.createNetwork()
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.RunServices(ctx, env)
 	if err != nil {
 		return nil, err
 	}
@@ -342,6 +452,7 @@ func (b *DockerBox) Run(ctx context.Context, env *util.Environment) (*docker.Con
 
 	// Import the environment
 	myEnv := dockerEnv(b.config.Env, env)
+	myEnv = append(myEnv, b.serviceEnv()...)
 
 	var entrypoint []string
 	if b.entrypoint != "" {
@@ -376,9 +487,16 @@ func (b *DockerBox) Run(ctx context.Context, env *util.Environment) (*docker.Con
 
 	hostConfig := &docker.HostConfig{
 		Binds:        binds,
-		Links:        b.links(),
 		PortBindings: portBindings(portsToBind),
 		DNS:          b.dockerOptions.DockerDNS,
+		NetworkMode:  b.network,
+	}
+	err = applyResources(hostConfig, b.config, b.dockerOptions)
+	if err != nil {
+		return nil, err
+	}
+	if b.secrets {
+		hostConfig.Tmpfs[core.SecretsMountPath] = secretsTmpfsOptions
 	}
 
 	// Make and start the container
@@ -398,9 +516,11 @@ func (b *DockerBox) Run(ctx context.Context, env *util.Environment) (*docker.Con
 				NetworkDisabled: b.networkDisabled,
 				DNS:             b.dockerOptions.DockerDNS,
 				Entrypoint:      entrypoint,
+				User:            b.config.User,
 				// Volumes: volumes,
 			},
-			HostConfig: hostConfig,
+			HostConfig:       hostConfig,
+			NetworkingConfig: networkingConfig(b.network, b.Alias()),
 		})
 
 	if err != nil {
@@ -450,6 +570,15 @@ func (b *DockerBox) Clean() error {
 		}
 	}
 
+	// The network can only go once nothing is connected to it
+	if b.network != "" {
+		b.logger.WithField("Network", b.network).Debugln("Removing network:", b.network)
+		err := client.RemoveNetwork(b.network)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !b.options.ShouldCommit {
 		for i := len(b.images) - 1; i >= 0; i-- {
 			b.logger.WithField("Image", b.images[i].ID).Debugln("Removing image:", b.images[i].ID)
@@ -471,6 +600,30 @@ func (b *DockerBox) Restart() (*docker.Container, error) {
 	return b.container, nil
 }
 
+// secretsTmpfsOptions lets any box user write its secrets to the tmpfs, the
+// files themselves are only readable by the user that wrote them
+const secretsTmpfsOptions = "rw,noexec,nosuid,nodev,mode=1777"
+
+// MountSecrets adds a tmpfs at core.SecretsMountPath to the container for the
+// pipeline's secrets, it is emptied again when the box is stopped
+func (b *DockerBox) MountSecrets() {
+	b.secrets = true
+}
+
+// removeSecrets deletes the secret files from the tmpfs so they are gone
+// even when the container is kept around
+func (b *DockerBox) removeSecrets() {
+	b.logger.Debugln("Removing secrets from container", b.container.ID)
+	cmd := []string{"/bin/sh", "-c", fmt.Sprintf("rm -rf %s/*", core.SecretsMountPath)}
+	exit, err := b.client.ExecOneExit(b.container.ID, cmd, ioutil.Discard)
+	if err == nil && exit != 0 {
+		err = fmt.Errorf("exit code %d", exit)
+	}
+	if err != nil {
+		b.logger.WithField("Error", err).Warnln("Wasn't able to remove the secrets from box container", b.container.ID)
+	}
+}
+
 // AddService needed by this Box
 func (b *DockerBox) AddService(service core.ServiceBox) {
 	b.services = append(b.services, service)
@@ -493,6 +646,9 @@ func (b *DockerBox) Stop() {
 		}
 	}
 	if b.container != nil {
+		if b.secrets {
+			b.removeSecrets()
+		}
 		b.logger.Debugln("Stopping container", b.container.ID)
 		err := client.StopContainer(b.container.ID, 1)
 
@@ -516,9 +672,25 @@ func (b *DockerBox) Fetch(ctx context.Context, env *util.Environment) (*docker.I
 		return nil, err
 	}
 
+	// Checkpoints are images of our own so those we fetch as usual
+	if b.config.Dockerfile != "" && b.options.Checkpoint == "" {
+		return b.fetchDockerfile(ctx, env)
+	}
+
+	// Expand everything up front, a missing variable should fail the fetch
+	// rather than pull the wrong image
+	fields := []string{b.Name, b.repository, b.tag, b.config.Registry, b.config.Username, b.config.Password}
+	for i, field := range fields {
+		fields[i], err = env.InterpolateChecked(field)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to fetch box %s: %s", b.Name, err)
+		}
+	}
+	name, repository, tag, registry, username, password := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+
 	// Shortcut to speed up local dev
 	if b.dockerOptions.DockerLocal {
-		image, err := client.InspectImage(env.Interpolate(b.Name))
+		image, err := client.InspectImage(name)
 		if err != nil {
 			return nil, err
 		}
@@ -528,15 +700,15 @@ func (b *DockerBox) Fetch(ctx context.Context, env *util.Environment) (*docker.I
 
 	// Check for access to this image
 	auth := docker.AuthConfiguration{
-		Username: env.Interpolate(b.config.Username),
-		Password: env.Interpolate(b.config.Password),
+		Username: username,
+		Password: password,
 	}
 
 	checkOpts := CheckAccessOptions{
 		Auth:       auth,
 		Access:     "read",
-		Repository: env.Interpolate(b.repository),
-		Registry:   env.Interpolate(b.config.Registry),
+		Repository: repository,
+		Registry:   registry,
 	}
 
 	check, err := client.CheckAccess(checkOpts)
@@ -562,8 +734,8 @@ func (b *DockerBox) Fetch(ctx context.Context, env *util.Environment) (*docker.I
 		// Registry:      "docker.tsuru.io",
 		OutputStream:  w,
 		RawJSONStream: true,
-		Repository:    env.Interpolate(b.repository),
-		Tag:           env.Interpolate(b.tag),
+		Repository:    repository,
+		Tag:           tag,
 	}
 
 	err = client.PullImage(options, auth)
@@ -571,7 +743,7 @@ func (b *DockerBox) Fetch(ctx context.Context, env *util.Environment) (*docker.I
 		return nil, err
 	}
 
-	image, err := client.InspectImage(env.Interpolate(b.Name))
+	image, err := client.InspectImage(name)
 	if err != nil {
 		return nil, err
 	}
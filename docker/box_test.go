@@ -81,3 +81,69 @@ func (s *BoxSuite) TestPortBindings() {
 		s.Equal(check[2], binding[0].HostPort)
 	}
 }
+
+func (s *BoxSuite) TestLinkEnv() {
+	ports := map[docker.Port]struct{}{
+		docker.Port("6380/tcp"): struct{}{},
+		docker.Port("6379/tcp"): struct{}{},
+	}
+	env := linkEnv("my-redis", "172.18.0.2", ports, []string{"PASSWORD=secret"})
+
+	s.Equal([]string{
+		"MY_REDIS_PORT=tcp://172.18.0.2:6379",
+		"MY_REDIS_PORT_6379_TCP=tcp://172.18.0.2:6379",
+		"MY_REDIS_PORT_6379_TCP_ADDR=172.18.0.2",
+		"MY_REDIS_PORT_6379_TCP_PORT=6379",
+		"MY_REDIS_PORT_6379_TCP_PROTO=tcp",
+		"MY_REDIS_PORT_6380_TCP=tcp://172.18.0.2:6380",
+		"MY_REDIS_PORT_6380_TCP_ADDR=172.18.0.2",
+		"MY_REDIS_PORT_6380_TCP_PORT=6380",
+		"MY_REDIS_PORT_6380_TCP_PROTO=tcp",
+		"MY_REDIS_ENV_PASSWORD=secret",
+	}, env)
+}
+
+func (s *BoxSuite) TestApplyResources() {
+	config := &core.BoxConfig{
+		Memory:  "512m",
+		ShmSize: "64m",
+		Ulimits: []string{"nofile=1024:2048"},
+		CapDrop: []string{"NET_RAW"},
+		Tmpfs:   []string{"/run:size=64m", "/tmp"},
+	}
+	hostConfig := &docker.HostConfig{}
+	err := applyResources(hostConfig, config, &DockerOptions{})
+	s.Require().Nil(err)
+	s.Equal(int64(512*1024*1024), hostConfig.Memory)
+	s.Equal(int64(64*1024*1024), hostConfig.ShmSize)
+	s.Equal([]docker.ULimit{{Name: "nofile", Soft: 1024, Hard: 2048}}, hostConfig.Ulimits)
+	s.Equal([]string{"NET_RAW"}, hostConfig.CapDrop)
+	s.Equal(map[string]string{"/run": "size=64m", "/tmp": ""}, hostConfig.Tmpfs)
+}
+
+func (s *BoxSuite) TestApplyResourcesLimits() {
+	options := &DockerOptions{
+		DockerMemoryLimit:   1024 * 1024 * 1024,
+		DockerCPUQuotaLimit: 50000,
+	}
+
+	// Unset limits default to the policy
+	hostConfig := &docker.HostConfig{}
+	err := applyResources(hostConfig, &core.BoxConfig{}, options)
+	s.Require().Nil(err)
+	s.Equal(int64(1024*1024*1024), hostConfig.Memory)
+	s.Equal(int64(50000), hostConfig.CPUQuota)
+
+	err = applyResources(&docker.HostConfig{}, &core.BoxConfig{Memory: "2g"}, options)
+	s.NotNil(err)
+
+	err = applyResources(&docker.HostConfig{}, &core.BoxConfig{CPUQuota: 100000}, options)
+	s.NotNil(err)
+
+	err = applyResources(&docker.HostConfig{}, &core.BoxConfig{Privileged: true}, options)
+	s.NotNil(err)
+
+	options.DockerAllowPrivileged = true
+	err = applyResources(&docker.HostConfig{}, &core.BoxConfig{Privileged: true}, options)
+	s.Nil(err)
+}
@@ -92,6 +92,11 @@ func (b *DockerBuild) DockerMessage() string {
 func (b *DockerBuild) CollectArtifact(containerID string) (*core.Artifact, error) {
 	artificer := NewArtificer(b.options, b.dockerOptions)
 
+	var include, exclude []string
+	if config := b.Artifacts(); config != nil {
+		include, exclude = config.Include, config.Exclude
+	}
+
 	// Ensure we have the host directory
 
 	artifact := &core.Artifact{
@@ -103,6 +108,8 @@ func (b *DockerBuild) CollectArtifact(containerID string) (*core.Artifact, error
 		BuildID:       b.options.BuildID,
 		Bucket:        b.options.S3Bucket,
 		ContentType:   "application/x-tar",
+		Include:       include,
+		Exclude:       exclude,
 	}
 
 	sourceArtifact := &core.Artifact{
@@ -114,6 +121,8 @@ func (b *DockerBuild) CollectArtifact(containerID string) (*core.Artifact, error
 		BuildID:       b.options.BuildID,
 		Bucket:        b.options.S3Bucket,
 		ContentType:   "application/x-tar",
+		Include:       include,
+		Exclude:       exclude,
 	}
 
 	// Get the output dir, if it is empty grab the source dir.
@@ -101,6 +101,11 @@ func (d *DockerDeploy) DockerMessage() string {
 func (d *DockerDeploy) CollectArtifact(containerID string) (*core.Artifact, error) {
 	artificer := NewArtificer(d.options, d.dockerOptions)
 
+	var include, exclude []string
+	if config := d.Artifacts(); config != nil {
+		include, exclude = config.Include, config.Exclude
+	}
+
 	artifact := &core.Artifact{
 		ContainerID:   containerID,
 		GuestPath:     d.options.GuestPath("output"),
@@ -110,6 +115,8 @@ func (d *DockerDeploy) CollectArtifact(containerID string) (*core.Artifact, erro
 		DeployID:      d.options.DeployID,
 		Bucket:        d.options.S3Bucket,
 		ContentType:   "application/x-tar",
+		Include:       include,
+		Exclude:       exclude,
 	}
 
 	// Get the output dir, if it is empty grab the source dir.
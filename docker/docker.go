@@ -25,6 +25,7 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -256,8 +257,38 @@ func (c *DockerClient) AttachTerminal(containerID string) error {
 	return err
 }
 
+// CollectFile copies a single file out of the container to dst, it
+// returns util.ErrEmptyTarball if the file isn't there
+func (c *DockerClient) CollectFile(containerID, path, name string, dst io.Writer) error {
+	pipeReader, pipeWriter := io.Pipe()
+
+	opts := docker.DownloadFromContainerOptions{
+		OutputStream: pipeWriter,
+		Path:         filepath.Join(path, name),
+	}
+
+	errs := make(chan error)
+	go func() {
+		defer close(errs)
+		errs <- util.UntarOne(name, dst, pipeReader)
+	}()
+
+	if err := c.DownloadFromContainer(containerID, opts); err != nil {
+		c.logger.Debug("Probably expected error:", err)
+		return util.ErrEmptyTarball
+	}
+
+	return <-errs
+}
+
 // ExecOne uses docker exec to run a command in the container
 func (c *DockerClient) ExecOne(containerID string, cmd []string, output io.Writer) error {
+	_, err := c.ExecOneExit(containerID, cmd, output)
+	return err
+}
+
+// ExecOneExit is ExecOne that also returns the exit code of the command
+func (c *DockerClient) ExecOneExit(containerID string, cmd []string, output io.Writer) (int, error) {
 	exec, err := c.CreateExec(docker.CreateExecOptions{
 		AttachStdin:  false,
 		AttachStdout: true,
@@ -267,17 +298,22 @@ func (c *DockerClient) ExecOne(containerID string, cmd []string, output io.Write
 		Container:    containerID,
 	})
 	if err != nil {
-		return err
+		return -1, err
 	}
 
 	err = c.StartExec(exec.ID, docker.StartExecOptions{
 		OutputStream: output,
+		ErrorStream:  output,
 	})
 	if err != nil {
-		return err
+		return -1, err
 	}
 
-	return nil
+	inspect, err := c.InspectExec(exec.ID)
+	if err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
 }
 
 // normalizeRepo only really applies to the repository name used in the registry
@@ -390,27 +426,6 @@ type DockerScratchPushStep struct {
 	*DockerPushStep
 }
 
-// DockerImageJSON is a minimal JSON description for a docker layer
-type DockerImageJSON struct {
-	Architecture    string                         `json:"architecture"`
-	Created         time.Time                      `json:"created"`
-	Config          docker.Config                  `json:"config"`
-	Container       string                         `json:"container"`
-	ContainerConfig DockerImageJSONContainerConfig `json:"container_config"`
-	ID              string                         `json:"id"`
-	OS              string                         `json:"os"`
-	DockerVersion   string                         `json:"docker_version"`
-	Size            int64                          `json:"Size"`
-}
-
-// DockerImageJSONContainerConfig substructure
-type DockerImageJSONContainerConfig struct {
-	Hostname string
-	// Cmd      []string
-	// Memory int
-	// OpenStdin bool
-}
-
 // NewDockerScratchPushStep constructorama
 func NewDockerScratchPushStep(stepConfig *core.StepConfig, options *core.PipelineOptions, dockerOptions *DockerOptions) (*DockerScratchPushStep, error) {
 	name := "docker-scratch-push"
@@ -423,13 +438,17 @@ func NewDockerScratchPushStep(stepConfig *core.StepConfig, options *core.Pipelin
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
 	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
+		DisplayName:       displayName,
+		Env:               &util.Environment{},
+		ID:                name,
+		Name:              name,
+		Owner:             "wercker",
+		SafeID:            stepSafeID,
+		Version:           util.Version(),
+		When:              stepConfig.When,
+		Timeout:           stepConfig.Timeout,
+		NoResponseTimeout: stepConfig.NoResponseTimeout,
+		Retry:             stepConfig.Retry,
 	})
 
 	dockerPushStep := &DockerPushStep{
@@ -445,6 +464,10 @@ func NewDockerScratchPushStep(stepConfig *core.StepConfig, options *core.Pipelin
 
 // Execute the scratch-n-push
 func (s *DockerScratchPushStep) Execute(ctx context.Context, sess *core.Session) (int, error) {
+	if s.interpolateErr != nil {
+		return 1, s.interpolateErr
+	}
+
 	// This is clearly only relevant to docker so we're going to dig into the
 	// transport internals a little bit to get the container ID
 	dt := sess.Transport().(*DockerTransport)
@@ -455,140 +478,6 @@ func (s *DockerScratchPushStep) Execute(ctx context.Context, sess *core.Session)
 		return -1, err
 	}
 
-	// At this point we've written the layer to disk, we're going to add up the
-	// sizes of all the files to add to our json format, and sha256 the data
-	layerFile, err := os.Open(s.options.HostPath("layer.tar"))
-	if err != nil {
-		return -1, err
-	}
-	defer layerFile.Close()
-
-	var layerSize int64
-
-	layerTar := tar.NewReader(layerFile)
-	for {
-		hdr, err := layerTar.Next()
-		if err == io.EOF {
-			// finished the tarball
-			break
-		}
-		if err != nil {
-			return -1, err
-		}
-
-		// Skip the base dir
-		if hdr.Name == "./" {
-			continue
-		}
-
-		layerSize += hdr.Size
-	}
-
-	config := docker.Config{
-		Cmd:          s.cmd,
-		Entrypoint:   s.entrypoint,
-		Hostname:     containerID[:16],
-		WorkingDir:   s.workingDir,
-		ExposedPorts: s.ports,
-		Volumes:      s.volumes,
-	}
-
-	layerID, err := GenerateDockerID()
-	if err != nil {
-		return -1, err
-	}
-
-	// Make the JSON file we need
-	imageJSON := DockerImageJSON{
-		Architecture: "amd64",
-		Container:    containerID,
-		ContainerConfig: DockerImageJSONContainerConfig{
-			Hostname: containerID[:16],
-		},
-		DockerVersion: "1.5",
-		Created:       time.Now(),
-		ID:            layerID,
-		OS:            "linux",
-		Size:          layerSize,
-		Config:        config,
-	}
-
-	jsonOut, err := json.MarshalIndent(imageJSON, "", "  ")
-	if err != nil {
-		return -1, err
-	}
-	s.logger.Debugln(string(jsonOut))
-
-	// Write out the files to disk that we are going to care about
-	err = os.MkdirAll(s.options.HostPath("scratch", layerID), 0755)
-	if err != nil {
-		return -1, err
-	}
-	defer os.RemoveAll(s.options.HostPath("scratch"))
-
-	// VERSION file
-	versionFile, err := os.OpenFile(s.options.HostPath("scratch", layerID, "VERSION"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return -1, err
-	}
-	defer versionFile.Close()
-	_, err = versionFile.Write([]byte("1.0"))
-	if err != nil {
-		return -1, err
-	}
-	err = versionFile.Sync()
-	if err != nil {
-		return -1, err
-	}
-
-	// json file
-	jsonFile, err := os.OpenFile(s.options.HostPath("scratch", layerID, "json"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return -1, err
-	}
-	defer jsonFile.Close()
-	_, err = jsonFile.Write(jsonOut)
-	if err != nil {
-		return -1, err
-	}
-	err = jsonFile.Sync()
-	if err != nil {
-		return -1, err
-	}
-
-	// repositories file
-	repositoriesFile, err := os.OpenFile(s.options.HostPath("scratch", "repositories"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return -1, err
-	}
-	defer repositoriesFile.Close()
-	_, err = repositoriesFile.Write([]byte(fmt.Sprintf(`{"%s":{`, s.repository)))
-	if err != nil {
-		return -1, err
-	}
-
-	if len(s.tags) == 0 {
-		s.tags = []string{"latest"}
-	}
-
-	for i, tag := range s.tags {
-		_, err = repositoriesFile.Write([]byte(fmt.Sprintf(`"%s":"%s"`, tag, layerID)))
-		if err != nil {
-			return -1, err
-		}
-		if i != len(s.tags)-1 {
-			_, err = repositoriesFile.Write([]byte{','})
-			if err != nil {
-				return -1, err
-			}
-		}
-	}
-
-	_, err = repositoriesFile.Write([]byte{'}', '}'})
-	err = repositoriesFile.Sync()
-	if err != nil {
-		return -1, err
-	}
 	// layer.tar has an extra folder in it so we have to strip it :/
 	tempLayerFile, err := os.Open(s.options.HostPath("layer.tar"))
 	if err != nil {
@@ -597,10 +486,12 @@ func (s *DockerScratchPushStep) Execute(ctx context.Context, sess *core.Session)
 	defer os.Remove(s.options.HostPath("layer.tar"))
 	defer tempLayerFile.Close()
 
-	realLayerFile, err := os.OpenFile(s.options.HostPath("scratch", layerID, "layer.tar"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	layerPath := s.options.HostPath("scratch-layer.tar")
+	realLayerFile, err := os.OpenFile(layerPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return -1, err
 	}
+	defer os.Remove(layerPath)
 	defer realLayerFile.Close()
 
 	tr := tar.NewReader(tempLayerFile)
@@ -633,14 +524,67 @@ func (s *DockerScratchPushStep) Execute(ctx context.Context, sess *core.Session)
 		}
 	}
 	tw.Close()
+	realLayerFile.Close()
 
-	// Build our output tarball and start writing to it
+	// Build our image as an OCI image layout, which docker load reads too
 	imageFile, err := os.Create(s.options.HostPath("scratch.tar"))
+	if err != nil {
+		return -1, err
+	}
+	defer os.Remove(s.options.HostPath("scratch.tar"))
 	defer imageFile.Close()
+
+	layout := NewOCILayout(imageFile)
+	layer, err := layout.AddBlobFile(OCILayerMediaType, layerPath)
+	if err != nil {
+		return -1, err
+	}
+
+	exposedPorts := map[string]struct{}{}
+	for port := range s.ports {
+		exposedPorts[string(port)] = struct{}{}
+	}
+	created := time.Now()
+	imageConfig := OCIImageConfig{
+		Created:      created,
+		Author:       s.author,
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: OCIContainerConfig{
+			User:         s.user,
+			ExposedPorts: exposedPorts,
+			Env:          s.env,
+			Entrypoint:   s.entrypoint,
+			Cmd:          s.cmd,
+			Volumes:      s.volumes,
+			WorkingDir:   s.workingDir,
+			Labels:       s.labels,
+			StopSignal:   s.stopSignal,
+		},
+		RootFS: OCIRootFS{
+			Type:    "layers",
+			DiffIDs: []string{layer.Digest},
+		},
+		History: []OCIHistory{
+			{Created: created, CreatedBy: "wercker docker-scratch-push"},
+		},
+	}
+
+	configJSON, err := json.MarshalIndent(imageConfig, "", "  ")
+	if err != nil {
+		return -1, err
+	}
+	s.logger.Debugln(string(configJSON))
+
+	config, err := layout.AddBlobBytes(OCIConfigMediaType, configJSON)
+	if err != nil {
+		return -1, err
+	}
+	_, err = layout.AddImage(config, []OCIDescriptor{layer}, nil)
 	if err != nil {
 		return -1, err
 	}
-	err = util.TarPath(imageFile, s.options.HostPath("scratch"))
+	err = layout.Close()
 	if err != nil {
 		return -1, err
 	}
@@ -693,7 +637,8 @@ func (s *DockerScratchPushStep) Execute(ctx context.Context, sess *core.Session)
 		return -1, err
 	}
 	e, err := core.EmitterFromContext(ctx)
-	return s.tagAndPush(layerID, e, client, auth)
+	// The image is known by the digest of its config once it is loaded
+	return s.tagAndPush(config.Digest, e, client, auth)
 }
 
 // CollectArtifact is copied from the build, we use this to get the layer
@@ -765,6 +710,9 @@ type DockerPushStep struct {
 	forceTags     bool
 	logger        *util.LogEntry
 	workingDir    string
+
+	// interpolateErr is the first variable InitEnv was unable to expand
+	interpolateErr error
 }
 
 // NewDockerPushStep is a special step for doing docker pushes
@@ -779,13 +727,17 @@ func NewDockerPushStep(stepConfig *core.StepConfig, options *core.PipelineOption
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
 	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
+		DisplayName:       displayName,
+		Env:               &util.Environment{},
+		ID:                name,
+		Name:              name,
+		Owner:             "wercker",
+		SafeID:            stepSafeID,
+		Version:           util.Version(),
+		When:              stepConfig.When,
+		Timeout:           stepConfig.Timeout,
+		NoResponseTimeout: stepConfig.NoResponseTimeout,
+		Retry:             stepConfig.Retry,
 	})
 
 	return &DockerPushStep{
@@ -801,45 +753,47 @@ func NewDockerPushStep(stepConfig *core.StepConfig, options *core.PipelineOption
 
 // InitEnv parses our data into our config
 func (s *DockerPushStep) InitEnv(env *util.Environment) {
+	s.interpolateErr = nil
+
 	if username, ok := s.data["username"]; ok {
-		s.username = env.Interpolate(username)
+		s.username = s.interpolate(env, username)
 	}
 
 	if password, ok := s.data["password"]; ok {
-		s.password = env.Interpolate(password)
+		s.password = s.interpolate(env, password)
 	}
 
 	if email, ok := s.data["email"]; ok {
-		s.email = env.Interpolate(email)
+		s.email = s.interpolate(env, email)
 	}
 
 	if authServer, ok := s.data["auth-server"]; ok {
-		s.authServer = env.Interpolate(authServer)
+		s.authServer = s.interpolate(env, authServer)
 	}
 
 	if repository, ok := s.data["repository"]; ok {
-		s.repository = env.Interpolate(repository)
+		s.repository = s.interpolate(env, repository)
 	}
 
 	if tags, ok := s.data["tag"]; ok {
 		splitTags := util.SplitSpaceOrComma(tags)
 		interpolatedTags := make([]string, len(splitTags))
 		for i, tag := range splitTags {
-			interpolatedTags[i] = env.Interpolate(tag)
+			interpolatedTags[i] = s.interpolate(env, tag)
 		}
 		s.tags = interpolatedTags
 	}
 
 	if author, ok := s.data["author"]; ok {
-		s.author = env.Interpolate(author)
+		s.author = s.interpolate(env, author)
 	}
 
 	if message, ok := s.data["message"]; ok {
-		s.message = env.Interpolate(message)
+		s.message = s.interpolate(env, message)
 	}
 
 	if ports, ok := s.data["ports"]; ok {
-		iPorts := env.Interpolate(ports)
+		iPorts := s.interpolate(env, ports)
 		parts := util.SplitSpaceOrComma(iPorts)
 		portmap := make(map[docker.Port]struct{})
 		for _, port := range parts {
@@ -853,7 +807,7 @@ func (s *DockerPushStep) InitEnv(env *util.Environment) {
 	}
 
 	if volumes, ok := s.data["volumes"]; ok {
-		iVolumes := env.Interpolate(volumes)
+		iVolumes := s.interpolate(env, volumes)
 		parts := util.SplitSpaceOrComma(iVolumes)
 		volumemap := make(map[string]struct{})
 		for _, volume := range parts {
@@ -864,12 +818,12 @@ func (s *DockerPushStep) InitEnv(env *util.Environment) {
 	}
 
 	if workingDir, ok := s.data["working-dir"]; ok {
-		s.workingDir = env.Interpolate(workingDir)
+		s.workingDir = s.interpolate(env, workingDir)
 	}
 
 	if registry, ok := s.data["registry"]; ok {
 		// s.registry = env.Interpolate(registry)
-		s.registry = normalizeRegistry(env.Interpolate(registry))
+		s.registry = normalizeRegistry(s.interpolate(env, registry))
 	} else {
 		// s.registry = "https://registry.hub.docker.com"
 		s.registry = normalizeRegistry("https://registry.hub.docker.com")
@@ -895,14 +849,14 @@ func (s *DockerPushStep) InitEnv(env *util.Environment) {
 		if err == nil {
 			interpolatedEnv := make([]string, len(parsedEnv))
 			for i, envVar := range parsedEnv {
-				interpolatedEnv[i] = env.Interpolate(envVar)
+				interpolatedEnv[i] = s.interpolate(env, envVar)
 			}
 			s.env = interpolatedEnv
 		}
 	}
 
 	if stopsignal, ok := s.data["stopsignal"]; ok {
-		s.stopSignal = env.Interpolate(stopsignal)
+		s.stopSignal = s.interpolate(env, stopsignal)
 	}
 
 	if labels, ok := s.data["labels"]; ok {
@@ -911,14 +865,14 @@ func (s *DockerPushStep) InitEnv(env *util.Environment) {
 			labelMap := make(map[string]string)
 			for _, labelPair := range parsedLabels {
 				pair := strings.Split(labelPair, "=")
-				labelMap[env.Interpolate(pair[0])] = env.Interpolate(pair[1])
+				labelMap[s.interpolate(env, pair[0])] = s.interpolate(env, pair[1])
 			}
 			s.labels = labelMap
 		}
 	}
 
 	if user, ok := s.data["user"]; ok {
-		s.user = env.Interpolate(user)
+		s.user = s.interpolate(env, user)
 	}
 
 	if forceTags, ok := s.data["force-tags"]; ok {
@@ -931,6 +885,16 @@ func (s *DockerPushStep) InitEnv(env *util.Environment) {
 	}
 }
 
+// interpolate expands the variables in value, the first error is kept so
+// Execute fails instead of pushing with blanks
+func (s *DockerPushStep) interpolate(env *util.Environment, value string) string {
+	interpolated, err := env.InterpolateChecked(value)
+	if err != nil && s.interpolateErr == nil {
+		s.interpolateErr = err
+	}
+	return interpolated
+}
+
 // Fetch NOP
 func (s *DockerPushStep) Fetch() (string, error) {
 	// nop
@@ -940,6 +904,10 @@ func (s *DockerPushStep) Fetch() (string, error) {
 // Execute commits the current container and pushes it to the configured
 // registry
 func (s *DockerPushStep) Execute(ctx context.Context, sess *core.Session) (int, error) {
+	if s.interpolateErr != nil {
+		return 1, s.interpolateErr
+	}
+
 	// TODO(termie): could probably re-use the tansport's client
 	client, err := NewDockerClient(s.dockerOptions)
 	if err != nil {
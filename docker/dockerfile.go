@@ -0,0 +1,399 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+// dockerfileRepository is where boxes built from a Dockerfile are kept,
+// they are tagged by the hash of their build context
+const dockerfileRepository = "wercker-box"
+
+// DockerfileContext is the build context of a box built from a Dockerfile,
+// paths are relative to the root of the project.
+type DockerfileContext struct {
+	root       string
+	dockerfile string
+	buildArgs  map[string]string
+	ignores    []*dockerignorePattern
+}
+
+// NewDockerfileContext resolves the context and Dockerfile of the config
+// against the project root and reads the .dockerignore, if any
+func NewDockerfileContext(config *core.BoxConfig, projectRoot string, env *util.Environment) (*DockerfileContext, error) {
+	projectRoot, err := filepath.EvalSymlinks(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Join(projectRoot, config.Context)
+	dockerfile, err := filepath.Rel(root, filepath.Join(projectRoot, config.Dockerfile))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(dockerfile, "..") {
+		return nil, fmt.Errorf("The dockerfile %s is not inside the context %s", config.Dockerfile, config.Context)
+	}
+
+	buildArgs := map[string]string{}
+	for k, v := range config.BuildArgs {
+		buildArgs[k] = env.Interpolate(v)
+	}
+
+	ignores, err := readDockerignore(filepath.Join(root, ".dockerignore"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DockerfileContext{
+		root:       root,
+		dockerfile: filepath.ToSlash(dockerfile),
+		buildArgs:  buildArgs,
+		ignores:    ignores,
+	}, nil
+}
+
+// dockerignorePattern is a line of a .dockerignore, an exception starts
+// with ! and brings back what the patterns before it excluded
+type dockerignorePattern struct {
+	pattern   *regexp.Regexp
+	exception bool
+}
+
+// readDockerignore reads the patterns in a .dockerignore file
+func readDockerignore(name string) ([]*dockerignorePattern, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return []*dockerignorePattern{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ignores := []*dockerignorePattern{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exception := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(strings.TrimPrefix(line, "!"))), "/")
+		pattern, err := dockerignoreRegexp(line)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q in %s: %s", line, name, err)
+		}
+		ignores = append(ignores, &dockerignorePattern{pattern: pattern, exception: exception})
+	}
+	return ignores, scanner.Err()
+}
+
+// dockerignoreRegexp converts a .dockerignore pattern to a regexp the way
+// docker does: * and ? don't match a /, ** matches any number of
+// directories
+func dockerignoreRegexp(pattern string) (*regexp.Regexp, error) {
+	var b bytes.Buffer
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case ch == '*' && strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case ch == '*':
+			b.WriteString("[^/]*")
+		case ch == '?':
+			b.WriteString("[^/]")
+		case ch == '[':
+			end := strings.Index(pattern[i:], "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case ch == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// ignored tells us whether a path or one of its parents matches the
+// .dockerignore, the last pattern that matches decides. The Dockerfile
+// itself is always sent along.
+func (c *DockerfileContext) ignored(rel string) bool {
+	if rel == c.dockerfile {
+		return false
+	}
+	// Our working dir is never part of a build
+	if rel == ".wercker" || strings.HasPrefix(rel, ".wercker/") {
+		return true
+	}
+	ignored := false
+	for _, ignore := range c.ignores {
+		for p := rel; p != "."; p = filepath.Dir(p) {
+			if ignore.pattern.MatchString(p) {
+				ignored = !ignore.exception
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// hasExceptions tells us whether an ignored directory can have files in it
+// that are not ignored
+func (c *DockerfileContext) hasExceptions() bool {
+	for _, ignore := range c.ignores {
+		if ignore.exception {
+			return true
+		}
+	}
+	return false
+}
+
+// files lists the files in the context in a stable order
+func (c *DockerfileContext) files() ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(c.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if c.ignored(rel) {
+			// Keep walking an ignored directory when an exception could bring
+			// back files in it, our working dir never comes back
+			if info.IsDir() && (rel == ".wercker" || !c.hasExceptions()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The walk skips the Dockerfile when its directory is ignored, docker
+	// sends it along anyway
+	dockerfileListed := false
+	for _, rel := range files {
+		if rel == c.dockerfile {
+			dockerfileListed = true
+			break
+		}
+	}
+	if !dockerfileListed {
+		if _, err := os.Lstat(filepath.Join(c.root, c.dockerfile)); err != nil {
+			return nil, err
+		}
+		files = append(files, c.dockerfile)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Hash is a hash of everything that goes into the image: the files in the
+// context, their modes, the Dockerfile's location and the build args
+func (c *DockerfileContext) Hash() (string, error) {
+	files, err := c.files()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "dockerfile %s\n", c.dockerfile)
+
+	args := []string{}
+	for k := range c.buildArgs {
+		args = append(args, k)
+	}
+	sort.Strings(args)
+	for _, k := range args {
+		fmt.Fprintf(h, "arg %s=%s\n", k, c.buildArgs[k])
+	}
+
+	for _, rel := range files {
+		path := filepath.Join(c.root, rel)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file %s %o\n", rel, info.Mode())
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "link %s\n", target)
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Tar writes the context as a tarball for the build API
+func (c *DockerfileContext) Tar(w io.Writer) error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, rel := range files {
+		path := filepath.Join(c.root, rel)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		hdr.Uid = 0
+		hdr.Gid = 0
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if link != "" {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// fetchDockerfile builds the box from its Dockerfile, unless an image for
+// the same context was built before
+func (b *DockerBox) fetchDockerfile(ctx context.Context, env *util.Environment) (*docker.Image, error) {
+	e, err := core.EmitterFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f := &util.Formatter{b.options.GlobalOptions.ShowColors}
+
+	buildContext, err := NewDockerfileContext(b.config, b.options.HostPath("source"), env)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := buildContext.Hash()
+	if err != nil {
+		return nil, err
+	}
+	b.tag = hash
+	b.Name = fmt.Sprintf("%s:%s", b.repository, b.tag)
+
+	image, err := b.client.InspectImage(b.Name)
+	if err == nil {
+		b.logger.Println(f.Info("Using box built earlier", b.Name))
+		b.image = image
+		return image, nil
+	}
+
+	b.logger.Println(f.Info("Building box from", b.config.Dockerfile))
+	buildArgs := []docker.BuildArg{}
+	for k, v := range buildContext.buildArgs {
+		buildArgs = append(buildArgs, docker.BuildArg{Name: k, Value: v})
+	}
+
+	// Stream the context straight into the build
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(buildContext.Tar(w))
+	}()
+	defer r.Close()
+
+	err = b.client.BuildImage(docker.BuildImageOptions{
+		Name:           b.Name,
+		Dockerfile:     buildContext.dockerfile,
+		BuildArgs:      buildArgs,
+		InputStream:    r,
+		OutputStream:   &logsWriter{e: e, stream: "docker"},
+		RmTmpContainer: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	image, err = b.client.InspectImage(b.Name)
+	if err != nil {
+		return nil, err
+	}
+	b.image = image
+	return image, nil
+}
@@ -0,0 +1,122 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+type DockerfileSuite struct {
+	*util.TestSuite
+}
+
+func TestDockerfileSuite(t *testing.T) {
+	suiteTester := &DockerfileSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *DockerfileSuite) writeFile(name, content string) {
+	path := filepath.Join(s.WorkingDir(), name)
+	s.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().Nil(ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func (s *DockerfileSuite) hash(config *core.BoxConfig) string {
+	buildContext, err := NewDockerfileContext(config, s.WorkingDir(), util.NewEnvironment())
+	s.Require().Nil(err)
+	hash, err := buildContext.Hash()
+	s.Require().Nil(err)
+	return hash
+}
+
+func (s *DockerfileSuite) TestHash() {
+	s.writeFile("ci/Dockerfile", "FROM busybox\n")
+	s.writeFile("main.go", "package main\n")
+	config := &core.BoxConfig{Dockerfile: "ci/Dockerfile"}
+
+	first := s.hash(config)
+	s.Equal(first, s.hash(config))
+
+	s.writeFile("main.go", "package main\n\nfunc main() {}\n")
+	changed := s.hash(config)
+	s.NotEqual(first, changed)
+
+	config.BuildArgs = map[string]string{"VERSION": "1"}
+	s.NotEqual(changed, s.hash(config))
+}
+
+func (s *DockerfileSuite) TestHashIgnores() {
+	s.writeFile("Dockerfile", "FROM busybox\n")
+	s.writeFile(".dockerignore", "# comment\nnode_modules\n*.log\n")
+	config := &core.BoxConfig{Dockerfile: "Dockerfile"}
+
+	first := s.hash(config)
+	s.writeFile("node_modules/left-pad/index.js", "module.exports = 1\n")
+	s.writeFile("build.log", "ok\n")
+	s.writeFile(".wercker/builds/1/out", "ok\n")
+	s.Equal(first, s.hash(config))
+}
+
+func (s *DockerfileSuite) files(config *core.BoxConfig) []string {
+	buildContext, err := NewDockerfileContext(config, s.WorkingDir(), util.NewEnvironment())
+	s.Require().Nil(err)
+	files, err := buildContext.files()
+	s.Require().Nil(err)
+	return files
+}
+
+func (s *DockerfileSuite) TestFilesDockerfileInIgnoredDir() {
+	s.writeFile("ci/Dockerfile", "FROM busybox\n")
+	s.writeFile("ci/deploy.sh", "exit 0\n")
+	s.writeFile(".dockerignore", "ci\n")
+	config := &core.BoxConfig{Dockerfile: "ci/Dockerfile"}
+
+	s.Equal([]string{".dockerignore", "ci/Dockerfile"}, s.files(config))
+}
+
+func (s *DockerfileSuite) TestFilesDockerignorePatterns() {
+	s.writeFile("Dockerfile", "FROM busybox\n")
+	s.writeFile(".dockerignore", "**/*.log\nnode_modules\n!node_modules/keep.js\ndocs/*.md\n")
+	s.writeFile("build.log", "ok\n")
+	s.writeFile("src/deep/test.log", "ok\n")
+	s.writeFile("src/main.go", "package main\n")
+	s.writeFile("node_modules/left-pad/index.js", "module.exports = 1\n")
+	s.writeFile("node_modules/keep.js", "module.exports = 2\n")
+	s.writeFile("docs/index.md", "# docs\n")
+	s.writeFile("docs/api/index.md", "# api\n")
+	config := &core.BoxConfig{Dockerfile: "Dockerfile"}
+
+	s.Equal([]string{
+		".dockerignore",
+		"Dockerfile",
+		"docs/api/index.md",
+		"node_modules/keep.js",
+		"src/main.go",
+	}, s.files(config))
+}
+
+func (s *DockerfileSuite) TestDockerfileOutsideContext() {
+	s.writeFile("ci/Dockerfile", "FROM busybox\n")
+	config := &core.BoxConfig{Dockerfile: "ci/Dockerfile", Context: "src"}
+	_, err := NewDockerfileContext(config, s.WorkingDir(), util.NewEnvironment())
+	s.NotNil(err)
+}
@@ -0,0 +1,202 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+// Healthcheck probes a service container until it is ready to be used by
+// the steps. The tcp and http probes run in a prober container that shares
+// the network of the service, so they reach the service the same way the box
+// does wherever the docker daemon runs. The cmd probe runs in the service.
+type Healthcheck struct {
+	config        *core.HealthcheckConfig
+	client        *DockerClient
+	dockerOptions *DockerOptions
+	logger        *util.LogEntry
+}
+
+// The prober container runs the tcp and http probes with the nc and wget of
+// busybox
+const (
+	healthcheckRepository = "busybox"
+	healthcheckTag        = "1.36"
+)
+
+// NewHealthcheck constructor
+func NewHealthcheck(config *core.HealthcheckConfig, client *DockerClient, dockerOptions *DockerOptions) *Healthcheck {
+	logger := util.RootLogger().WithField("Logger", "Healthcheck")
+	return &Healthcheck{config: config, client: client, dockerOptions: dockerOptions, logger: logger}
+}
+
+// Wait probes the container every interval until it passes, the container
+// exits or the timeout is reached
+func (h *Healthcheck) Wait(ctx context.Context, containerID string) error {
+	timeout := time.Duration(h.config.TimeoutOrDefault()) * time.Second
+	interval := time.Duration(h.config.IntervalOrDefault()) * time.Second
+	deadline := time.After(timeout)
+
+	probeID := containerID
+	if h.config.Cmd == "" {
+		prober, err := h.startProber(containerID, timeout)
+		if err != nil {
+			return err
+		}
+		defer h.removeProber(prober)
+		probeID = prober
+	}
+
+	for {
+		container, err := h.client.InspectContainer(containerID)
+		if err != nil {
+			return err
+		}
+		if !container.State.Running {
+			return fmt.Errorf("exited with status %d", container.State.ExitCode)
+		}
+
+		err = h.exec(probeID, h.probeCmd(containerIP(container), interval))
+		if err == nil {
+			return nil
+		}
+		h.logger.Debugln("Healthcheck failed:", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("not healthy after %s: %s", timeout, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// startProber starts a container in the network namespace of the service
+// to run the tcp and http probes in, it stops by itself a while after the
+// timeout in case it isn't removed. With --docker-local the image is never
+// pulled.
+func (h *Healthcheck) startProber(containerID string, timeout time.Duration) (string, error) {
+	image := fmt.Sprintf("%s:%s", healthcheckRepository, healthcheckTag)
+	if _, err := h.client.InspectImage(image); err != nil {
+		if h.dockerOptions.DockerLocal {
+			return "", fmt.Errorf("the healthcheck image %s is not available locally, pull it or use a cmd healthcheck", image)
+		}
+		h.logger.Debugln("Pulling healthcheck image", image)
+		options := docker.PullImageOptions{
+			Repository: healthcheckRepository,
+			Tag:        healthcheckTag,
+		}
+		if err := h.client.PullImage(options, docker.AuthConfiguration{}); err != nil {
+			return "", err
+		}
+	}
+
+	hostConfig := &docker.HostConfig{
+		NetworkMode: "container:" + containerID,
+	}
+	container, err := h.client.CreateContainer(
+		docker.CreateContainerOptions{
+			Config: &docker.Config{
+				Image: image,
+				Cmd:   []string{"sleep", fmt.Sprintf("%d", int(timeout.Seconds())+60)},
+			},
+			HostConfig: hostConfig,
+		})
+	if err != nil {
+		return "", err
+	}
+	if err := h.client.StartContainer(container.ID, hostConfig); err != nil {
+		h.removeProber(container.ID)
+		return "", err
+	}
+	return container.ID, nil
+}
+
+// removeProber removes the prober container
+func (h *Healthcheck) removeProber(containerID string) {
+	err := h.client.RemoveContainer(docker.RemoveContainerOptions{
+		ID:    containerID,
+		Force: true,
+	})
+	if err != nil {
+		h.logger.WithField("Error", err).Warnln("Wasn't able to remove healthcheck container", containerID)
+	}
+}
+
+// probeCmd is the command that runs the configured probe once, ip is the
+// address of the service
+func (h *Healthcheck) probeCmd(ip string, timeout time.Duration) []string {
+	seconds := fmt.Sprintf("%d", util.MaxInt(int(timeout.Seconds()), 1))
+	switch {
+	case h.config.TCP != "":
+		return []string{"nc", "-z", "-w", seconds, ip, h.config.TCP}
+	case h.config.HTTP != "":
+		// wget follows redirects and fails on a 4xx or 5xx
+		port, path := splitHTTPProbe(h.config.HTTP)
+		url := fmt.Sprintf("http://%s%s", net.JoinHostPort(ip, port), path)
+		return []string{"wget", "-q", "-T", seconds, "-O", "/dev/null", url}
+	default:
+		return []string{"/bin/sh", "-c", h.config.Cmd}
+	}
+}
+
+// exec runs a probe in the container
+func (h *Healthcheck) exec(containerID string, cmd []string) error {
+	var output bytes.Buffer
+	exit, err := h.client.ExecOneExit(containerID, cmd, &output)
+	if err != nil {
+		return err
+	}
+	if exit != 0 {
+		return fmt.Errorf("%q exited with %d: %s", strings.Join(cmd, " "), exit, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// splitHTTPProbe splits "8080/health" into the port and the path
+func splitHTTPProbe(probe string) (string, string) {
+	parts := strings.SplitN(probe, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], "/"
+	}
+	return parts[0], "/" + parts[1]
+}
+
+// containerIP finds the address of the container on the default network or
+// the first network it is connected to
+func containerIP(container *docker.Container) string {
+	if container.NetworkSettings == nil {
+		return ""
+	}
+	if container.NetworkSettings.IPAddress != "" {
+		return container.NetworkSettings.IPAddress
+	}
+	for _, network := range container.NetworkSettings.Networks {
+		if network.IPAddress != "" {
+			return network.IPAddress
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+type HealthcheckSuite struct {
+	*util.TestSuite
+}
+
+func TestHealthcheckSuite(t *testing.T) {
+	suiteTester := &HealthcheckSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *HealthcheckSuite) TestProbeCmd() {
+	tcp := NewHealthcheck(&core.HealthcheckConfig{TCP: "5432"}, nil, &DockerOptions{})
+	s.Equal([]string{"nc", "-z", "-w", "2", "10.0.0.2", "5432"}, tcp.probeCmd("10.0.0.2", 2*time.Second))
+
+	http := NewHealthcheck(&core.HealthcheckConfig{HTTP: "8080/health"}, nil, &DockerOptions{})
+	s.Equal([]string{"wget", "-q", "-T", "1", "-O", "/dev/null", "http://10.0.0.2:8080/health"}, http.probeCmd("10.0.0.2", 0))
+
+	cmd := NewHealthcheck(&core.HealthcheckConfig{Cmd: "pg_isready"}, nil, &DockerOptions{})
+	s.Equal([]string{"/bin/sh", "-c", "pg_isready"}, cmd.probeCmd("10.0.0.2", time.Second))
+}
+
+func (s *HealthcheckSuite) TestSplitHTTPProbe() {
+	port, path := splitHTTPProbe("8080")
+	s.Equal("8080", port)
+	s.Equal("/", path)
+
+	port, path = splitHTTPProbe("8080/api/health")
+	s.Equal("8080", port)
+	s.Equal("/api/health", path)
+}
@@ -0,0 +1,411 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Media types and annotations from the OCI image spec
+const (
+	OCIIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	OCIConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	OCILayerMediaType    = "application/vnd.oci.image.layer.v1.tar"
+
+	OCIRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	// ociImageNameAnnotation holds the full image name, containerd and
+	// docker use it when importing a layout
+	ociImageNameAnnotation = "io.containerd.image.name"
+)
+
+// OCIDescriptor points at a blob in an OCI image layout
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIIndex is the index.json of an OCI image layout
+type OCIIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []OCIDescriptor `json:"manifests"`
+}
+
+// OCIManifest describes an image by its config and layers
+type OCIManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        OCIDescriptor   `json:"config"`
+	Layers        []OCIDescriptor `json:"layers"`
+}
+
+// OCIImageConfig is the config blob of an image
+type OCIImageConfig struct {
+	Created      time.Time          `json:"created"`
+	Author       string             `json:"author,omitempty"`
+	Architecture string             `json:"architecture"`
+	OS           string             `json:"os"`
+	Config       OCIContainerConfig `json:"config"`
+	RootFS       OCIRootFS          `json:"rootfs"`
+	History      []OCIHistory       `json:"history,omitempty"`
+}
+
+// OCIContainerConfig are the defaults for containers run from an image
+type OCIContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+// OCIRootFS lists the digests of the uncompressed layers of an image
+type OCIRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+// OCIHistory describes how a layer was made
+type OCIHistory struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// dockerLoadManifest is an entry of the manifest.json that docker load reads
+type dockerLoadManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// OCILayout writes an OCI image layout as a tarball. It also writes the
+// manifest.json that docker load reads, so the tarball can be loaded into
+// docker as well as copied to a registry by OCI tooling.
+type OCILayout struct {
+	tw      *tar.Writer
+	blobs   map[string]bool
+	index   []OCIDescriptor
+	images  []dockerLoadManifest
+	created time.Time
+}
+
+// NewOCILayout constructor
+func NewOCILayout(w io.Writer) *OCILayout {
+	return &OCILayout{
+		tw:      tar.NewWriter(w),
+		blobs:   map[string]bool{},
+		created: time.Now(),
+	}
+}
+
+// ociBlobPath is the path of a blob in the layout
+func ociBlobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// AddBlobFile adds the file at path as a blob
+func (l *OCILayout) AddBlobFile(mediaType, path string) (OCIDescriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return OCIDescriptor{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return OCIDescriptor{}, err
+	}
+	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+		return OCIDescriptor{}, err
+	}
+
+	desc := OCIDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Size:      size,
+	}
+	return desc, l.writeBlob(desc, file)
+}
+
+// AddBlobBytes adds data as a blob
+func (l *OCILayout) AddBlobBytes(mediaType string, data []byte) (OCIDescriptor, error) {
+	hash := sha256.Sum256(data)
+	desc := OCIDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(hash[:]),
+		Size:      int64(len(data)),
+	}
+	return desc, l.writeBlob(desc, bytes.NewReader(data))
+}
+
+// writeBlob writes a blob once, images often share layers
+func (l *OCILayout) writeBlob(desc OCIDescriptor, r io.Reader) error {
+	if len(l.blobs) == 0 {
+		for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+			err := l.tw.WriteHeader(&tar.Header{
+				Name:     dir,
+				Mode:     0755,
+				ModTime:  l.created,
+				Typeflag: tar.TypeDir,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if l.blobs[desc.Digest] {
+		return nil
+	}
+	l.blobs[desc.Digest] = true
+	return l.writeFile(ociBlobPath(desc.Digest), desc.Size, r)
+}
+
+func (l *OCILayout) writeFile(name string, size int64, r io.Reader) error {
+	err := l.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  l.created,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(l.tw, r, size)
+	return err
+}
+
+func (l *OCILayout) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return l.writeFile(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// AddImage writes the manifest of an image whose config and layers have been
+// added and adds it to the index, tagged with refs like "repo:tag"
+func (l *OCILayout) AddImage(config OCIDescriptor, layers []OCIDescriptor, refs []string) (OCIDescriptor, error) {
+	manifest := OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     OCIManifestMediaType,
+		Config:        config,
+		Layers:        layers,
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return OCIDescriptor{}, err
+	}
+	desc, err := l.AddBlobBytes(OCIManifestMediaType, data)
+	if err != nil {
+		return OCIDescriptor{}, err
+	}
+
+	if len(refs) == 0 {
+		l.index = append(l.index, desc)
+	}
+	for _, ref := range refs {
+		tagged := desc
+		tagged.Annotations = map[string]string{
+			ociImageNameAnnotation: ref,
+			OCIRefNameAnnotation:   refTag(ref),
+		}
+		l.index = append(l.index, tagged)
+	}
+
+	image := dockerLoadManifest{
+		Config:   ociBlobPath(config.Digest),
+		RepoTags: refs,
+		Layers:   []string{},
+	}
+	for _, layer := range layers {
+		image.Layers = append(image.Layers, ociBlobPath(layer.Digest))
+	}
+	l.images = append(l.images, image)
+
+	return desc, nil
+}
+
+// refTag returns the tag of a ref like "registry:5000/repo:tag"
+func refTag(ref string) string {
+	i := strings.LastIndex(ref, ":")
+	if i == -1 || strings.Contains(ref[i:], "/") {
+		return "latest"
+	}
+	return ref[i+1:]
+}
+
+// Close writes the index and finishes the tarball
+func (l *OCILayout) Close() error {
+	err := l.writeJSON("oci-layout", map[string]string{"imageLayoutVersion": "1.0.0"})
+	if err != nil {
+		return err
+	}
+	index := OCIIndex{
+		SchemaVersion: 2,
+		MediaType:     OCIIndexMediaType,
+		Manifests:     l.index,
+	}
+	if index.Manifests == nil {
+		index.Manifests = []OCIDescriptor{}
+	}
+	if err := l.writeJSON("index.json", index); err != nil {
+		return err
+	}
+	if err := l.writeJSON("manifest.json", l.images); err != nil {
+		return err
+	}
+	return l.tw.Close()
+}
+
+// ConvertDockerSave writes the images in dir, an extracted docker save
+// tarball, to layout. The images are tagged with refs, or with the tags
+// docker saved when refs is empty.
+func ConvertDockerSave(dir string, refs []string, layout *OCILayout) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	var images []dockerLoadManifest
+	if err := json.Unmarshal(data, &images); err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("No images in %s", dir)
+	}
+
+	for _, image := range images {
+		config, err := layout.AddBlobFile(OCIConfigMediaType, filepath.Join(dir, filepath.FromSlash(image.Config)))
+		if err != nil {
+			return err
+		}
+		layers := []OCIDescriptor{}
+		for _, path := range image.Layers {
+			layer, err := layout.AddBlobFile(OCILayerMediaType, filepath.Join(dir, filepath.FromSlash(path)))
+			if err != nil {
+				return err
+			}
+			layers = append(layers, layer)
+		}
+		tags := refs
+		if len(tags) == 0 {
+			tags = image.RepoTags
+		}
+		if _, err := layout.AddImage(config, layers, tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractDockerSave extracts a docker save tarball to dir. Layers that are
+// the same are symlinked in there, those are kept.
+func extractDockerSave(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if name == "." || strings.HasPrefix(name, "..") || filepath.IsAbs(name) {
+			continue
+		}
+		fpath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(fpath, 0755)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, fpath)
+		case tar.TypeReg, tar.TypeRegA:
+			var file *os.File
+			file, err = os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tr)
+			file.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ExportOCIImage exports an image from docker and writes it to w as an OCI
+// image layout tarball, tagged with refs. name has to point at a single
+// image, a repository without a tag exports all of its tags. tempDir holds
+// the export while it is converted.
+func ExportOCIImage(client *DockerClient, name string, refs []string, w io.Writer, tempDir string) error {
+	dir, err := ioutil.TempDir(tempDir, "export-image-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	r, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(client.ExportImage(docker.ExportImageOptions{
+			Name:         name,
+			OutputStream: pw,
+		}))
+	}()
+	err = extractDockerSave(r, dir)
+	if err == nil {
+		// Read the padding after the tarball to get the result of the export
+		_, err = io.Copy(ioutil.Discard, r)
+	}
+	r.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	layout := NewOCILayout(w)
+	if err := ConvertDockerSave(dir, refs, layout); err != nil {
+		return err
+	}
+	return layout.Close()
+}
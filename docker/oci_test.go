@@ -0,0 +1,140 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type OCISuite struct {
+	*util.TestSuite
+}
+
+func TestOCISuite(t *testing.T) {
+	suiteTester := &OCISuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// readLayout reads the files in a layout tarball and checks that every blob
+// is stored under its digest
+func (s *OCISuite) readLayout(r io.Reader) map[string][]byte {
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		s.Require().Nil(err)
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		_, exists := files[hdr.Name]
+		s.False(exists, "duplicate entry %s", hdr.Name)
+		data, err := ioutil.ReadAll(tr)
+		s.Require().Nil(err)
+		files[hdr.Name] = data
+
+		if strings.HasPrefix(hdr.Name, "blobs/sha256/") {
+			hash := sha256.Sum256(data)
+			s.Equal(hdr.Name, "blobs/sha256/"+hex.EncodeToString(hash[:]))
+		}
+	}
+	return files
+}
+
+func (s *OCISuite) TestOCILayout() {
+	layerPath := filepath.Join(s.WorkingDir(), "layer.tar")
+	s.Require().Nil(ioutil.WriteFile(layerPath, []byte("layer"), 0644))
+
+	b := &bytes.Buffer{}
+	layout := NewOCILayout(b)
+	layer, err := layout.AddBlobFile(OCILayerMediaType, layerPath)
+	s.Require().Nil(err)
+	s.Equal(int64(5), layer.Size)
+	config, err := layout.AddBlobBytes(OCIConfigMediaType, []byte(`{"architecture":"amd64"}`))
+	s.Require().Nil(err)
+	manifest, err := layout.AddImage(config, []OCIDescriptor{layer}, []string{"registry.example.com:5000/app:v1"})
+	s.Require().Nil(err)
+	s.Require().Nil(layout.Close())
+
+	files := s.readLayout(b)
+	s.Equal(`{"imageLayoutVersion":"1.0.0"}`, string(files["oci-layout"]))
+
+	var index OCIIndex
+	s.Require().Nil(json.Unmarshal(files["index.json"], &index))
+	s.Equal(2, index.SchemaVersion)
+	s.Require().Len(index.Manifests, 1)
+	s.Equal(manifest.Digest, index.Manifests[0].Digest)
+	s.Equal("v1", index.Manifests[0].Annotations[OCIRefNameAnnotation])
+
+	var ociManifest OCIManifest
+	s.Require().Nil(json.Unmarshal(files[ociBlobPath(manifest.Digest)], &ociManifest))
+	s.Equal(config, ociManifest.Config)
+	s.Equal([]OCIDescriptor{layer}, ociManifest.Layers)
+
+	var images []dockerLoadManifest
+	s.Require().Nil(json.Unmarshal(files["manifest.json"], &images))
+	s.Require().Len(images, 1)
+	s.Equal(ociBlobPath(config.Digest), images[0].Config)
+	s.Equal([]string{"registry.example.com:5000/app:v1"}, images[0].RepoTags)
+	s.Equal([]string{ociBlobPath(layer.Digest)}, images[0].Layers)
+}
+
+func (s *OCISuite) TestConvertDockerSave() {
+	dir := s.WorkingDir()
+	s.Require().Nil(os.MkdirAll(filepath.Join(dir, "aaa"), 0755))
+	s.Require().Nil(os.MkdirAll(filepath.Join(dir, "bbb"), 0755))
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, "aaa", "layer.tar"), []byte("empty"), 0644))
+	// docker save links layers that are the same
+	s.Require().Nil(os.Symlink("../aaa/layer.tar", filepath.Join(dir, "bbb", "layer.tar")))
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, "ccc.json"), []byte(`{"os":"linux"}`), 0644))
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`[{"Config":"ccc.json","RepoTags":["build-1:latest"],"Layers":["aaa/layer.tar","bbb/layer.tar"]}]`), 0644))
+
+	b := &bytes.Buffer{}
+	layout := NewOCILayout(b)
+	s.Require().Nil(ConvertDockerSave(dir, nil, layout))
+	s.Require().Nil(layout.Close())
+
+	files := s.readLayout(b)
+	var images []dockerLoadManifest
+	s.Require().Nil(json.Unmarshal(files["manifest.json"], &images))
+	s.Require().Len(images, 1)
+	s.Equal([]string{"build-1:latest"}, images[0].RepoTags)
+	s.Require().Len(images[0].Layers, 2)
+	s.Equal(images[0].Layers[0], images[0].Layers[1])
+	s.Equal("empty", string(files[images[0].Layers[0]]))
+	s.Equal(`{"os":"linux"}`, string(files[images[0].Config]))
+}
+
+func (s *OCISuite) TestRefTag() {
+	s.Equal("v1", refTag("app:v1"))
+	s.Equal("latest", refTag("app"))
+	s.Equal("latest", refTag("registry.example.com:5000/app"))
+	s.Equal("v1", refTag("registry.example.com:5000/app:v1"))
+}
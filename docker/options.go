@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/wercker/wercker/util"
 )
 
@@ -30,6 +31,11 @@ type DockerOptions struct {
 	DockerCertPath  string
 	DockerDNS       []string
 	DockerLocal     bool
+	// Host policy for the resources boxes can ask for, zero is no limit
+	DockerMemoryLimit     int64
+	DockerCPUQuotaLimit   int64
+	DockerShmSizeLimit    int64
+	DockerAllowPrivileged bool
 }
 
 func guessAndUpdateDockerOptions(opts *DockerOptions, e *util.Environment) {
@@ -107,13 +113,28 @@ func NewDockerOptions(c util.Settings, e *util.Environment) (*DockerOptions, err
 	dockerCertPath, _ := c.String("docker-cert-path")
 	dockerDNS, _ := c.StringSlice("docker-dns")
 	dockerLocal, _ := c.Bool("docker-local")
+	dockerCPUQuotaLimit, _ := c.Int("docker-cpu-quota-limit")
+	dockerAllowPrivileged, _ := c.Bool("docker-allow-privileged")
+
+	dockerMemoryLimit, err := sizeSetting(c, "docker-memory-limit")
+	if err != nil {
+		return nil, err
+	}
+	dockerShmSizeLimit, err := sizeSetting(c, "docker-shm-size-limit")
+	if err != nil {
+		return nil, err
+	}
 
 	speculativeOptions := &DockerOptions{
-		DockerHost:      dockerHost,
-		DockerTLSVerify: dockerTLSVerify,
-		DockerCertPath:  dockerCertPath,
-		DockerDNS:       dockerDNS,
-		DockerLocal:     dockerLocal,
+		DockerHost:            dockerHost,
+		DockerTLSVerify:       dockerTLSVerify,
+		DockerCertPath:        dockerCertPath,
+		DockerDNS:             dockerDNS,
+		DockerLocal:           dockerLocal,
+		DockerMemoryLimit:     dockerMemoryLimit,
+		DockerCPUQuotaLimit:   int64(dockerCPUQuotaLimit),
+		DockerShmSizeLimit:    dockerShmSizeLimit,
+		DockerAllowPrivileged: dockerAllowPrivileged,
 	}
 
 	// We're going to try out a few settings and set DockerHost if
@@ -122,3 +143,16 @@ func NewDockerOptions(c util.Settings, e *util.Environment) (*DockerOptions, err
 	guessAndUpdateDockerOptions(speculativeOptions, e)
 	return speculativeOptions, nil
 }
+
+// sizeSetting reads a size like "2g" from the settings, empty is zero
+func sizeSetting(c util.Settings, name string) (int64, error) {
+	value, _ := c.String(name)
+	if value == "" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, err)
+	}
+	return size, nil
+}
@@ -74,6 +74,9 @@ func NewDockerPipeline(name string, config *core.Config, options *core.PipelineO
 	if err != nil {
 		return nil, err
 	}
+	if len(pipelineConfig.Secrets) > 0 {
+		box.MountSecrets()
+	}
 
 	var services []core.ServiceBox
 	for _, serviceConfig := range servicesConfig {
@@ -0,0 +1,107 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package dockerlocal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/wercker/wercker/core"
+)
+
+// applyResources sets the resource limits and runtime options from the box
+// config on the host config, refusing anything the host policy in the
+// DockerOptions doesn't allow. Limits the box leaves out default to the
+// policy so a box can't go unbounded either.
+func applyResources(hostConfig *docker.HostConfig, config *core.BoxConfig, options *DockerOptions) error {
+	memory, err := limitSize("memory", config.Memory, options.DockerMemoryLimit)
+	if err != nil {
+		return err
+	}
+	shmSize, err := limitSize("shm-size", config.ShmSize, options.DockerShmSizeLimit)
+	if err != nil {
+		return err
+	}
+
+	cpuQuota := config.CPUQuota
+	if limit := options.DockerCPUQuotaLimit; limit > 0 {
+		if cpuQuota > limit {
+			return fmt.Errorf("cpu-quota %d is over the limit of %d", cpuQuota, limit)
+		}
+		if cpuQuota == 0 {
+			cpuQuota = limit
+		}
+	}
+
+	if (config.Privileged || len(config.CapAdd) > 0) && !options.DockerAllowPrivileged {
+		return fmt.Errorf("privileged and cap-add are not allowed, use --docker-allow-privileged")
+	}
+
+	ulimits := []docker.ULimit{}
+	for _, value := range config.Ulimits {
+		ulimit, err := units.ParseUlimit(value)
+		if err != nil {
+			return err
+		}
+		ulimits = append(ulimits, docker.ULimit{Name: ulimit.Name, Soft: ulimit.Soft, Hard: ulimit.Hard})
+	}
+
+	tmpfs := map[string]string{}
+	for _, value := range config.Tmpfs {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) == 1 {
+			tmpfs[parts[0]] = ""
+		} else {
+			tmpfs[parts[0]] = parts[1]
+		}
+	}
+
+	hostConfig.Memory = memory
+	hostConfig.ShmSize = shmSize
+	hostConfig.CPUShares = config.CPUShares
+	if cpuQuota > 0 {
+		hostConfig.CPUQuota = cpuQuota
+		hostConfig.CPUPeriod = 100000
+	}
+	hostConfig.Ulimits = ulimits
+	hostConfig.Privileged = config.Privileged
+	hostConfig.CapAdd = config.CapAdd
+	hostConfig.CapDrop = config.CapDrop
+	hostConfig.Tmpfs = tmpfs
+	return nil
+}
+
+// limitSize parses a size and checks it against the limit
+func limitSize(name, value string, limit int64) (int64, error) {
+	var size int64
+	if value != "" {
+		var err error
+		size, err = units.RAMInBytes(value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if limit > 0 {
+		if size > limit {
+			return 0, fmt.Errorf("%s %s is over the limit of %s", name, value, units.BytesSize(float64(limit)))
+		}
+		if size == 0 {
+			size = limit
+		}
+	}
+	return size, nil
+}
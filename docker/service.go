@@ -46,6 +46,8 @@ func NewNilBuilder() *nilBuilder {
 type InternalServiceBox struct {
 	*DockerBox
 	logger *util.LogEntry
+	// logs is kept here, external services replace their DockerBox
+	logs string
 }
 
 // ExternalServiceBox wraps a box as a service
@@ -60,7 +62,7 @@ func NewExternalServiceBox(boxConfig *core.BoxConfig, options *core.PipelineOpti
 	logger := util.RootLogger().WithField("Logger", "ExternalService")
 	box := &DockerBox{options: options, dockerOptions: dockerOptions, config: boxConfig}
 	return &ExternalServiceBox{
-		InternalServiceBox: &InternalServiceBox{DockerBox: box, logger: logger},
+		InternalServiceBox: &InternalServiceBox{DockerBox: box, logger: logger, logs: boxConfig.Logs},
 		externalConfig:     boxConfig,
 		builder:            builder,
 	}, nil
@@ -91,7 +93,7 @@ func NewServiceBox(config *core.BoxConfig, options *core.PipelineOptions, docker
 func NewInternalServiceBox(boxConfig *core.BoxConfig, options *core.PipelineOptions, dockerOptions *DockerOptions) (*InternalServiceBox, error) {
 	box, err := NewDockerBox(boxConfig, options, dockerOptions)
 	logger := util.RootLogger().WithField("Logger", "Service")
-	return &InternalServiceBox{DockerBox: box, logger: logger}, err
+	return &InternalServiceBox{DockerBox: box, logger: logger, logs: boxConfig.Logs}, err
 }
 
 // TODO(mh) need to add to interface?
@@ -105,8 +107,13 @@ func (b *InternalServiceBox) getContainerName() string {
 	return strings.Replace(containerName, ":", "_", -1)
 }
 
+// stream is the name of the Logs stream for the output of this service
+func (b *InternalServiceBox) stream() string {
+	return fmt.Sprintf("service:%s", b.Alias())
+}
+
 // Run executes the service
-func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, links []string) (*docker.Container, error) {
+func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, network string, serviceEnv []string) (*docker.Container, error) {
 	e, err := core.EmitterFromContext(ctx)
 	if err != nil {
 		return nil, err
@@ -120,6 +127,7 @@ func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, lin
 
 	// Import the environment and command
 	myEnv := dockerEnv(b.config.Env, env)
+	linkedEnv := append(myEnv, serviceEnv...)
 
 	origEntrypoint := b.image.Config.Entrypoint
 	origCmd := b.image.Config.Cmd
@@ -156,7 +164,11 @@ func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, lin
 	hostConfig := &docker.HostConfig{
 		DNS:          b.dockerOptions.DockerDNS,
 		PortBindings: portBindings(portsToBind),
-		Links:        links,
+		NetworkMode:  network,
+	}
+	err = applyResources(hostConfig, b.config, b.dockerOptions)
+	if err != nil {
+		return nil, err
 	}
 
 	container, err := client.CreateContainer(
@@ -165,13 +177,15 @@ func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, lin
 			Config: &docker.Config{
 				Image:           b.Name,
 				Cmd:             cmd,
-				Env:             myEnv,
+				Env:             linkedEnv,
 				ExposedPorts:    exposedPorts(b.config.Ports),
 				NetworkDisabled: b.networkDisabled,
 				DNS:             b.dockerOptions.DockerDNS,
 				Entrypoint:      entrypoint,
+				User:            b.config.User,
 			},
-			HostConfig: hostConfig,
+			HostConfig:       hostConfig,
+			NetworkingConfig: networkingConfig(network, b.Alias()),
 		})
 
 	if err != nil {
@@ -193,6 +207,17 @@ func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, lin
 	client.StartContainer(container.ID, hostConfig)
 	b.container = container
 
+	// Docker doesn't give us link variables on a network, make our own
+	inspected, err := client.InspectContainer(container.ID)
+	if err != nil {
+		return nil, err
+	}
+	b.linkEnv = linkEnv(b.Alias(), networkIP(inspected, network), inspected.Config.ExposedPorts, myEnv)
+
+	if b.logs == "true" {
+		go b.followLogs(e, client, container.ID)
+	}
+
 	go func() {
 		status, err := client.WaitContainer(container.ID)
 		if err != nil {
@@ -200,33 +225,120 @@ func (b *InternalServiceBox) Run(ctx context.Context, env *util.Environment, lin
 		}
 		b.logger.Debugln("Service container finished with status code:", status, container.ID)
 
-		if status != 0 {
-			var errstream bytes.Buffer
-			var outstream bytes.Buffer
-			// recv := make(chan string)
-			// outputStream := NewReceiver(recv)
-			opts := docker.LogsOptions{
-				Container:    container.ID,
-				Stdout:       true,
-				Stderr:       true,
-				ErrorStream:  &errstream,
-				OutputStream: &outstream,
-				RawTerminal:  false,
-			}
-			err = client.Logs(opts)
-			if err != nil {
-				b.logger.Panicln(err)
-			}
-			e.Emit(core.Logs, &core.LogsArgs{
-				Stream: fmt.Sprintf("%s-stdout", b.Name),
-				Logs:   outstream.String(),
-			})
+		// When we are following the logs we have shown all of it already
+		if status != 0 && b.logs != "true" {
 			e.Emit(core.Logs, &core.LogsArgs{
-				Stream: fmt.Sprintf("%s-stderr", b.Name),
-				Logs:   errstream.String(),
+				Stream: b.stream(),
+				Logs:   b.lastLogs(client),
 			})
 		}
 	}()
 
 	return container, nil
 }
+
+// logsWriter emits everything written to it as Logs on a stream
+type logsWriter struct {
+	e      *core.NormalizedEmitter
+	stream string
+}
+
+func (w *logsWriter) Write(p []byte) (int, error) {
+	w.e.Emit(core.Logs, &core.LogsArgs{
+		Stream: w.stream,
+		Logs:   string(p),
+	})
+	return len(p), nil
+}
+
+// followLogs emits the output of the service until its container stops
+func (b *InternalServiceBox) followLogs(e *core.NormalizedEmitter, client *DockerClient, containerID string) {
+	w := &logsWriter{e: e, stream: b.stream()}
+	err := client.Logs(docker.LogsOptions{
+		Container:    containerID,
+		Follow:       true,
+		Stdout:       true,
+		Stderr:       true,
+		OutputStream: w,
+		ErrorStream:  w,
+		RawTerminal:  false,
+	})
+	if err != nil {
+		b.logger.Debugln("Stopped following service logs:", err)
+	}
+}
+
+// DumpLogs emits the tail of the service's logs, we do this for every
+// service that is not already streaming them when a step fails
+func (b *InternalServiceBox) DumpLogs(ctx context.Context) error {
+	if b.container == nil || b.logs == "true" || b.logs == "false" {
+		return nil
+	}
+	e, err := core.EmitterFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := NewDockerClient(b.dockerOptions)
+	if err != nil {
+		return err
+	}
+	e.Emit(core.Logs, &core.LogsArgs{
+		Stream: b.stream(),
+		Logs:   b.lastLogs(client),
+	})
+	return nil
+}
+
+// WaitHealthy blocks until the healthcheck of the service passes, services
+// without a healthcheck are considered ready as soon as they are started
+func (b *InternalServiceBox) WaitHealthy(ctx context.Context) error {
+	return b.waitHealthy(ctx, b.config.Healthcheck)
+}
+
+// WaitHealthy uses the healthcheck from the original config, the box we
+// built does not know about it
+func (s *ExternalServiceBox) WaitHealthy(ctx context.Context) error {
+	return s.waitHealthy(ctx, s.externalConfig.Healthcheck)
+}
+
+func (b *InternalServiceBox) waitHealthy(ctx context.Context, config *core.HealthcheckConfig) error {
+	if config == nil || b.container == nil {
+		return nil
+	}
+	f := &util.Formatter{}
+
+	client, err := NewDockerClient(b.dockerOptions)
+	if err != nil {
+		return err
+	}
+
+	timer := util.NewTimer()
+	err = NewHealthcheck(config, client, b.dockerOptions).Wait(ctx, b.container.ID)
+	if err != nil {
+		return fmt.Errorf("Service %s is not ready, %s\n%s", b.ShortName, err, b.lastLogs(client))
+	}
+	if b.options.Verbose {
+		b.logger.Println(f.Success(fmt.Sprintf("Service %s is ready", b.ShortName), timer.String()))
+	}
+	return nil
+}
+
+// lastLogs grabs the tail of the service's output to help explain why it
+// did not come up
+func (b *InternalServiceBox) lastLogs(client *DockerClient) string {
+	var logs bytes.Buffer
+	err := client.Logs(docker.LogsOptions{
+		Container:    b.container.ID,
+		Stdout:       true,
+		Stderr:       true,
+		OutputStream: &logs,
+		ErrorStream:  &logs,
+		Tail:         "50",
+		RawTerminal:  false,
+	})
+	if err != nil {
+		b.logger.Debugln("Failed to get service logs:", err)
+		return ""
+	}
+	return logs.String()
+}
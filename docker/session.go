@@ -15,6 +15,7 @@
 package dockerlocal
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/fsouza/go-dockerclient"
@@ -23,6 +24,13 @@ import (
 	"golang.org/x/net/context"
 )
 
+func protocolFor(options *core.PipelineOptions) core.Protocol {
+	if options.CommandProtocol == "framed" {
+		return core.NewFramedProtocol()
+	}
+	return core.NewSentinelProtocol()
+}
+
 // DockerTransport for docker containers
 type DockerTransport struct {
 	options     *core.PipelineOptions
@@ -41,6 +49,12 @@ func NewDockerTransport(options *core.PipelineOptions, dockerOptions *DockerOpti
 	return &DockerTransport{options: options, client: client, containerID: containerID, logger: logger}, nil
 }
 
+// Protocol picks the protocol from the options, boxes without a POSIX shell
+// need the sentinel protocol.
+func (t *DockerTransport) Protocol() core.Protocol {
+	return protocolFor(t.options)
+}
+
 // Attach the given reader and writers to the transport, return a context
 // that will be closed when the transport dies
 func (t *DockerTransport) Attach(sessionCtx context.Context, stdin io.Reader, stdout, stderr io.Writer) (context.Context, error) {
@@ -60,8 +74,8 @@ func (t *DockerTransport) Attach(sessionCtx context.Context, stdin io.Reader, st
 		Logs:         false,
 		Success:      started,
 		InputStream:  stdin,
-		ErrorStream:  stdout,
-		OutputStream: stderr,
+		ErrorStream:  stderr,
+		OutputStream: stdout,
 		RawTerminal:  false,
 	}
 
@@ -86,3 +100,82 @@ func (t *DockerTransport) Attach(sessionCtx context.Context, stdin io.Reader, st
 	started <- struct{}{}
 	return transportCtx, nil
 }
+
+// DockerExecTransport starts a new shell in a running container, unlike
+// DockerTransport which attaches to the main process, so we can have multiple
+// sessions in the same container at the same time.
+type DockerExecTransport struct {
+	options     *core.PipelineOptions
+	client      *DockerClient
+	containerID string
+	logger      *util.LogEntry
+}
+
+// NewDockerExecTransport constructor
+func NewDockerExecTransport(options *core.PipelineOptions, dockerOptions *DockerOptions, containerID string) (core.Transport, error) {
+	client, err := NewDockerClient(dockerOptions)
+	if err != nil {
+		return nil, err
+	}
+	logger := util.RootLogger().WithField("Logger", "DockerExecTransport")
+	return &DockerExecTransport{options: options, client: client, containerID: containerID, logger: logger}, nil
+}
+
+// Protocol picks the protocol from the options
+func (t *DockerExecTransport) Protocol() core.Protocol {
+	return protocolFor(t.options)
+}
+
+// Attach starts the same command as the main process of the container and
+// connects the given reader and writers to it, return a context that will be
+// closed when the command exits
+func (t *DockerExecTransport) Attach(sessionCtx context.Context, stdin io.Reader, stdout, stderr io.Writer) (context.Context, error) {
+	t.logger.Debugln("Starting exec in container: ", t.containerID)
+	container, err := t.client.InspectContainer(t.containerID)
+	if err != nil {
+		return nil, err
+	}
+	cmd := append([]string{}, container.Config.Entrypoint...)
+	cmd = append(cmd, container.Config.Cmd...)
+
+	exec, err := t.client.CreateExec(docker.CreateExecOptions{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+		Cmd:          cmd,
+		Container:    t.containerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	started := make(chan struct{})
+	transportCtx, cancel := context.WithCancel(sessionCtx)
+
+	opts := docker.StartExecOptions{
+		InputStream:  stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		RawTerminal:  false,
+		Success:      started,
+	}
+
+	go func() {
+		defer cancel()
+		err := t.client.StartExec(exec.ID, opts)
+		if err != nil {
+			t.logger.Errorln("Error running exec", err)
+		}
+		t.logger.Debugln("Exec finished", exec.ID, t.containerID)
+	}()
+
+	// Wait for the exec to start, it may fail before that happens
+	select {
+	case <-started:
+		started <- struct{}{}
+	case <-transportCtx.Done():
+		return nil, fmt.Errorf("Unable to start a new session in container %s", t.containerID)
+	}
+	return transportCtx, nil
+}
@@ -49,13 +49,17 @@ func NewShellStep(stepConfig *core.StepConfig, options *core.PipelineOptions, do
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
 	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
+		DisplayName:       displayName,
+		Env:               &util.Environment{},
+		ID:                name,
+		Name:              name,
+		Owner:             "wercker",
+		SafeID:            stepSafeID,
+		Version:           util.Version(),
+		When:              stepConfig.When,
+		Timeout:           stepConfig.Timeout,
+		NoResponseTimeout: stepConfig.NoResponseTimeout,
+		Retry:             stepConfig.Retry,
 	})
 
 	return &ShellStep{
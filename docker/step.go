@@ -16,16 +16,21 @@ package dockerlocal
 
 import (
 	"io"
-	"path/filepath"
 	"strings"
 
-	"github.com/fsouza/go-dockerclient"
 	"github.com/wercker/wercker/core"
 	"github.com/wercker/wercker/util"
 )
 
 func NewStep(config *core.StepConfig, options *core.PipelineOptions, dockerOptions *DockerOptions) (core.Step, error) {
 	// NOTE(termie) Special case steps are special
+	if len(config.Parallel) > 0 {
+		group, err := NewParallelStep(config, options, dockerOptions)
+		if err != nil || group == nil {
+			return nil, err
+		}
+		return group, nil
+	}
 	if config.ID == "internal/docker-push" {
 		return NewDockerPushStep(config, options, dockerOptions)
 	}
@@ -52,6 +57,25 @@ func NewStep(config *core.StepConfig, options *core.PipelineOptions, dockerOptio
 	return NewDockerStep(config, options, dockerOptions)
 }
 
+// NewParallelStep creates the children of a parallel group
+func NewParallelStep(config *core.StepConfig, options *core.PipelineOptions, dockerOptions *DockerOptions) (*core.ParallelStep, error) {
+	var steps []core.Step
+	for _, childConfig := range config.Parallel {
+		step, err := NewStep(childConfig.StepConfig, options, dockerOptions)
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			steps = append(steps, step)
+		}
+	}
+	// every child may have been an ignored dev step
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	return core.NewParallelStep(steps), nil
+}
+
 // DockerStep is an external step that knows how to fetch artifacts
 type DockerStep struct {
 	*core.ExternalStep
@@ -85,26 +109,7 @@ func (s *DockerStep) CollectFile(containerID, path, name string, dst io.Writer)
 	if err != nil {
 		return err
 	}
-
-	pipeReader, pipeWriter := io.Pipe()
-
-	opts := docker.DownloadFromContainerOptions{
-		OutputStream: pipeWriter,
-		Path:         filepath.Join(path, name),
-	}
-
-	errs := make(chan error)
-	go func() {
-		defer close(errs)
-		errs <- util.UntarOne(name, dst, pipeReader)
-	}()
-
-	if err = client.DownloadFromContainer(containerID, opts); err != nil {
-		s.logger.Debug("Probably expected error:", err)
-		return util.ErrEmptyTarball
-	}
-
-	return <-errs
+	return client.CollectFile(containerID, path, name, dst)
 }
 
 // CollectArtifact copies the artifacts associated with the Step.
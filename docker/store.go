@@ -15,6 +15,7 @@
 package dockerlocal
 
 import (
+	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -51,13 +52,17 @@ func NewStoreContainerStep(stepConfig *core.StepConfig, options *core.PipelineOp
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
 	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
+		DisplayName:       displayName,
+		Env:               &util.Environment{},
+		ID:                name,
+		Name:              name,
+		Owner:             "wercker",
+		SafeID:            stepSafeID,
+		Version:           util.Version(),
+		When:              stepConfig.When,
+		Timeout:           stepConfig.Timeout,
+		NoResponseTimeout: stepConfig.NoResponseTimeout,
+		Retry:             stepConfig.Retry,
 	})
 
 	return &StoreContainerStep{
@@ -151,13 +156,17 @@ func (s *StoreContainerStep) Execute(ctx context.Context, sess *core.Session) (i
 	}
 
 	hash := sha256.New()
-	w := snappystream.NewWriter(io.MultiWriter(file, hash))
-
-	exportImageOptions := docker.ExportImageOptions{
-		Name:         repoName,
-		OutputStream: w,
+	// Snappy frames every write, buffer the small writes of the tarball up to
+	// the 64k blocks it compresses
+	w := bufio.NewWriterSize(snappystream.NewWriter(io.MultiWriter(file, hash)), 64*1024)
+
+	// The image is stored as an OCI image layout that docker load also reads,
+	// only the committed tag is exported, the repository may have others
+	ref := fmt.Sprintf("%s:%s", repoName, tag)
+	err = ExportOCIImage(client, ref, []string{ref}, w, s.options.BuildPath())
+	if err == nil {
+		err = w.Flush()
 	}
-	err = client.ExportImage(exportImageOptions)
 	if err != nil {
 		s.logger.WithField("Error", err).Error("Unable to export image")
 		return -1, err
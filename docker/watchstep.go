@@ -61,13 +61,17 @@ func NewWatchStep(stepConfig *core.StepConfig, options *core.PipelineOptions, do
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
 	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         util.NewEnvironment(),
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
+		DisplayName:       displayName,
+		Env:               util.NewEnvironment(),
+		ID:                name,
+		Name:              name,
+		Owner:             "wercker",
+		SafeID:            stepSafeID,
+		Version:           util.Version(),
+		When:              stepConfig.When,
+		Timeout:           stepConfig.Timeout,
+		NoResponseTimeout: stepConfig.NoResponseTimeout,
+		Retry:             stepConfig.Retry,
 	})
 
 	return &WatchStep{
@@ -212,6 +216,11 @@ func (s *WatchStep) Execute(ctx context.Context, sess *core.Session) (int, error
 					// Hidden: sess.logsHidden,
 					Logs: line,
 				})
+			case line := <-sess.RecvErr():
+				e.Emit(core.Logs, &core.LogsArgs{
+					Stream: "stderr",
+					Logs:   line,
+				})
 			// We need to make sure we stop eating the stdout from the container
 			// promiscuously when we finish out step
 			case <-stopListening:
@@ -0,0 +1,271 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+// JSONLinesVersion is the schema version of the events written by the
+// JSONLinesHandler, it is bumped when fields change meaning or go away.
+// Adding fields does not change the version.
+const JSONLinesVersion = 1
+
+// JSONLinesEvent is a single line of the event stream, only the fields that
+// apply to the event are set.
+type JSONLinesEvent struct {
+	Version    int       `json:"version"`
+	Event      string    `json:"event"`
+	Timestamp  time.Time `json:"timestamp"`
+	BuildID    string    `json:"buildId,omitempty"`
+	DeployID   string    `json:"deployId,omitempty"`
+	PipelineID string    `json:"pipelineId,omitempty"`
+	Pipeline   string    `json:"pipeline,omitempty"`
+
+	// BuildStepsAdded
+	Steps []*JSONLinesStep `json:"steps,omitempty"`
+
+	// BuildStepStarted, BuildStepFinished and Logs
+	Step *JSONLinesStep `json:"step,omitempty"`
+
+	// Logs
+	Stream string `json:"stream,omitempty"`
+	Logs   string `json:"logs,omitempty"`
+
+	// BuildStepFinished
+	Successful  *bool  `json:"successful,omitempty"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Message     string `json:"message,omitempty"`
+	ArtifactURL string `json:"artifactUrl,omitempty"`
+	PackageURL  string `json:"packageUrl,omitempty"`
+
+	// BuildFinished
+	Result string `json:"result,omitempty"`
+
+	// FullPipelineFinished
+	MainSuccessful       *bool `json:"mainSuccessful,omitempty"`
+	RanAfterSteps        *bool `json:"ranAfterSteps,omitempty"`
+	AfterStepsSuccessful *bool `json:"afterStepsSuccessful,omitempty"`
+}
+
+// JSONLinesStep identifies a step, Order matches the order of the other
+// events of the step. SafeID is unique for every run of a step.
+type JSONLinesStep struct {
+	ID          string `json:"id"`
+	SafeID      string `json:"safeId"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Order       int    `json:"order"`
+	Phase       string `json:"phase,omitempty"`
+}
+
+// NewJSONLinesHandler will create a new JSONLinesHandler writing to out, which
+// is a path, a file descriptor number or - for stdout.
+func NewJSONLinesHandler(out string) (*JSONLinesHandler, error) {
+	var w io.WriteCloser
+	if out == "-" {
+		w = os.Stdout
+	} else if fd, err := strconv.ParseUint(out, 10, 32); err == nil {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if _, err := f.Stat(); err != nil {
+			return nil, fmt.Errorf("Invalid events file descriptor %d: %s", fd, err)
+		}
+		w = f
+	} else {
+		f, err := os.Create(out)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return newJSONLinesHandler(w), nil
+}
+
+func newJSONLinesHandler(w io.WriteCloser) *JSONLinesHandler {
+	logger := util.RootLogger().WithField("Logger", "JSONLines")
+	return &JSONLinesHandler{
+		w:       w,
+		encoder: json.NewEncoder(w),
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// A JSONLinesHandler writes all events as JSON, one per line.
+type JSONLinesHandler struct {
+	w       io.WriteCloser
+	encoder *json.Encoder
+	logger  *util.LogEntry
+	now     func() time.Time
+	// stopped is set after a write error or Close
+	stopped bool
+}
+
+// mapJSONLinesSteps converts steps to the event format, they are numbered like
+// the ReportHandler does.
+func mapJSONLinesSteps(counter *util.Counter, phase string, steps ...core.Step) []*JSONLinesStep {
+	steps = core.FlattenSteps(steps...)
+	buffer := make([]*JSONLinesStep, len(steps))
+	for i, s := range steps {
+		buffer[i] = newJSONLinesStep(s, counter.Increment())
+		buffer[i].Phase = phase
+	}
+	return buffer
+}
+
+func newJSONLinesStep(step core.Step, order int) *JSONLinesStep {
+	if step == nil {
+		return nil
+	}
+	return &JSONLinesStep{
+		ID:          step.ID(),
+		SafeID:      step.SafeID(),
+		Name:        step.Name(),
+		DisplayName: step.DisplayName(),
+		Order:       order,
+	}
+}
+
+// newEvent fills in the fields shared by all events
+func (h *JSONLinesHandler) newEvent(event string, options *core.PipelineOptions) *JSONLinesEvent {
+	e := &JSONLinesEvent{
+		Version:   JSONLinesVersion,
+		Event:     event,
+		Timestamp: h.now().UTC(),
+	}
+	if options != nil {
+		e.BuildID = options.BuildID
+		e.DeployID = options.DeployID
+		e.PipelineID = options.PipelineID
+		e.Pipeline = options.Pipeline
+	}
+	return e
+}
+
+// write encodes e as a single line, after the first error the events are
+// dropped so a closed pipe doesn't fail the build.
+func (h *JSONLinesHandler) write(e *JSONLinesEvent) {
+	if h.stopped {
+		return
+	}
+	if err := h.encoder.Encode(e); err != nil {
+		h.stopped = true
+		h.logger.WithField("Error", err).Error("Unable to write event, not writing any more events")
+	}
+}
+
+// BuildStarted will handle the BuildStarted event.
+func (h *JSONLinesHandler) BuildStarted(args *core.BuildStartedArgs) {
+	h.write(h.newEvent(core.BuildStarted, args.Options))
+}
+
+// BuildStepsAdded will handle the BuildStepsAdded event.
+func (h *JSONLinesHandler) BuildStepsAdded(args *core.BuildStepsAddedArgs) {
+	stepCounter := &util.Counter{Current: 3}
+	steps := mapJSONLinesSteps(stepCounter, "mainSteps", args.Steps...)
+
+	if args.StoreStep != nil {
+		storeStep := mapJSONLinesSteps(stepCounter, "mainSteps", args.StoreStep)
+		steps = append(steps, storeStep...)
+	}
+
+	afterSteps := mapJSONLinesSteps(stepCounter, "finalSteps", args.AfterSteps...)
+	steps = append(steps, afterSteps...)
+
+	e := h.newEvent(core.BuildStepsAdded, args.Options)
+	e.Steps = steps
+	h.write(e)
+}
+
+// BuildStepStarted will handle the BuildStepStarted event.
+func (h *JSONLinesHandler) BuildStepStarted(args *core.BuildStepStartedArgs) {
+	e := h.newEvent(core.BuildStepStarted, args.Options)
+	e.Step = newJSONLinesStep(args.Step, args.Order)
+	h.write(e)
+}
+
+// Logs will handle the Logs event, hidden logs are not written.
+func (h *JSONLinesHandler) Logs(args *core.LogsArgs) {
+	if args.Hidden {
+		return
+	}
+	e := h.newEvent(core.Logs, args.Options)
+	e.Step = newJSONLinesStep(args.Step, args.Order)
+	e.Stream = args.Stream
+	e.Logs = args.Logs
+	h.write(e)
+}
+
+// BuildStepFinished will handle the BuildStepFinished event.
+func (h *JSONLinesHandler) BuildStepFinished(args *core.BuildStepFinishedArgs) {
+	successful := args.Successful
+	e := h.newEvent(core.BuildStepFinished, args.Options)
+	e.Step = newJSONLinesStep(args.Step, args.Order)
+	e.Successful = &successful
+	e.Skipped = args.Skipped
+	e.Message = args.Message
+	e.ArtifactURL = args.ArtifactURL
+	e.PackageURL = args.PackageURL
+	h.write(e)
+}
+
+// BuildFinished will handle the BuildFinished event.
+func (h *JSONLinesHandler) BuildFinished(args *core.BuildFinishedArgs) {
+	e := h.newEvent(core.BuildFinished, args.Options)
+	e.Result = args.Result
+	h.write(e)
+}
+
+// FullPipelineFinished will handle the FullPipelineFinished event.
+func (h *JSONLinesHandler) FullPipelineFinished(args *core.FullPipelineFinishedArgs) {
+	mainSuccessful := args.MainSuccessful
+	ranAfterSteps := args.RanAfterSteps
+	e := h.newEvent(core.FullPipelineFinished, args.Options)
+	e.MainSuccessful = &mainSuccessful
+	e.RanAfterSteps = &ranAfterSteps
+	if args.RanAfterSteps {
+		afterStepsSuccessful := args.AfterStepSuccessful
+		e.AfterStepsSuccessful = &afterStepsSuccessful
+	}
+	h.write(e)
+}
+
+// Close closes the output, unless it is stdout.
+func (h *JSONLinesHandler) Close() error {
+	h.stopped = true
+	if h.w == os.Stdout {
+		return nil
+	}
+	return h.w.Close()
+}
+
+// ListenTo will add eventhandlers to e.
+func (h *JSONLinesHandler) ListenTo(e *core.NormalizedEmitter) {
+	e.AddListener(core.BuildStarted, h.BuildStarted)
+	e.AddListener(core.BuildStepsAdded, h.BuildStepsAdded)
+	e.AddListener(core.BuildStepStarted, h.BuildStepStarted)
+	e.AddListener(core.Logs, h.Logs)
+	e.AddListener(core.BuildStepFinished, h.BuildStepFinished)
+	e.AddListener(core.BuildFinished, h.BuildFinished)
+	e.AddListener(core.FullPipelineFinished, h.FullPipelineFinished)
+}
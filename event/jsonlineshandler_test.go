@@ -0,0 +1,181 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package event
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+type JSONLinesHandlerSuite struct {
+	*util.TestSuite
+}
+
+func TestJSONLinesHandlerSuite(t *testing.T) {
+	suiteTester := &JSONLinesHandlerSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// testStep is a Step that only has the fields the handler writes
+type testStep struct {
+	core.Step
+	id     string
+	name   string
+	safeID string
+}
+
+func (s *testStep) ID() string          { return s.id }
+func (s *testStep) Name() string        { return s.name }
+func (s *testStep) DisplayName() string { return strings.ToUpper(s.name) }
+func (s *testStep) SafeID() string      { return s.safeID }
+
+// bufferCloser is a bytes.Buffer that can be closed
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error {
+	return nil
+}
+
+// failingWriter fails every write
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func (w *failingWriter) Close() error {
+	return nil
+}
+
+var testOptions = &core.PipelineOptions{
+	BuildID:    "build-id",
+	PipelineID: "pipeline-id",
+	Pipeline:   "build",
+}
+
+func (s *JSONLinesHandlerSuite) handler() (*JSONLinesHandler, *bufferCloser) {
+	buffer := &bufferCloser{}
+	h := newJSONLinesHandler(buffer)
+	h.now = func() time.Time {
+		return time.Date(2016, 1, 2, 4, 4, 5, 0, time.FixedZone("CET", 3600))
+	}
+	return h, buffer
+}
+
+func (s *JSONLinesHandlerSuite) TestBuildStarted() {
+	h, buffer := s.handler()
+	h.BuildStarted(&core.BuildStartedArgs{Options: testOptions})
+	s.Equal(`{"version":1,"event":"BuildStarted","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build"}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestBuildStepsAdded() {
+	h, buffer := s.handler()
+	h.BuildStepsAdded(&core.BuildStepsAddedArgs{
+		Options: testOptions,
+		Steps: []core.Step{
+			&testStep{id: "script", name: "build", safeID: "build-1"},
+			&testStep{id: "script", name: "test", safeID: "test-1"},
+		},
+		StoreStep:  &testStep{id: "internal/store", name: "store", safeID: "store-1"},
+		AfterSteps: []core.Step{&testStep{id: "slack-notifier", name: "notify", safeID: "notify-1"}},
+	})
+	s.Equal(`{"version":1,"event":"BuildStepsAdded","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build","steps":[`+
+		`{"id":"script","safeId":"build-1","name":"build","displayName":"BUILD","order":3,"phase":"mainSteps"},`+
+		`{"id":"script","safeId":"test-1","name":"test","displayName":"TEST","order":4,"phase":"mainSteps"},`+
+		`{"id":"internal/store","safeId":"store-1","name":"store","displayName":"STORE","order":5,"phase":"mainSteps"},`+
+		`{"id":"slack-notifier","safeId":"notify-1","name":"notify","displayName":"NOTIFY","order":6,"phase":"finalSteps"}]}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestBuildStepStarted() {
+	h, buffer := s.handler()
+	h.BuildStepStarted(&core.BuildStepStartedArgs{
+		Options: testOptions,
+		Order:   3,
+		Step:    &testStep{id: "script", name: "build", safeID: "build-1"},
+	})
+	s.Equal(`{"version":1,"event":"BuildStepStarted","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build",`+
+		`"step":{"id":"script","safeId":"build-1","name":"build","displayName":"BUILD","order":3}}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestLogs() {
+	h, buffer := s.handler()
+	step := &testStep{id: "script", name: "build", safeID: "build-1"}
+	h.Logs(&core.LogsArgs{Options: testOptions, Order: 3, Step: step, Stream: "stdout", Logs: "hello\n"})
+	h.Logs(&core.LogsArgs{Options: testOptions, Order: 3, Step: step, Stream: "stdin", Logs: "secret\n", Hidden: true})
+	s.Equal(`{"version":1,"event":"Logs","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build",`+
+		`"step":{"id":"script","safeId":"build-1","name":"build","displayName":"BUILD","order":3},"stream":"stdout","logs":"hello\n"}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestBuildStepFinished() {
+	h, buffer := s.handler()
+	h.BuildStepFinished(&core.BuildStepFinishedArgs{
+		Options:    testOptions,
+		Order:      3,
+		Step:       &testStep{id: "script", name: "build", safeID: "build-1"},
+		Successful: false,
+		Message:    "Step failed",
+	})
+	h.BuildStepFinished(&core.BuildStepFinishedArgs{
+		Options:    testOptions,
+		Order:      4,
+		Step:       &testStep{id: "internal/docker-push", name: "push", safeID: "push-1"},
+		Successful: true,
+		Skipped:    true,
+		Message:    `Skipped, when: branch == "master"`,
+	})
+	s.Equal(`{"version":1,"event":"BuildStepFinished","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build",`+
+		`"step":{"id":"script","safeId":"build-1","name":"build","displayName":"BUILD","order":3},"successful":false,"message":"Step failed"}`+"\n"+
+		`{"version":1,"event":"BuildStepFinished","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build",`+
+		`"step":{"id":"internal/docker-push","safeId":"push-1","name":"push","displayName":"PUSH","order":4},"successful":true,"skipped":true,"message":"Skipped, when: branch == \"master\""}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestBuildFinished() {
+	h, buffer := s.handler()
+	h.BuildFinished(&core.BuildFinishedArgs{Options: testOptions, Result: "passed"})
+	s.Equal(`{"version":1,"event":"BuildFinished","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build","result":"passed"}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestFullPipelineFinished() {
+	h, buffer := s.handler()
+	h.FullPipelineFinished(&core.FullPipelineFinishedArgs{Options: testOptions, MainSuccessful: true})
+	h.FullPipelineFinished(&core.FullPipelineFinishedArgs{Options: testOptions, MainSuccessful: false, RanAfterSteps: true, AfterStepSuccessful: true})
+	s.Equal(`{"version":1,"event":"FullPipelineFinished","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build","mainSuccessful":true,"ranAfterSteps":false}`+"\n"+
+		`{"version":1,"event":"FullPipelineFinished","timestamp":"2016-01-02T03:04:05Z","buildId":"build-id","pipelineId":"pipeline-id","pipeline":"build","mainSuccessful":false,"ranAfterSteps":true,"afterStepsSuccessful":true}`+"\n", buffer.String())
+}
+
+func (s *JSONLinesHandlerSuite) TestStopsAfterWriteError() {
+	w := &failingWriter{}
+	h := newJSONLinesHandler(w)
+	h.BuildStarted(&core.BuildStartedArgs{Options: testOptions})
+	h.BuildFinished(&core.BuildFinishedArgs{Options: testOptions, Result: "passed"})
+	s.Equal(1, w.writes)
+}
+
+func (s *JSONLinesHandlerSuite) TestNewJSONLinesHandlerInvalidFd() {
+	_, err := NewJSONLinesHandler("1023")
+	s.NotNil(err)
+}
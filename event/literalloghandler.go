@@ -62,6 +62,23 @@ func (h *LiteralLogHandler) Logs(args *core.LogsArgs) {
 	}
 }
 
+// BuildStepFinished will handle the BuildStepFinished event, a skipped step
+// has no logs of its own so the reason it was skipped is printed.
+func (h *LiteralLogHandler) BuildStepFinished(args *core.BuildStepFinishedArgs) {
+	if !args.Skipped {
+		return
+	}
+	message := skippedMessage(args.Message)
+	if h.options.Debug {
+		h.l.WithFields(util.LogFields{
+			"Logger":  "Literal",
+			"Skipped": true,
+		}).Printf("[x] %6s %q", "step", message)
+	} else {
+		h.l.Print(message + "\n")
+	}
+}
+
 func (h *LiteralLogHandler) shouldPrintLog(args *core.LogsArgs) bool {
 	if args.Hidden {
 		return false
@@ -78,4 +95,5 @@ func (h *LiteralLogHandler) shouldPrintLog(args *core.LogsArgs) bool {
 // ListenTo will add eventhandlers to e.
 func (h *LiteralLogHandler) ListenTo(e *core.NormalizedEmitter) {
 	e.AddListener(core.Logs, h.Logs)
+	e.AddListener(core.BuildStepFinished, h.BuildStepFinished)
 }
@@ -163,11 +163,11 @@ func (h *MetricsEventHandler) BuildStepFinished(args *core.BuildStepFinishedArgs
 // BuildStepsAdded handles the BuildStepsAdded event.
 func (h *MetricsEventHandler) BuildStepsAdded(args *core.BuildStepsAddedArgs) {
 	if args.Options.BuildID != "" {
-		h.numBuildSteps = len(args.Steps)
-		h.numBuildAfterSteps = len(args.AfterSteps)
+		h.numBuildSteps = len(core.FlattenSteps(args.Steps...))
+		h.numBuildAfterSteps = len(core.FlattenSteps(args.AfterSteps...))
 	} else if args.Options.DeployID != "" {
-		h.numDeploySteps = len(args.Steps)
-		h.numDeployAfterSteps = len(args.AfterSteps)
+		h.numDeploySteps = len(core.FlattenSteps(args.Steps...))
+		h.numDeployAfterSteps = len(core.FlattenSteps(args.AfterSteps...))
 	}
 }
 
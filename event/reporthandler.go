@@ -16,6 +16,7 @@ package event
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/wercker/reporter-client"
 	"github.com/wercker/wercker/core"
@@ -39,7 +40,10 @@ func NewReportHandler(werckerHost, token string) (*ReportHandler, error) {
 	return h, nil
 }
 
+// mapBuildSteps converts steps to the reporter format, the children of a
+// parallel group are reported as separate steps.
 func mapBuildSteps(counter *util.Counter, phase string, steps ...core.Step) []*reporter.NewStep {
+	steps = core.FlattenSteps(steps...)
 	buffer := make([]*reporter.NewStep, len(steps))
 	for i, s := range steps {
 		buffer[i] = &reporter.NewStep{
@@ -89,6 +93,13 @@ func (h *ReportHandler) flushLogs(pipelineID, stepName string, order int) error
 func (h *ReportHandler) BuildStepFinished(args *core.BuildStepFinishedArgs) {
 	h.flushLogs(args.Options.PipelineID, args.Step.Name(), args.Order)
 
+	// The reporter has no skipped state, skipped steps are reported as passed
+	// with the reason in the message
+	message := args.Message
+	if args.Skipped {
+		message = skippedMessage(args.Message)
+	}
+
 	opts := &reporter.PipelineStepFinishedArgs{
 		BuildID:               args.Options.BuildID,
 		DeployID:              args.Options.DeployID,
@@ -97,7 +108,7 @@ func (h *ReportHandler) BuildStepFinished(args *core.BuildStepFinishedArgs) {
 		Successful:            args.Successful,
 		ArtifactURL:           args.ArtifactURL,
 		PackageURL:            args.PackageURL,
-		Message:               args.Message,
+		Message:               message,
 		WerckerYamlContents:   args.WerckerYamlContents,
 		WerckerConfigContents: args.WerckerYamlContents,
 	}
@@ -105,6 +116,17 @@ func (h *ReportHandler) BuildStepFinished(args *core.BuildStepFinishedArgs) {
 	h.reporter.PipelineStepFinished(opts)
 }
 
+// skippedMessage makes sure the message of a skipped step says so
+func skippedMessage(message string) string {
+	if strings.HasPrefix(message, "Skipped") {
+		return message
+	}
+	if message == "" {
+		return "Skipped"
+	}
+	return "Skipped: " + message
+}
+
 // BuildStepsAdded will handle the BuildStepsAdded event.
 func (h *ReportHandler) BuildStepsAdded(args *core.BuildStepsAddedArgs) {
 	stepCounter := &util.Counter{Current: 3}
@@ -0,0 +1,167 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/termie/go-shutil"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+// LocalBox is a Box for the local runtime, there is no image to fetch and
+// instead of a container we prepare the scratch directory on the host.
+type LocalBox struct {
+	options *core.PipelineOptions
+	logger  *util.LogEntry
+}
+
+// NewLocalBox constructor
+func NewLocalBox(options *core.PipelineOptions) *LocalBox {
+	logger := util.RootLogger().WithField("Logger", "LocalBox")
+	return &LocalBox{options: options, logger: logger}
+}
+
+// GetName getter
+func (b *LocalBox) GetName() string {
+	return "local"
+}
+
+// GetTag getter
+func (b *LocalBox) GetTag() string {
+	return "latest"
+}
+
+// Repository getter
+func (b *LocalBox) Repository() string {
+	return "local"
+}
+
+// container is what we hand out in place of a docker container
+func (b *LocalBox) container() *docker.Container {
+	return &docker.Container{
+		ID:   fmt.Sprintf("local-%s", b.options.PipelineID),
+		Name: fmt.Sprintf("wercker-pipeline-%s", b.options.PipelineID),
+	}
+}
+
+// Fetch NOP, there is no image
+func (b *LocalBox) Fetch(ctx context.Context, env *util.Environment) (*docker.Image, error) {
+	return nil, nil
+}
+
+// Run does what the volume binds do for a container: everything in the
+// HostPath is copied to the MntPath, or linked into the GuestPath when using
+// direct mounts.
+func (b *LocalBox) Run(ctx context.Context, env *util.Environment) (*docker.Container, error) {
+	entries, err := ioutil.ReadDir(b.options.HostPath())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Mode()&os.ModeSymlink != os.ModeSymlink {
+			continue
+		}
+		src, err := filepath.EvalSymlinks(b.options.HostPath(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if b.options.DirectMount {
+			err = os.MkdirAll(b.options.GuestPath(), 0755)
+			if err != nil {
+				return nil, err
+			}
+			err = os.Symlink(src, b.options.GuestPath(entry.Name()))
+		} else {
+			err = os.MkdirAll(b.options.MntPath(), 0755)
+			if err != nil {
+				return nil, err
+			}
+			copyOpts := &shutil.CopyTreeOptions{CopyFunction: shutil.Copy, Symlinks: true}
+			err = shutil.CopyTree(src, b.options.MntPath(entry.Name()), copyOpts)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.container(), nil
+}
+
+// Restart NOP, the scratch directory is still there
+func (b *LocalBox) Restart() (*docker.Container, error) {
+	return b.container(), nil
+}
+
+// AddService is not supported by the local runtime, services are checked
+// before we get here
+func (b *LocalBox) AddService(service core.ServiceBox) {
+	b.logger.Warnln("Services are not supported by the local runtime:", service.GetName())
+}
+
+// Stop NOP, the shell goes away with the session
+func (b *LocalBox) Stop() {
+}
+
+// Clean removes the scratch directory
+func (b *LocalBox) Clean() error {
+	return os.RemoveAll(b.options.WorkingPath("local", b.options.PipelineID))
+}
+
+// Commit is not supported by the local runtime
+func (b *LocalBox) Commit(name, tag, message string, cleanup bool) (*docker.Image, error) {
+	return nil, fmt.Errorf("Committing is not supported by the local runtime")
+}
+
+// RecoverInteractive is not supported by the local runtime
+func (b *LocalBox) RecoverInteractive(cwd string, pipeline core.Pipeline, step core.Step) error {
+	return fmt.Errorf("Attaching on error is not supported by the local runtime")
+}
+
+// CollectCache copies the cache from the guest back to the cache dir
+func CollectCache(options *core.PipelineOptions) error {
+	cachePath := options.GuestPath("cache")
+	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
+		return nil
+	}
+	err := os.RemoveAll(options.CachePath())
+	if err != nil {
+		return err
+	}
+	copyOpts := &shutil.CopyTreeOptions{CopyFunction: shutil.Copy, Symlinks: true}
+	return shutil.CopyTree(cachePath, options.CachePath(), copyOpts)
+}
+
+// CollectFile copies a file from a path on the "guest", which is just the
+// host for the local runtime
+func CollectFile(path, name string, dst io.Writer) error {
+	f, err := os.Open(filepath.Join(path, name))
+	if os.IsNotExist(err) {
+		return util.ErrEmptyTarball
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
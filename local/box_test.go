@@ -0,0 +1,91 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+type BoxSuite struct {
+	*util.TestSuite
+}
+
+func TestBoxSuite(t *testing.T) {
+	suiteTester := &BoxSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// localOptions has the guest paths in the working dir and a source dir in
+// the host path
+func (s *BoxSuite) localOptions() *core.PipelineOptions {
+	options := core.EmptyPipelineOptions()
+	options.WorkingDir = s.WorkingDir()
+	options.PipelineID = "pipeline-id"
+	options.GuestRoot = "/pipeline"
+	options.MntRoot = "/mnt"
+	options.ReportRoot = "/report"
+	PrepareOptions(options)
+
+	err := os.MkdirAll(options.HostPath("source"), 0755)
+	s.Require().Nil(err)
+	err = ioutil.WriteFile(options.HostPath("source", "main.go"), []byte("package main"), 0644)
+	s.Require().Nil(err)
+	return options
+}
+
+func (s *BoxSuite) TestPrepareOptions() {
+	options := s.localOptions()
+	root := filepath.Join(s.WorkingDir(), "local", "pipeline-id")
+	s.Equal(filepath.Join(root, "pipeline"), options.GuestRoot)
+	s.Equal(filepath.Join(root, "mnt"), options.MntRoot)
+	s.Equal(filepath.Join(root, "report"), options.ReportRoot)
+}
+
+func (s *BoxSuite) TestRunCopies() {
+	options := s.localOptions()
+	box := NewLocalBox(options)
+
+	_, err := box.Run(context.Background(), util.NewEnvironment())
+	s.Require().Nil(err)
+	content, err := ioutil.ReadFile(options.MntPath("source", "main.go"))
+	s.Nil(err)
+	s.Equal("package main", string(content))
+
+	s.Nil(box.Clean())
+	_, err = os.Stat(options.MntRoot)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *BoxSuite) TestRunDirectMount() {
+	options := s.localOptions()
+	options.DirectMount = true
+	box := NewLocalBox(options)
+
+	_, err := box.Run(context.Background(), util.NewEnvironment())
+	s.Require().Nil(err)
+	target, err := os.Readlink(options.GuestPath("source"))
+	s.Nil(err)
+	expected, err := filepath.EvalSymlinks(options.HostPath("source"))
+	s.Require().Nil(err)
+	s.Equal(expected, target)
+}
@@ -0,0 +1,128 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package local
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+// PrepareOptions moves the guest paths into a scratch directory on the host,
+// mirroring the layout of the container (/pipeline, /mnt and /report).
+func PrepareOptions(options *core.PipelineOptions) {
+	root := options.WorkingPath("local", options.PipelineID)
+	options.GuestRoot = path.Join(root, options.GuestRoot)
+	options.MntRoot = path.Join(root, options.MntRoot)
+	options.ReportRoot = path.Join(root, options.ReportRoot)
+}
+
+// LocalTransport runs the session in a shell on the host
+type LocalTransport struct {
+	options *core.PipelineOptions
+	logger  *util.LogEntry
+}
+
+// NewLocalTransport constructor
+func NewLocalTransport(options *core.PipelineOptions) (core.Transport, error) {
+	logger := util.RootLogger().WithField("Logger", "LocalTransport")
+	return &LocalTransport{options: options, logger: logger}, nil
+}
+
+// Protocol is always the sentinel protocol. The framed protocol writes its
+// frames to stderr, which is a separate pipe here, so output written just
+// before a frame could arrive after it.
+func (t *LocalTransport) Protocol() core.Protocol {
+	if t.options.CommandProtocol == "framed" {
+		t.logger.Warnln("The local runtime does not support the framed command protocol, using the sentinel protocol")
+	}
+	return core.NewSentinelProtocol()
+}
+
+// hostEnvKeys are the only variables the shell gets from the host, enough
+// to find and run programs. The pipeline exports its own env once attached.
+var hostEnvKeys = []string{"PATH", "HOME", "TMPDIR"}
+
+// shellEnv is the environment the shell starts with
+func shellEnv() []string {
+	env := []string{}
+	for _, key := range hostEnvKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// shell prefers bash, which is what the containers usually run
+func (t *LocalTransport) shell() string {
+	if bash, err := exec.LookPath("bash"); err == nil {
+		return bash
+	}
+	return "/bin/sh"
+}
+
+// Attach starts a shell in the guest root and connects the given reader and
+// writers to it, return a context that will be closed when the shell exits
+func (t *LocalTransport) Attach(sessionCtx context.Context, stdin io.Reader, stdout, stderr io.Writer) (context.Context, error) {
+	err := os.MkdirAll(t.options.GuestPath(), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(t.shell())
+	cmd.Dir = t.options.GuestPath()
+	cmd.Env = shellEnv()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+
+	// Copy stdin ourselves, our reader never returns EOF and exec would wait
+	// for it forever
+	input, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	t.logger.Debugln("Starting local shell in", cmd.Dir)
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	go io.Copy(input, stdin)
+
+	transportCtx, cancel := context.WithCancel(sessionCtx)
+	go func() {
+		defer cancel()
+		err := cmd.Wait()
+		if err != nil {
+			t.logger.Debugln("Local shell finished:", err)
+		}
+	}()
+
+	// Don't leave the shell, or what it started, running when the session is
+	// cancelled
+	go func() {
+		<-transportCtx.Done()
+		// This fails harmlessly if the shell has exited already
+		killProcessGroup(cmd)
+	}()
+	return transportCtx, nil
+}
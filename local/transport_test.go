@@ -0,0 +1,118 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+type TransportSuite struct {
+	*util.TestSuite
+}
+
+func TestTransportSuite(t *testing.T) {
+	suiteTester := &TransportSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// attach starts a local session in the working dir
+func (s *TransportSuite) attach() (context.Context, context.CancelFunc, *core.Session) {
+	options := core.EmptyPipelineOptions()
+	options.GuestRoot = s.WorkingDir()
+	options.CommandTimeout = 10000
+	options.NoResponseTimeout = 10000
+
+	transport, err := NewLocalTransport(options)
+	s.Require().Nil(err)
+	ctx, cancel := context.WithCancel(core.NewEmitterContext(context.Background()))
+	sess := core.NewSession(options, transport)
+	sessionCtx, err := sess.Attach(ctx)
+	s.Require().Nil(err)
+	return sessionCtx, cancel, sess
+}
+
+func (s *TransportSuite) TestProtocolIsSentinel() {
+	options := core.EmptyPipelineOptions()
+	options.CommandProtocol = "framed"
+	transport, err := NewLocalTransport(options)
+	s.Require().Nil(err)
+	s.IsType(core.NewSentinelProtocol(), transport.Protocol())
+}
+
+func (s *TransportSuite) TestExitCode() {
+	sessionCtx, cancel, sess := s.attach()
+	defer cancel()
+
+	r := sess.Run(sessionCtx, "true")
+	s.Nil(r.Err())
+	s.Equal(0, r.Exit())
+
+	r = sess.Run(sessionCtx, "(exit 3)")
+	s.NotNil(r.Err())
+	s.Equal(3, r.Exit())
+
+	// The shell is still usable after a failure
+	r = sess.Run(sessionCtx, "pwd")
+	s.Nil(r.Err())
+	s.Equal(s.WorkingDir(), strings.TrimSpace(strings.Join(r.Stdout(), "")))
+}
+
+func (s *TransportSuite) TestStdoutStderr() {
+	sessionCtx, cancel, sess := s.attach()
+	defer cancel()
+
+	r := sess.Run(sessionCtx, "echo out", "echo err 1>&2")
+	s.Nil(r.Err())
+	s.Equal("out\n", strings.Join(r.Stdout(), ""))
+	s.Equal("err\n", strings.Join(r.Stderr(), ""))
+}
+
+func (s *TransportSuite) TestHostEnvironmentIsNotInherited() {
+	os.Setenv("WERCKER_TEST_HOST_ONLY", "leaked")
+	defer os.Unsetenv("WERCKER_TEST_HOST_ONLY")
+
+	sessionCtx, cancel, sess := s.attach()
+	defer cancel()
+
+	r := sess.Run(sessionCtx, `echo "${WERCKER_TEST_HOST_ONLY:-unset}"`)
+	s.Nil(r.Err())
+	s.Equal("unset\n", strings.Join(r.Stdout(), ""))
+}
+
+func (s *TransportSuite) TestTimeoutKillsProcessGroup() {
+	sessionCtx, cancel, sess := s.attach()
+	alive := filepath.Join(s.WorkingDir(), "alive")
+
+	// The background job would still write the file if only the shell got
+	// killed
+	sess.SetTimeouts(200, 0)
+	r := sess.Run(sessionCtx, "(sleep 1; touch alive) & wait")
+	s.NotNil(r.Err())
+	s.Equal(-1, r.Exit())
+	cancel()
+
+	time.Sleep(2 * time.Second)
+	_, err := os.Stat(alive)
+	s.True(os.IsNotExist(err), "the background job outlived the session")
+}
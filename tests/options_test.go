@@ -253,6 +253,7 @@ func (s *OptionsSuite) TestReporterOptions() {
 		"--report",
 		"--wercker-host", "http://example.com/wercker-host",
 		"--wercker-token", "test-token",
+		"--events-out", "events.jsonl",
 	)
 	test := func(c *cli.Context) {
 		e := emptyEnv()
@@ -262,6 +263,7 @@ func (s *OptionsSuite) TestReporterOptions() {
 		s.Equal(true, opts.ShouldReport)
 		s.Equal("http://example.com/wercker-host", opts.ReporterHost)
 		s.Equal("test-token", opts.ReporterKey)
+		s.Equal("events.jsonl", opts.EventsOut)
 	}
 	run(s, globalFlags, pipelineFlags, test, args)
 }
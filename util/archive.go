@@ -22,7 +22,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 var (
@@ -68,6 +70,9 @@ EntryLoop:
 			// finished the tar
 			break
 		}
+		if err != nil {
+			return err
+		}
 		// basic filter, we never care about this entry
 		if hdr.Name == "./" {
 			continue EntryLoop
@@ -118,8 +123,9 @@ func (a *Archive) Single(source, target string, maxSize int64) (errs chan error)
 	return errs
 }
 
-// Multi file extraction with max size and empty check
-func (a *Archive) Multi(source, target string, maxSize int64) (errs chan error) {
+// Multi file extraction with max size and empty check, the filters run
+// before anything else
+func (a *Archive) Multi(source, target string, maxSize int64, filters ...ArchiveProcessor) (errs chan error) {
 	errs = make(chan error)
 	empty := &ArchiveCheckEmpty{}
 	max := &ArchiveMaxSize{MaxSize: maxSize}
@@ -128,11 +134,8 @@ func (a *Archive) Multi(source, target string, maxSize int64) (errs chan error)
 	go func() {
 		defer close(errs)
 		defer extract.Clean()
-		err := a.Stream(
-			empty,
-			max,
-			extract,
-		)
+		processors := append(append([]ArchiveProcessor{}, filters...), empty, max, extract)
+		err := a.Stream(processors...)
 		if err != nil {
 			errs <- err
 			return
@@ -297,3 +300,95 @@ func (p *ArchiveBytes) Process(hdr *tar.Header, r io.Reader) (*tar.Header, io.Re
 	_, err := io.Copy(p, r)
 	return hdr, r, err
 }
+
+// ArchiveFilter keeps the files that match Include, or all of them when it
+// is empty, and drops the ones that match Exclude. The patterns are globs
+// relative to the directory the archive was made of, see MatchGlob. A path
+// also matches when one of its parent directories does. Directories are
+// only dropped when excluded, the files in them need them to be extracted.
+type ArchiveFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Process impl
+func (p *ArchiveFilter) Process(hdr *tar.Header, r io.Reader) (*tar.Header, io.Reader, error) {
+	// Strip the directory the archive was made of, like output/
+	parts := strings.SplitN(strings.Trim(hdr.Name, "/"), "/", 2)
+	if len(parts) < 2 {
+		return hdr, r, nil
+	}
+	name := parts[1]
+
+	if matchGlobOrParent(p.Exclude, name) {
+		return nil, r, nil
+	}
+	if hdr.FileInfo().IsDir() || len(p.Include) == 0 || matchGlobOrParent(p.Include, name) {
+		return hdr, r, nil
+	}
+	return nil, r, nil
+}
+
+func matchGlobOrParent(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if MatchGlob(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchGlob matches a slash separated name against a pattern in which
+// each segment is a path.Match pattern, or ** for any number of segments
+func MatchGlob(pattern, name string) bool {
+	return matchGlobParts(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ArchiveTarWriter writes the entries that make it this far to a new
+// tarball. The contents are written while the next processors read them, so
+// one of them has to read whole files, like ArchiveExtract does. Call Close
+// once the stream is done.
+type ArchiveTarWriter struct {
+	tw *tar.Writer
+}
+
+// NewArchiveTarWriter constructor
+func NewArchiveTarWriter(w io.Writer) *ArchiveTarWriter {
+	return &ArchiveTarWriter{tw: tar.NewWriter(w)}
+}
+
+// Process impl
+func (p *ArchiveTarWriter) Process(hdr *tar.Header, r io.Reader) (*tar.Header, io.Reader, error) {
+	if err := p.tw.WriteHeader(hdr); err != nil {
+		return hdr, r, err
+	}
+	return hdr, io.TeeReader(r, p.tw), nil
+}
+
+// Close writes the end of the tarball
+func (p *ArchiveTarWriter) Close() error {
+	return p.tw.Close()
+}
@@ -0,0 +1,120 @@
+//   Copyright 2016 Wercker Holding BV
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ArchiveSuite struct {
+	*TestSuite
+}
+
+func TestArchiveSuite(t *testing.T) {
+	suiteTester := &ArchiveSuite{&TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func makeOutputTarball(names ...string) io.Reader {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range names {
+		if name[len(name)-1] == '/' {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Typeflag: tar.TypeDir})
+			continue
+		}
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(name))
+	}
+	tw.Close()
+	return buf
+}
+
+func tarballNames(r io.Reader) []string {
+	names := []string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return names
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func (s *ArchiveSuite) TestMatchGlob() {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"dist/**", "dist/app.js", true},
+		{"dist/**", "dist/js/app.js", true},
+		{"dist/**", "src/app.js", false},
+		{"**/*.map", "app.js.map", true},
+		{"**/*.map", "dist/js/app.js.map", true},
+		{"**/*.map", "dist/js/app.js", false},
+		{"*.js", "app.js", true},
+		{"*.js", "dist/app.js", false},
+		{"dist", "dist", true},
+	}
+	for _, test := range tests {
+		s.Equal(test.match, MatchGlob(test.pattern, test.name), test.pattern+" "+test.name)
+	}
+}
+
+func (s *ArchiveSuite) TestArchiveFilter() {
+	tarball := makeOutputTarball(
+		"output/",
+		"output/README",
+		"output/dist/",
+		"output/dist/app.js",
+		"output/dist/app.js.map",
+		"output/node_modules/",
+		"output/node_modules/dep.js",
+	)
+	filter := &ArchiveFilter{
+		Include: []string{"dist/**"},
+		Exclude: []string{"**/*.map", "node_modules"},
+	}
+	buf := &bytes.Buffer{}
+	writer := NewArchiveTarWriter(buf)
+	target := filepath.Join(s.WorkingDir(), "output")
+
+	err := <-NewArchive(tarball).Multi("output", target, 1024*1024, filter, writer)
+	s.Require().Nil(err)
+	s.Require().Nil(writer.Close())
+
+	s.Equal([]string{"output/", "output/dist/", "output/dist/app.js"}, tarballNames(buf))
+	content, err := ioutil.ReadFile(filepath.Join(target, "dist", "app.js"))
+	s.Nil(err)
+	s.Equal("output/dist/app.js", string(content))
+	_, err = ioutil.ReadFile(filepath.Join(target, "README"))
+	s.NotNil(err)
+}
+
+func (s *ArchiveSuite) TestArchiveFilterEmpty() {
+	tarball := makeOutputTarball("output/", "output/README")
+	filter := &ArchiveFilter{Include: []string{"dist/**"}}
+	err := <-NewArchive(tarball).Multi("output", filepath.Join(s.WorkingDir(), "output"), 1024*1024, filter)
+	s.Equal(ErrEmptyTarball, err)
+}
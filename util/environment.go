@@ -16,7 +16,7 @@ package util
 
 import (
 	"fmt"
-	"os"
+	"strconv"
 	"strings"
 )
 
@@ -89,11 +89,202 @@ func (e *Environment) Ordered() [][]string {
 	return a
 }
 
-// Interpolate is a naive interpolator that attempts to replace variables
-// identified by $VAR with the value of the VAR pipeline environment variable
+// Interpolate replaces variables identified by $VAR or ${VAR} with the value
+// of the VAR pipeline environment variable, see InterpolateChecked for the
+// expansions it supports. Expansions that fail are left empty.
 // NOTE(termie): This will check the hidden env, too.
 func (e *Environment) Interpolate(s string) string {
-	return os.Expand(s, e.GetInclHidden)
+	value, _ := e.InterpolateChecked(s)
+	return value
+}
+
+// InterpolateChecked does POSIX shell style parameter expansion:
+//
+//	$VAR, ${VAR}         the value of VAR
+//	${VAR:-word}         word when VAR is unset or empty, ${VAR-word} when unset
+//	${VAR:+word}         word when VAR is set and not empty, ${VAR+word} when set
+//	${VAR:?message}      an error when VAR is unset or empty, ${VAR?message} when unset
+//	${VAR:offset:length} a substring, a negative offset counts from the end
+//	$$                   a literal $
+//
+// The words are expanded too. It returns the first error, the failing
+// expansions are left empty in the returned value.
+func (e *Environment) InterpolateChecked(s string) (string, error) {
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			buf = append(buf, s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			buf = append(buf, '$')
+			i++
+		case next == '{':
+			end := matchingBrace(s, i+1)
+			if end == -1 {
+				fail(fmt.Errorf("Unterminated ${ in %q", s))
+				buf = append(buf, s[i:]...)
+				i = len(s)
+				break
+			}
+			value, err := e.expandParameter(s[i+2 : end])
+			if err != nil {
+				fail(err)
+			}
+			buf = append(buf, value...)
+			i = end
+		case isShellSpecial(next):
+			value, _ := e.LookupInclHidden(s[i+1 : i+2])
+			buf = append(buf, value...)
+			i++
+		case isShellNameChar(next) && !isDigit(next):
+			j := i + 1
+			for j < len(s) && isShellNameChar(s[j]) {
+				j++
+			}
+			value, _ := e.LookupInclHidden(s[i+1 : j])
+			buf = append(buf, value...)
+			i = j - 1
+		default:
+			buf = append(buf, '$')
+		}
+	}
+	return string(buf), firstErr
+}
+
+// expandParameter expands what is between the braces of ${...}
+func (e *Environment) expandParameter(expr string) (string, error) {
+	n := 0
+	if n < len(expr) && isShellSpecial(expr[0]) {
+		n = 1
+	} else {
+		for n < len(expr) && isShellNameChar(expr[n]) {
+			n++
+		}
+	}
+	name, rest := expr[:n], expr[n:]
+	if name == "" {
+		return "", fmt.Errorf("Bad substitution ${%s}", expr)
+	}
+	value, set := e.LookupInclHidden(name)
+	if rest == "" {
+		return value, nil
+	}
+
+	colon := rest[0] == ':'
+	op, word := byte(0), ""
+	if colon && len(rest) > 1 && strings.IndexByte("-+?", rest[1]) != -1 {
+		op, word = rest[1], rest[2:]
+	} else if !colon && strings.IndexByte("-+?", rest[0]) != -1 {
+		op, word = rest[0], rest[1:]
+	} else if colon {
+		return substring(value, rest[1:], expr)
+	} else {
+		return "", fmt.Errorf("Bad substitution ${%s}", expr)
+	}
+
+	null := !set || (colon && value == "")
+	switch op {
+	case '-':
+		if null {
+			return e.InterpolateChecked(word)
+		}
+	case '+':
+		if null {
+			return "", nil
+		}
+		return e.InterpolateChecked(word)
+	case '?':
+		if null {
+			message, err := e.InterpolateChecked(word)
+			if err != nil {
+				return "", err
+			}
+			if message == "" {
+				message = "parameter null or not set"
+			}
+			return "", fmt.Errorf("%s: %s", name, message)
+		}
+	}
+	return value, nil
+}
+
+// substring does ${VAR:offset:length}, spec is "offset:length"
+func substring(value, spec, expr string) (string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	runes := []rune(value)
+	offset, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("Bad substitution ${%s}", expr)
+	}
+	if offset < 0 {
+		offset += len(runes)
+		if offset < 0 {
+			return "", nil
+		}
+	}
+	if offset > len(runes) {
+		offset = len(runes)
+	}
+
+	end := len(runes)
+	if len(parts) == 2 {
+		length, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return "", fmt.Errorf("Bad substitution ${%s}", expr)
+		}
+		if length < 0 {
+			// A negative length is an offset from the end
+			end = len(runes) + length
+			if end < offset {
+				return "", fmt.Errorf("Substring expression < 0 in ${%s}", expr)
+			}
+		} else if offset+length < end {
+			end = offset + length
+		}
+	}
+	return string(runes[offset:end]), nil
+}
+
+// matchingBrace returns the index of the } that closes the { at open
+func matchingBrace(s string, open int) int {
+	depth := 1
+	for i := open + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isShellNameChar(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isShellSpecial is true for the single character parameters like $1 and $@
+func isShellSpecial(c byte) bool {
+	return isDigit(c) || strings.IndexByte("*#@!?-", c) != -1
 }
 
 var mirroredEnv = [...]string{
@@ -114,9 +305,13 @@ func (e *Environment) GetPassthru() (env *Environment) {
 	return env
 }
 
-// Collect the hidden passthru variables
+// Collect the hidden passthru variables, the hidden env of the host (like
+// the secrets file) and XXX_ prefixed variables, which take precedence
 func (e *Environment) GetHiddenPassthru() (env *Environment) {
 	a := [][]string{}
+	if e.Hidden != nil {
+		a = append(a, e.Hidden.Ordered()...)
+	}
 	for key, value := range e.Map {
 		if strings.HasPrefix(key, "XXX_") {
 			a = append(a, []string{strings.TrimPrefix(key, "XXX_"), value})
@@ -141,17 +336,24 @@ func (e *Environment) GetMirror() [][]string {
 // GetInclHidden gets an individual record either from this environment or the
 // hidden environment.
 func (e *Environment) GetInclHidden(key string) string {
+	value, _ := e.LookupInclHidden(key)
+	return value
+}
+
+// LookupInclHidden is GetInclHidden that also reports whether the record is
+// set at all.
+func (e *Environment) LookupInclHidden(key string) (string, bool) {
 	if e.Map != nil {
 		if val, ok := e.Map[key]; ok {
-			return val
+			return val, true
 		}
 	}
 
 	if e.Hidden != nil && e.Hidden.Map != nil {
 		if val, ok := e.Hidden.Map[key]; ok {
-			return val
+			return val, true
 		}
 	}
 
-	return ""
+	return "", false
 }
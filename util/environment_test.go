@@ -39,6 +39,16 @@ func (s *EnvironmentSuite) TestPassthru() {
 	s.Equal(1, len(env.GetHiddenPassthru().Ordered()))
 }
 
+func (s *EnvironmentSuite) TestHiddenPassthruInclHidden() {
+	env := NewEnvironment("XXX_TOKEN=env", "NOT=included")
+	env.Hidden.Add("TOKEN", "secrets")
+	env.Hidden.Add("OTHER", "secrets")
+	hidden := env.GetHiddenPassthru()
+	s.Equal("env", hidden.Get("TOKEN"), "XXX_ vars override the hidden env")
+	s.Equal("secrets", hidden.Get("OTHER"))
+	s.Equal("", hidden.Get("NOT"))
+}
+
 func (s *EnvironmentSuite) TestInterpolate() {
 	env := NewEnvironment("PUBLIC=foo", "X_PRIVATE=zed", "XXX_OTHER=otter")
 	env.Update(env.GetPassthru().Ordered())
@@ -57,6 +67,54 @@ func (s *EnvironmentSuite) TestInterpolate() {
 	s.Equal(env.Interpolate("one two $PUBLIC bar"), "one two foo bar", "interpolation should work in middle of string.")
 }
 
+func (s *EnvironmentSuite) TestInterpolateExpansions() {
+	env := NewEnvironment("EMPTY=", "TAG=v1.2.3", "NAME=wercker")
+	env.Hidden.Add("TOKEN", "s3cr3t")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"${EMPTY:-quay.io}/app", "quay.io/app"},
+		{"${EMPTY-quay.io}/app", "/app"},
+		{"${MISSING-quay.io}/app", "quay.io/app"},
+		{"${MISSING:-${NAME}}", "wercker"},
+		{"${NAME:+set}", "set"},
+		{"${EMPTY:+set}", ""},
+		{"${EMPTY+set}", "set"},
+		{"${EMPTY?unused}", ""},
+		{"${TAG:1}", "1.2.3"},
+		{"${TAG:1:3}", "1.2"},
+		{"${TAG: -3}", "2.3"},
+		{"${TAG:0:-2}", "v1.2"},
+		{"${TOKEN}", "s3cr3t"},
+		{"$$NAME", "$NAME"},
+		{"costs 5$", "costs 5$"},
+	}
+	for _, test := range tests {
+		value, err := env.InterpolateChecked(test.input)
+		s.Nil(err, test.input)
+		s.Equal(test.expected, value, test.input)
+	}
+}
+
+func (s *EnvironmentSuite) TestInterpolateErrors() {
+	env := NewEnvironment("EMPTY=", "NAME=wercker")
+
+	value, err := env.InterpolateChecked("${REGISTRY:?registry is required}/app")
+	s.Equal("REGISTRY: registry is required", err.Error())
+	s.Equal("/app", value)
+	s.Equal("/app", env.Interpolate("${REGISTRY:?registry is required}/app"))
+
+	_, err = env.InterpolateChecked("${EMPTY:?}")
+	s.Equal("EMPTY: parameter null or not set", err.Error())
+
+	for _, input := range []string{"${NAME", "${}", "${NAME%.*}", "${NAME:x}"} {
+		_, err := env.InterpolateChecked(input)
+		s.NotNil(err, input)
+	}
+}
+
 func (s *EnvironmentSuite) TestOrdered() {
 	env := NewEnvironment("PUBLIC=foo", "X_PRIVATE=zed")
 	expected := [][]string{[]string{"PUBLIC", "foo"}, []string{"X_PRIVATE", "zed"}}
@@ -153,6 +153,11 @@ func Untargzip(path string, r io.Reader) error {
 			}
 			continue
 		}
+		// TarPath doesn't write entries for directories
+		err = os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			return err
+		}
 		file, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE, hdr.FileInfo().Mode())
 		defer file.Close()
 		if err != nil {